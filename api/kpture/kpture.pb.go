@@ -80,11 +80,14 @@ type CaptureInfo struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Timestamp      int64        `protobuf:"varint,1,opt,name=Timestamp,proto3" json:"Timestamp,omitempty"`
+	Timestamp      int64        `protobuf:"varint,1,opt,name=Timestamp,proto3" json:"Timestamp,omitempty"` // unix timestamp in seconds, kept for older clients
 	CaptureLength  int64        `protobuf:"varint,2,opt,name=CaptureLength,proto3" json:"CaptureLength,omitempty"`
 	Length         int64        `protobuf:"varint,3,opt,name=Length,proto3" json:"Length,omitempty"`
 	InterfaceIndex int64        `protobuf:"varint,4,opt,name=InterfaceIndex,proto3" json:"InterfaceIndex,omitempty"`
 	AncillaryData  []*Auxiliary `protobuf:"bytes,5,rep,name=AncillaryData,proto3" json:"AncillaryData,omitempty"`
+	TimestampNano  int64        `protobuf:"varint,6,opt,name=TimestampNano,proto3" json:"TimestampNano,omitempty"` // unix timestamp in nanoseconds
+	InterfaceName  string       `protobuf:"bytes,7,opt,name=InterfaceName,proto3" json:"InterfaceName,omitempty"`  // name of the captured interface in the pod
+	LinkType       *int32       `protobuf:"varint,8,opt,name=LinkType,proto3,oneof" json:"LinkType,omitempty"`     // pcap link type of the interface, older agents do not set it and capture ethernet
 }
 
 func (x *CaptureInfo) Reset() {
@@ -154,6 +157,27 @@ func (x *CaptureInfo) GetAncillaryData() []*Auxiliary {
 	return nil
 }
 
+func (x *CaptureInfo) GetTimestampNano() int64 {
+	if x != nil {
+		return x.TimestampNano
+	}
+	return 0
+}
+
+func (x *CaptureInfo) GetInterfaceName() string {
+	if x != nil {
+		return x.InterfaceName
+	}
+	return ""
+}
+
+func (x *CaptureInfo) GetLinkType() int32 {
+	if x != nil && x.LinkType != nil {
+		return *x.LinkType
+	}
+	return 0
+}
+
 type Packet struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -253,7 +277,7 @@ type ReadyRsp struct {
 	unknownFields protoimpl.UnknownFields
 
 	Ready    bool     `protobuf:"varint,1,opt,name=ready,proto3" json:"ready,omitempty"`
-	NotReady []string `protobuf:"bytes,2,rep,name=notReady,proto3" json:"notReady,omitempty"`
+	NotReady []string `protobuf:"bytes,2,rep,name=notReady,proto3" json:"notReady,omitempty"` // expected pods without registered agent
 }
 
 func (x *ReadyRsp) Reset() {
@@ -307,8 +331,11 @@ type Pod struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Name      string `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
-	Namespace string `protobuf:"bytes,2,opt,name=Namespace,proto3" json:"Namespace,omitempty"`
+	Name       string   `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
+	Namespace  string   `protobuf:"bytes,2,opt,name=Namespace,proto3" json:"Namespace,omitempty"`
+	Node       string   `protobuf:"bytes,3,opt,name=Node,proto3" json:"Node,omitempty"`
+	Interfaces []string `protobuf:"bytes,4,rep,name=Interfaces,proto3" json:"Interfaces,omitempty"` // captured interfaces of the pod
+	Version    string   `protobuf:"bytes,5,opt,name=Version,proto3" json:"Version,omitempty"`       // kpture version of the agent
 }
 
 func (x *Pod) Reset() {
@@ -357,19 +384,253 @@ func (x *Pod) GetNamespace() string {
 	return ""
 }
 
+func (x *Pod) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
+func (x *Pod) GetInterfaces() []string {
+	if x != nil {
+		return x.Interfaces
+	}
+	return nil
+}
+
+func (x *Pod) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+type Agent struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Pod          *Pod  `protobuf:"bytes,1,opt,name=Pod,proto3" json:"Pod,omitempty"`
+	RegisteredAt int64 `protobuf:"varint,2,opt,name=RegisteredAt,proto3" json:"RegisteredAt,omitempty"` // unix timestamp in nanoseconds
+	LastSeen     int64 `protobuf:"varint,3,opt,name=LastSeen,proto3" json:"LastSeen,omitempty"`         // unix timestamp in nanoseconds of the last packet or heartbeat
+}
+
+func (x *Agent) Reset() {
+	*x = Agent{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_kpture_kpture_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Agent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Agent) ProtoMessage() {}
+
+func (x *Agent) ProtoReflect() protoreflect.Message {
+	mi := &file_kpture_kpture_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Agent.ProtoReflect.Descriptor instead.
+func (*Agent) Descriptor() ([]byte, []int) {
+	return file_kpture_kpture_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Agent) GetPod() *Pod {
+	if x != nil {
+		return x.Pod
+	}
+	return nil
+}
+
+func (x *Agent) GetRegisteredAt() int64 {
+	if x != nil {
+		return x.RegisteredAt
+	}
+	return 0
+}
+
+func (x *Agent) GetLastSeen() int64 {
+	if x != nil {
+		return x.LastSeen
+	}
+	return 0
+}
+
+type AgentsRsp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Agents []*Agent `protobuf:"bytes,1,rep,name=Agents,proto3" json:"Agents,omitempty"`
+}
+
+func (x *AgentsRsp) Reset() {
+	*x = AgentsRsp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_kpture_kpture_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *AgentsRsp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentsRsp) ProtoMessage() {}
+
+func (x *AgentsRsp) ProtoReflect() protoreflect.Message {
+	mi := &file_kpture_kpture_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentsRsp.ProtoReflect.Descriptor instead.
+func (*AgentsRsp) Descriptor() ([]byte, []int) {
+	return file_kpture_kpture_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *AgentsRsp) GetAgents() []*Agent {
+	if x != nil {
+		return x.Agents
+	}
+	return nil
+}
+
+type StartRsp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	StartTime int64 `protobuf:"varint,1,opt,name=StartTime,proto3" json:"StartTime,omitempty"` // unix timestamp in nanoseconds, the packets captured before are discarded
+}
+
+func (x *StartRsp) Reset() {
+	*x = StartRsp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_kpture_kpture_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StartRsp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StartRsp) ProtoMessage() {}
+
+func (x *StartRsp) ProtoReflect() protoreflect.Message {
+	mi := &file_kpture_kpture_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StartRsp.ProtoReflect.Descriptor instead.
+func (*StartRsp) Descriptor() ([]byte, []int) {
+	return file_kpture_kpture_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *StartRsp) GetStartTime() int64 {
+	if x != nil {
+		return x.StartTime
+	}
+	return 0
+}
+
+type WaitReadyReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Pods    []string `protobuf:"bytes,1,rep,name=Pods,proto3" json:"Pods,omitempty"`        // names of the expected pods
+	Timeout int64    `protobuf:"varint,2,opt,name=Timeout,proto3" json:"Timeout,omitempty"` // nanoseconds, the not ready pods are returned after the timeout
+}
+
+func (x *WaitReadyReq) Reset() {
+	*x = WaitReadyReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_kpture_kpture_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *WaitReadyReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WaitReadyReq) ProtoMessage() {}
+
+func (x *WaitReadyReq) ProtoReflect() protoreflect.Message {
+	mi := &file_kpture_kpture_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WaitReadyReq.ProtoReflect.Descriptor instead.
+func (*WaitReadyReq) Descriptor() ([]byte, []int) {
+	return file_kpture_kpture_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *WaitReadyReq) GetPods() []string {
+	if x != nil {
+		return x.Pods
+	}
+	return nil
+}
+
+func (x *WaitReadyReq) GetTimeout() int64 {
+	if x != nil {
+		return x.Timeout
+	}
+	return 0
+}
+
 type PacketDescriptor struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Name   string  `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
-	Packet *Packet `protobuf:"bytes,2,opt,name=Packet,proto3" json:"Packet,omitempty"`
+	Name   string      `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
+	Packet *Packet     `protobuf:"bytes,2,opt,name=Packet,proto3" json:"Packet,omitempty"`
+	Stats  *AgentStats `protobuf:"bytes,3,opt,name=Stats,proto3" json:"Stats,omitempty"` // sent by the agents without packet
 }
 
 func (x *PacketDescriptor) Reset() {
 	*x = PacketDescriptor{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_kpture_kpture_proto_msgTypes[6]
+		mi := &file_kpture_kpture_proto_msgTypes[10]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -382,7 +643,7 @@ func (x *PacketDescriptor) String() string {
 func (*PacketDescriptor) ProtoMessage() {}
 
 func (x *PacketDescriptor) ProtoReflect() protoreflect.Message {
-	mi := &file_kpture_kpture_proto_msgTypes[6]
+	mi := &file_kpture_kpture_proto_msgTypes[10]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -395,7 +656,7 @@ func (x *PacketDescriptor) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PacketDescriptor.ProtoReflect.Descriptor instead.
 func (*PacketDescriptor) Descriptor() ([]byte, []int) {
-	return file_kpture_kpture_proto_rawDescGZIP(), []int{6}
+	return file_kpture_kpture_proto_rawDescGZIP(), []int{10}
 }
 
 func (x *PacketDescriptor) GetName() string {
@@ -412,6 +673,139 @@ func (x *PacketDescriptor) GetPacket() *Packet {
 	return nil
 }
 
+func (x *PacketDescriptor) GetStats() *AgentStats {
+	if x != nil {
+		return x.Stats
+	}
+	return nil
+}
+
+type AgentStats struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name         string `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
+	Received     uint64 `protobuf:"varint,2,opt,name=Received,proto3" json:"Received,omitempty"`         // packets received by the agent capture filter
+	Dropped      uint64 `protobuf:"varint,3,opt,name=Dropped,proto3" json:"Dropped,omitempty"`           // packets dropped by the kernel, the capture buffer was full
+	IfDropped    uint64 `protobuf:"varint,4,opt,name=IfDropped,proto3" json:"IfDropped,omitempty"`       // packets dropped by the interface
+	ProxyDropped uint64 `protobuf:"varint,5,opt,name=ProxyDropped,proto3" json:"ProxyDropped,omitempty"` // packets dropped by the proxy, its buffer was full
+}
+
+func (x *AgentStats) Reset() {
+	*x = AgentStats{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_kpture_kpture_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *AgentStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentStats) ProtoMessage() {}
+
+func (x *AgentStats) ProtoReflect() protoreflect.Message {
+	mi := &file_kpture_kpture_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentStats.ProtoReflect.Descriptor instead.
+func (*AgentStats) Descriptor() ([]byte, []int) {
+	return file_kpture_kpture_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *AgentStats) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *AgentStats) GetReceived() uint64 {
+	if x != nil {
+		return x.Received
+	}
+	return 0
+}
+
+func (x *AgentStats) GetDropped() uint64 {
+	if x != nil {
+		return x.Dropped
+	}
+	return 0
+}
+
+func (x *AgentStats) GetIfDropped() uint64 {
+	if x != nil {
+		return x.IfDropped
+	}
+	return 0
+}
+
+func (x *AgentStats) GetProxyDropped() uint64 {
+	if x != nil {
+		return x.ProxyDropped
+	}
+	return 0
+}
+
+type StatsRsp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Agents []*AgentStats `protobuf:"bytes,1,rep,name=Agents,proto3" json:"Agents,omitempty"`
+}
+
+func (x *StatsRsp) Reset() {
+	*x = StatsRsp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_kpture_kpture_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StatsRsp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatsRsp) ProtoMessage() {}
+
+func (x *StatsRsp) ProtoReflect() protoreflect.Message {
+	mi := &file_kpture_kpture_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatsRsp.ProtoReflect.Descriptor instead.
+func (*StatsRsp) Descriptor() ([]byte, []int) {
+	return file_kpture_kpture_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *StatsRsp) GetAgents() []*AgentStats {
+	if x != nil {
+		return x.Agents
+	}
+	return nil
+}
+
 var File_kpture_kpture_proto protoreflect.FileDescriptor
 
 var file_kpture_kpture_proto_rawDesc = []byte{
@@ -420,7 +814,7 @@ var file_kpture_kpture_proto_rawDesc = []byte{
 	0x0a, 0x09, 0x41, 0x75, 0x78, 0x69, 0x6c, 0x69, 0x61, 0x72, 0x79, 0x12, 0x19, 0x0a, 0x08, 0x74,
 	0x79, 0x70, 0x65, 0x5f, 0x75, 0x72, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x74,
 	0x79, 0x70, 0x65, 0x55, 0x72, 0x6c, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18,
-	0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x22, 0xcb, 0x01, 0x0a,
+	0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x22, 0xc5, 0x02, 0x0a,
 	0x0b, 0x43, 0x61, 0x70, 0x74, 0x75, 0x72, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x1c, 0x0a, 0x09,
 	0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52,
 	0x09, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x12, 0x24, 0x0a, 0x0d, 0x43, 0x61,
@@ -433,41 +827,105 @@ var file_kpture_kpture_proto_rawDesc = []byte{
 	0x12, 0x38, 0x0a, 0x0d, 0x41, 0x6e, 0x63, 0x69, 0x6c, 0x6c, 0x61, 0x72, 0x79, 0x44, 0x61, 0x74,
 	0x61, 0x18, 0x05, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63,
 	0x65, 0x2e, 0x41, 0x75, 0x78, 0x69, 0x6c, 0x69, 0x61, 0x72, 0x79, 0x52, 0x0d, 0x41, 0x6e, 0x63,
-	0x69, 0x6c, 0x6c, 0x61, 0x72, 0x79, 0x44, 0x61, 0x74, 0x61, 0x22, 0x54, 0x0a, 0x06, 0x50, 0x61,
-	0x63, 0x6b, 0x65, 0x74, 0x12, 0x36, 0x0a, 0x0b, 0x43, 0x61, 0x70, 0x74, 0x75, 0x72, 0x65, 0x49,
-	0x6e, 0x66, 0x6f, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x73, 0x65, 0x72, 0x76,
-	0x69, 0x63, 0x65, 0x2e, 0x43, 0x61, 0x70, 0x74, 0x75, 0x72, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x52,
-	0x0b, 0x43, 0x61, 0x70, 0x74, 0x75, 0x72, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x12, 0x0a, 0x04,
-	0x64, 0x61, 0x74, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61,
-	0x22, 0x07, 0x0a, 0x05, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x3c, 0x0a, 0x08, 0x52, 0x65, 0x61,
-	0x64, 0x79, 0x52, 0x73, 0x70, 0x12, 0x14, 0x0a, 0x05, 0x72, 0x65, 0x61, 0x64, 0x79, 0x18, 0x01,
-	0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x72, 0x65, 0x61, 0x64, 0x79, 0x12, 0x1a, 0x0a, 0x08, 0x6e,
-	0x6f, 0x74, 0x52, 0x65, 0x61, 0x64, 0x79, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x08, 0x6e,
-	0x6f, 0x74, 0x52, 0x65, 0x61, 0x64, 0x79, 0x22, 0x37, 0x0a, 0x03, 0x50, 0x6f, 0x64, 0x12, 0x12,
-	0x0a, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x61,
-	0x6d, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x4e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x18,
-	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x4e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65,
-	0x22, 0x4f, 0x0a, 0x10, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x44, 0x65, 0x73, 0x63, 0x72, 0x69,
-	0x70, 0x74, 0x6f, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01,
-	0x28, 0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x27, 0x0a, 0x06, 0x50, 0x61, 0x63, 0x6b,
-	0x65, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69,
-	0x63, 0x65, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x52, 0x06, 0x50, 0x61, 0x63, 0x6b, 0x65,
-	0x74, 0x32, 0x75, 0x0a, 0x0c, 0x41, 0x67, 0x65, 0x6e, 0x74, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63,
-	0x65, 0x12, 0x3c, 0x0a, 0x09, 0x41, 0x64, 0x64, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x12, 0x19,
-	0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x44,
-	0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x6f, 0x72, 0x1a, 0x0e, 0x2e, 0x73, 0x65, 0x72, 0x76,
-	0x69, 0x63, 0x65, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x28, 0x01, 0x30, 0x01, 0x12,
-	0x27, 0x0a, 0x05, 0x52, 0x65, 0x61, 0x64, 0x79, 0x12, 0x0c, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69,
-	0x63, 0x65, 0x2e, 0x50, 0x6f, 0x64, 0x1a, 0x0e, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65,
-	0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x32, 0x4c, 0x0a, 0x0d, 0x43, 0x6c, 0x69, 0x65,
+	0x69, 0x6c, 0x6c, 0x61, 0x72, 0x79, 0x44, 0x61, 0x74, 0x61, 0x12, 0x24, 0x0a, 0x0d, 0x54, 0x69,
+	0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x4e, 0x61, 0x6e, 0x6f, 0x18, 0x06, 0x20, 0x01, 0x28,
+	0x03, 0x52, 0x0d, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x4e, 0x61, 0x6e, 0x6f,
+	0x12, 0x24, 0x0a, 0x0d, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x66, 0x61, 0x63, 0x65, 0x4e, 0x61, 0x6d,
+	0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x66, 0x61,
+	0x63, 0x65, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x1f, 0x0a, 0x08, 0x4c, 0x69, 0x6e, 0x6b, 0x54, 0x79,
+	0x70, 0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x05, 0x48, 0x00, 0x52, 0x08, 0x4c, 0x69, 0x6e, 0x6b,
+	0x54, 0x79, 0x70, 0x65, 0x88, 0x01, 0x01, 0x42, 0x0b, 0x0a, 0x09, 0x5f, 0x4c, 0x69, 0x6e, 0x6b,
+	0x54, 0x79, 0x70, 0x65, 0x22, 0x54, 0x0a, 0x06, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x12, 0x36,
+	0x0a, 0x0b, 0x43, 0x61, 0x70, 0x74, 0x75, 0x72, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x43, 0x61,
+	0x70, 0x74, 0x75, 0x72, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x0b, 0x43, 0x61, 0x70, 0x74, 0x75,
+	0x72, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x22, 0x07, 0x0a, 0x05, 0x45, 0x6d,
+	0x70, 0x74, 0x79, 0x22, 0x3c, 0x0a, 0x08, 0x52, 0x65, 0x61, 0x64, 0x79, 0x52, 0x73, 0x70, 0x12,
+	0x14, 0x0a, 0x05, 0x72, 0x65, 0x61, 0x64, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x05,
+	0x72, 0x65, 0x61, 0x64, 0x79, 0x12, 0x1a, 0x0a, 0x08, 0x6e, 0x6f, 0x74, 0x52, 0x65, 0x61, 0x64,
+	0x79, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x08, 0x6e, 0x6f, 0x74, 0x52, 0x65, 0x61, 0x64,
+	0x79, 0x22, 0x85, 0x01, 0x0a, 0x03, 0x50, 0x6f, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x4e, 0x61, 0x6d,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x1c, 0x0a,
+	0x09, 0x4e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x09, 0x4e, 0x61, 0x6d, 0x65, 0x73, 0x70, 0x61, 0x63, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x4e,
+	0x6f, 0x64, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x6f, 0x64, 0x65, 0x12,
+	0x1e, 0x0a, 0x0a, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x66, 0x61, 0x63, 0x65, 0x73, 0x18, 0x04, 0x20,
+	0x03, 0x28, 0x09, 0x52, 0x0a, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x66, 0x61, 0x63, 0x65, 0x73, 0x12,
+	0x18, 0x0a, 0x07, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x07, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x22, 0x67, 0x0a, 0x05, 0x41, 0x67, 0x65,
+	0x6e, 0x74, 0x12, 0x1e, 0x0a, 0x03, 0x50, 0x6f, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x0c, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x50, 0x6f, 0x64, 0x52, 0x03, 0x50,
+	0x6f, 0x64, 0x12, 0x22, 0x0a, 0x0c, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x65, 0x64,
+	0x41, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0c, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74,
+	0x65, 0x72, 0x65, 0x64, 0x41, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x4c, 0x61, 0x73, 0x74, 0x53, 0x65,
+	0x65, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x4c, 0x61, 0x73, 0x74, 0x53, 0x65,
+	0x65, 0x6e, 0x22, 0x33, 0x0a, 0x09, 0x41, 0x67, 0x65, 0x6e, 0x74, 0x73, 0x52, 0x73, 0x70, 0x12,
+	0x26, 0x0a, 0x06, 0x41, 0x67, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32,
+	0x0e, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x41, 0x67, 0x65, 0x6e, 0x74, 0x52,
+	0x06, 0x41, 0x67, 0x65, 0x6e, 0x74, 0x73, 0x22, 0x28, 0x0a, 0x08, 0x53, 0x74, 0x61, 0x72, 0x74,
+	0x52, 0x73, 0x70, 0x12, 0x1c, 0x0a, 0x09, 0x53, 0x74, 0x61, 0x72, 0x74, 0x54, 0x69, 0x6d, 0x65,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x53, 0x74, 0x61, 0x72, 0x74, 0x54, 0x69, 0x6d,
+	0x65, 0x22, 0x3c, 0x0a, 0x0c, 0x57, 0x61, 0x69, 0x74, 0x52, 0x65, 0x61, 0x64, 0x79, 0x52, 0x65,
+	0x71, 0x12, 0x12, 0x0a, 0x04, 0x50, 0x6f, 0x64, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52,
+	0x04, 0x50, 0x6f, 0x64, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x54, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x07, 0x54, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x22,
+	0x7a, 0x0a, 0x10, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x44, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70,
+	0x74, 0x6f, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x27, 0x0a, 0x06, 0x50, 0x61, 0x63, 0x6b, 0x65,
+	0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63,
+	0x65, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x52, 0x06, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74,
+	0x12, 0x29, 0x0a, 0x05, 0x53, 0x74, 0x61, 0x74, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x13, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x41, 0x67, 0x65, 0x6e, 0x74, 0x53,
+	0x74, 0x61, 0x74, 0x73, 0x52, 0x05, 0x53, 0x74, 0x61, 0x74, 0x73, 0x22, 0x98, 0x01, 0x0a, 0x0a,
+	0x41, 0x67, 0x65, 0x6e, 0x74, 0x53, 0x74, 0x61, 0x74, 0x73, 0x12, 0x12, 0x0a, 0x04, 0x4e, 0x61,
+	0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x1a,
+	0x0a, 0x08, 0x52, 0x65, 0x63, 0x65, 0x69, 0x76, 0x65, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04,
+	0x52, 0x08, 0x52, 0x65, 0x63, 0x65, 0x69, 0x76, 0x65, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x44, 0x72,
+	0x6f, 0x70, 0x70, 0x65, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x44, 0x72, 0x6f,
+	0x70, 0x70, 0x65, 0x64, 0x12, 0x1c, 0x0a, 0x09, 0x49, 0x66, 0x44, 0x72, 0x6f, 0x70, 0x70, 0x65,
+	0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x04, 0x52, 0x09, 0x49, 0x66, 0x44, 0x72, 0x6f, 0x70, 0x70,
+	0x65, 0x64, 0x12, 0x22, 0x0a, 0x0c, 0x50, 0x72, 0x6f, 0x78, 0x79, 0x44, 0x72, 0x6f, 0x70, 0x70,
+	0x65, 0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0c, 0x50, 0x72, 0x6f, 0x78, 0x79, 0x44,
+	0x72, 0x6f, 0x70, 0x70, 0x65, 0x64, 0x22, 0x37, 0x0a, 0x08, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52,
+	0x73, 0x70, 0x12, 0x2b, 0x0a, 0x06, 0x41, 0x67, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x01, 0x20, 0x03,
+	0x28, 0x0b, 0x32, 0x13, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x41, 0x67, 0x65,
+	0x6e, 0x74, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x06, 0x41, 0x67, 0x65, 0x6e, 0x74, 0x73, 0x32,
+	0xa5, 0x01, 0x0a, 0x0c, 0x41, 0x67, 0x65, 0x6e, 0x74, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65,
+	0x12, 0x3c, 0x0a, 0x09, 0x41, 0x64, 0x64, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x12, 0x19, 0x2e,
+	0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x44, 0x65,
+	0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x6f, 0x72, 0x1a, 0x0e, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69,
+	0x63, 0x65, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x28, 0x01, 0x30, 0x01, 0x12, 0x27,
+	0x0a, 0x05, 0x52, 0x65, 0x61, 0x64, 0x79, 0x12, 0x0c, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63,
+	0x65, 0x2e, 0x50, 0x6f, 0x64, 0x1a, 0x0e, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e,
+	0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x2e, 0x0a, 0x09, 0x57, 0x61, 0x69, 0x74, 0x53,
+	0x74, 0x61, 0x72, 0x74, 0x12, 0x0c, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x50,
+	0x6f, 0x64, 0x1a, 0x11, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x53, 0x74, 0x61,
+	0x72, 0x74, 0x52, 0x73, 0x70, 0x22, 0x00, 0x32, 0xc8, 0x02, 0x0a, 0x0d, 0x43, 0x6c, 0x69, 0x65,
 	0x6e, 0x74, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x3b, 0x0a, 0x0a, 0x47, 0x65, 0x74,
 	0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x12, 0x0e, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63,
 	0x65, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x19, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63,
 	0x65, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x44, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74,
-	0x6f, 0x72, 0x22, 0x00, 0x30, 0x01, 0x42, 0x2b, 0x5a, 0x29, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62,
-	0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x67, 0x6d, 0x74, 0x73, 0x74, 0x65, 0x70, 0x68, 0x61, 0x6e, 0x65,
-	0x2f, 0x6b, 0x70, 0x74, 0x75, 0x72, 0x65, 0x2f, 0x61, 0x70, 0x69, 0x2f, 0x6b, 0x61, 0x70, 0x74,
-	0x75, 0x72, 0x65, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x6f, 0x72, 0x22, 0x00, 0x30, 0x01, 0x12, 0x2f, 0x0a, 0x08, 0x47, 0x65, 0x74, 0x53, 0x74, 0x61,
+	0x74, 0x73, 0x12, 0x0e, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x45, 0x6d, 0x70,
+	0x74, 0x79, 0x1a, 0x11, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x53, 0x74, 0x61,
+	0x74, 0x73, 0x52, 0x73, 0x70, 0x22, 0x00, 0x12, 0x2e, 0x0a, 0x0a, 0x45, 0x6e, 0x64, 0x53, 0x65,
+	0x73, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x0e, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e,
+	0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x0e, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e,
+	0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x32, 0x0a, 0x0a, 0x4c, 0x69, 0x73, 0x74, 0x41,
+	0x67, 0x65, 0x6e, 0x74, 0x73, 0x12, 0x0e, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e,
+	0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x12, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e,
+	0x41, 0x67, 0x65, 0x6e, 0x74, 0x73, 0x52, 0x73, 0x70, 0x22, 0x00, 0x12, 0x37, 0x0a, 0x09, 0x57,
+	0x61, 0x69, 0x74, 0x52, 0x65, 0x61, 0x64, 0x79, 0x12, 0x15, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69,
+	0x63, 0x65, 0x2e, 0x57, 0x61, 0x69, 0x74, 0x52, 0x65, 0x61, 0x64, 0x79, 0x52, 0x65, 0x71, 0x1a,
+	0x11, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x52, 0x65, 0x61, 0x64, 0x79, 0x52,
+	0x73, 0x70, 0x22, 0x00, 0x12, 0x2c, 0x0a, 0x05, 0x53, 0x74, 0x61, 0x72, 0x74, 0x12, 0x0e, 0x2e,
+	0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x11, 0x2e,
+	0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x53, 0x74, 0x61, 0x72, 0x74, 0x52, 0x73, 0x70,
+	0x22, 0x00, 0x42, 0x2b, 0x5a, 0x29, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d,
+	0x2f, 0x67, 0x6d, 0x74, 0x73, 0x74, 0x65, 0x70, 0x68, 0x61, 0x6e, 0x65, 0x2f, 0x6b, 0x70, 0x74,
+	0x75, 0x72, 0x65, 0x2f, 0x61, 0x70, 0x69, 0x2f, 0x6b, 0x61, 0x70, 0x74, 0x75, 0x72, 0x65, 0x62,
+	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -482,7 +940,7 @@ func file_kpture_kpture_proto_rawDescGZIP() []byte {
 	return file_kpture_kpture_proto_rawDescData
 }
 
-var file_kpture_kpture_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_kpture_kpture_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
 var file_kpture_kpture_proto_goTypes = []interface{}{
 	(*Auxiliary)(nil),        // 0: service.Auxiliary
 	(*CaptureInfo)(nil),      // 1: service.CaptureInfo
@@ -490,23 +948,45 @@ var file_kpture_kpture_proto_goTypes = []interface{}{
 	(*Empty)(nil),            // 3: service.Empty
 	(*ReadyRsp)(nil),         // 4: service.ReadyRsp
 	(*Pod)(nil),              // 5: service.Pod
-	(*PacketDescriptor)(nil), // 6: service.PacketDescriptor
+	(*Agent)(nil),            // 6: service.Agent
+	(*AgentsRsp)(nil),        // 7: service.AgentsRsp
+	(*StartRsp)(nil),         // 8: service.StartRsp
+	(*WaitReadyReq)(nil),     // 9: service.WaitReadyReq
+	(*PacketDescriptor)(nil), // 10: service.PacketDescriptor
+	(*AgentStats)(nil),       // 11: service.AgentStats
+	(*StatsRsp)(nil),         // 12: service.StatsRsp
 }
 var file_kpture_kpture_proto_depIdxs = []int32{
-	0, // 0: service.CaptureInfo.AncillaryData:type_name -> service.Auxiliary
-	1, // 1: service.Packet.CaptureInfo:type_name -> service.CaptureInfo
-	2, // 2: service.PacketDescriptor.Packet:type_name -> service.Packet
-	6, // 3: service.AgentService.AddPacket:input_type -> service.PacketDescriptor
-	5, // 4: service.AgentService.Ready:input_type -> service.Pod
-	3, // 5: service.ClientService.GetPackets:input_type -> service.Empty
-	3, // 6: service.AgentService.AddPacket:output_type -> service.Empty
-	3, // 7: service.AgentService.Ready:output_type -> service.Empty
-	6, // 8: service.ClientService.GetPackets:output_type -> service.PacketDescriptor
-	6, // [6:9] is the sub-list for method output_type
-	3, // [3:6] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	0,  // 0: service.CaptureInfo.AncillaryData:type_name -> service.Auxiliary
+	1,  // 1: service.Packet.CaptureInfo:type_name -> service.CaptureInfo
+	5,  // 2: service.Agent.Pod:type_name -> service.Pod
+	6,  // 3: service.AgentsRsp.Agents:type_name -> service.Agent
+	2,  // 4: service.PacketDescriptor.Packet:type_name -> service.Packet
+	11, // 5: service.PacketDescriptor.Stats:type_name -> service.AgentStats
+	11, // 6: service.StatsRsp.Agents:type_name -> service.AgentStats
+	10, // 7: service.AgentService.AddPacket:input_type -> service.PacketDescriptor
+	5,  // 8: service.AgentService.Ready:input_type -> service.Pod
+	5,  // 9: service.AgentService.WaitStart:input_type -> service.Pod
+	3,  // 10: service.ClientService.GetPackets:input_type -> service.Empty
+	3,  // 11: service.ClientService.GetStats:input_type -> service.Empty
+	3,  // 12: service.ClientService.EndSession:input_type -> service.Empty
+	3,  // 13: service.ClientService.ListAgents:input_type -> service.Empty
+	9,  // 14: service.ClientService.WaitReady:input_type -> service.WaitReadyReq
+	3,  // 15: service.ClientService.Start:input_type -> service.Empty
+	3,  // 16: service.AgentService.AddPacket:output_type -> service.Empty
+	3,  // 17: service.AgentService.Ready:output_type -> service.Empty
+	8,  // 18: service.AgentService.WaitStart:output_type -> service.StartRsp
+	10, // 19: service.ClientService.GetPackets:output_type -> service.PacketDescriptor
+	12, // 20: service.ClientService.GetStats:output_type -> service.StatsRsp
+	3,  // 21: service.ClientService.EndSession:output_type -> service.Empty
+	7,  // 22: service.ClientService.ListAgents:output_type -> service.AgentsRsp
+	4,  // 23: service.ClientService.WaitReady:output_type -> service.ReadyRsp
+	8,  // 24: service.ClientService.Start:output_type -> service.StartRsp
+	16, // [16:25] is the sub-list for method output_type
+	7,  // [7:16] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
 }
 
 func init() { file_kpture_kpture_proto_init() }
@@ -588,6 +1068,54 @@ func file_kpture_kpture_proto_init() {
 			}
 		}
 		file_kpture_kpture_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Agent); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_kpture_kpture_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AgentsRsp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_kpture_kpture_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StartRsp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_kpture_kpture_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*WaitReadyReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_kpture_kpture_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*PacketDescriptor); i {
 			case 0:
 				return &v.state
@@ -599,14 +1127,39 @@ func file_kpture_kpture_proto_init() {
 				return nil
 			}
 		}
+		file_kpture_kpture_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AgentStats); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_kpture_kpture_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StatsRsp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
+	file_kpture_kpture_proto_msgTypes[1].OneofWrappers = []interface{}{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_kpture_kpture_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   7,
+			NumMessages:   13,
 			NumExtensions: 0,
 			NumServices:   2,
 		},
@@ -24,6 +24,7 @@ const _ = grpc.SupportPackageIsVersion7
 type AgentServiceClient interface {
 	AddPacket(ctx context.Context, opts ...grpc.CallOption) (AgentService_AddPacketClient, error)
 	Ready(ctx context.Context, in *Pod, opts ...grpc.CallOption) (*Empty, error)
+	WaitStart(ctx context.Context, in *Pod, opts ...grpc.CallOption) (*StartRsp, error)
 }
 
 type agentServiceClient struct {
@@ -74,12 +75,22 @@ func (c *agentServiceClient) Ready(ctx context.Context, in *Pod, opts ...grpc.Ca
 	return out, nil
 }
 
+func (c *agentServiceClient) WaitStart(ctx context.Context, in *Pod, opts ...grpc.CallOption) (*StartRsp, error) {
+	out := new(StartRsp)
+	err := c.cc.Invoke(ctx, "/service.AgentService/WaitStart", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // AgentServiceServer is the server API for AgentService service.
 // All implementations must embed UnimplementedAgentServiceServer
 // for forward compatibility
 type AgentServiceServer interface {
 	AddPacket(AgentService_AddPacketServer) error
 	Ready(context.Context, *Pod) (*Empty, error)
+	WaitStart(context.Context, *Pod) (*StartRsp, error)
 	mustEmbedUnimplementedAgentServiceServer()
 }
 
@@ -93,6 +104,9 @@ func (UnimplementedAgentServiceServer) AddPacket(AgentService_AddPacketServer) e
 func (UnimplementedAgentServiceServer) Ready(context.Context, *Pod) (*Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Ready not implemented")
 }
+func (UnimplementedAgentServiceServer) WaitStart(context.Context, *Pod) (*StartRsp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method WaitStart not implemented")
+}
 func (UnimplementedAgentServiceServer) mustEmbedUnimplementedAgentServiceServer() {}
 
 // UnsafeAgentServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -150,6 +164,24 @@ func _AgentService_Ready_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _AgentService_WaitStart_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Pod)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).WaitStart(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/service.AgentService/WaitStart",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).WaitStart(ctx, req.(*Pod))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // AgentService_ServiceDesc is the grpc.ServiceDesc for AgentService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -161,6 +193,10 @@ var AgentService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Ready",
 			Handler:    _AgentService_Ready_Handler,
 		},
+		{
+			MethodName: "WaitStart",
+			Handler:    _AgentService_WaitStart_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -178,6 +214,11 @@ var AgentService_ServiceDesc = grpc.ServiceDesc{
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type ClientServiceClient interface {
 	GetPackets(ctx context.Context, in *Empty, opts ...grpc.CallOption) (ClientService_GetPacketsClient, error)
+	GetStats(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*StatsRsp, error)
+	EndSession(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Empty, error)
+	ListAgents(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*AgentsRsp, error)
+	WaitReady(ctx context.Context, in *WaitReadyReq, opts ...grpc.CallOption) (*ReadyRsp, error)
+	Start(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*StartRsp, error)
 }
 
 type clientServiceClient struct {
@@ -220,11 +261,61 @@ func (x *clientServiceGetPacketsClient) Recv() (*PacketDescriptor, error) {
 	return m, nil
 }
 
+func (c *clientServiceClient) GetStats(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*StatsRsp, error) {
+	out := new(StatsRsp)
+	err := c.cc.Invoke(ctx, "/service.ClientService/GetStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clientServiceClient) EndSession(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/service.ClientService/EndSession", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clientServiceClient) ListAgents(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*AgentsRsp, error) {
+	out := new(AgentsRsp)
+	err := c.cc.Invoke(ctx, "/service.ClientService/ListAgents", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clientServiceClient) WaitReady(ctx context.Context, in *WaitReadyReq, opts ...grpc.CallOption) (*ReadyRsp, error) {
+	out := new(ReadyRsp)
+	err := c.cc.Invoke(ctx, "/service.ClientService/WaitReady", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *clientServiceClient) Start(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*StartRsp, error) {
+	out := new(StartRsp)
+	err := c.cc.Invoke(ctx, "/service.ClientService/Start", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ClientServiceServer is the server API for ClientService service.
 // All implementations must embed UnimplementedClientServiceServer
 // for forward compatibility
 type ClientServiceServer interface {
 	GetPackets(*Empty, ClientService_GetPacketsServer) error
+	GetStats(context.Context, *Empty) (*StatsRsp, error)
+	EndSession(context.Context, *Empty) (*Empty, error)
+	ListAgents(context.Context, *Empty) (*AgentsRsp, error)
+	WaitReady(context.Context, *WaitReadyReq) (*ReadyRsp, error)
+	Start(context.Context, *Empty) (*StartRsp, error)
 	mustEmbedUnimplementedClientServiceServer()
 }
 
@@ -235,6 +326,21 @@ type UnimplementedClientServiceServer struct {
 func (UnimplementedClientServiceServer) GetPackets(*Empty, ClientService_GetPacketsServer) error {
 	return status.Errorf(codes.Unimplemented, "method GetPackets not implemented")
 }
+func (UnimplementedClientServiceServer) GetStats(context.Context, *Empty) (*StatsRsp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
+}
+func (UnimplementedClientServiceServer) EndSession(context.Context, *Empty) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EndSession not implemented")
+}
+func (UnimplementedClientServiceServer) ListAgents(context.Context, *Empty) (*AgentsRsp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAgents not implemented")
+}
+func (UnimplementedClientServiceServer) WaitReady(context.Context, *WaitReadyReq) (*ReadyRsp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method WaitReady not implemented")
+}
+func (UnimplementedClientServiceServer) Start(context.Context, *Empty) (*StartRsp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Start not implemented")
+}
 func (UnimplementedClientServiceServer) mustEmbedUnimplementedClientServiceServer() {}
 
 // UnsafeClientServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -269,13 +375,124 @@ func (x *clientServiceGetPacketsServer) Send(m *PacketDescriptor) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _ClientService_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClientServiceServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/service.ClientService/GetStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClientServiceServer).GetStats(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ClientService_EndSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClientServiceServer).EndSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/service.ClientService/EndSession",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClientServiceServer).EndSession(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ClientService_ListAgents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClientServiceServer).ListAgents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/service.ClientService/ListAgents",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClientServiceServer).ListAgents(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ClientService_WaitReady_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WaitReadyReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClientServiceServer).WaitReady(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/service.ClientService/WaitReady",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClientServiceServer).WaitReady(ctx, req.(*WaitReadyReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ClientService_Start_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ClientServiceServer).Start(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/service.ClientService/Start",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ClientServiceServer).Start(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // ClientService_ServiceDesc is the grpc.ServiceDesc for ClientService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
 var ClientService_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "service.ClientService",
 	HandlerType: (*ClientServiceServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetStats",
+			Handler:    _ClientService_GetStats_Handler,
+		},
+		{
+			MethodName: "EndSession",
+			Handler:    _ClientService_EndSession_Handler,
+		},
+		{
+			MethodName: "ListAgents",
+			Handler:    _ClientService_ListAgents_Handler,
+		},
+		{
+			MethodName: "WaitReady",
+			Handler:    _ClientService_WaitReady_Handler,
+		},
+		{
+			MethodName: "Start",
+			Handler:    _ClientService_Start_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "GetPackets",
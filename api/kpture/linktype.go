@@ -0,0 +1,19 @@
+package kapture
+
+import "github.com/google/gopacket/layers"
+
+// SetLink sets the link type of the captured interface.
+func (x *CaptureInfo) SetLink(t layers.LinkType) {
+	link := int32(t)
+	x.LinkType = &link
+}
+
+// Link returns the link type of the captured interface,
+// older agents do not send it and only capture ethernet interfaces.
+// A link type sent as 0 is DLT_NULL, not a missing link type.
+func (x *CaptureInfo) Link() layers.LinkType {
+	if x == nil || x.LinkType == nil {
+		return layers.LinkTypeEthernet
+	}
+	return layers.LinkType(*x.LinkType)
+}
@@ -0,0 +1,27 @@
+package kapture
+
+import (
+	"context"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// SessionKey is the grpc metadata key of the capture session of the agent and client calls.
+const SessionKey = "kpture-session"
+
+// WithSession returns a context sending the capture session id with the outgoing calls.
+func WithSession(ctx context.Context, id string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, SessionKey, id)
+}
+
+// SessionOf returns the capture session id of an incoming call, empty if the caller did not set it.
+func SessionOf(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(SessionKey); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
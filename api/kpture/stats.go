@@ -0,0 +1,6 @@
+package kapture
+
+// Drops returns the packets of the agent dropped by the kernel, the interface or the proxy.
+func (x *AgentStats) Drops() uint64 {
+	return x.GetDropped() + x.GetIfDropped() + x.GetProxyDropped()
+}
@@ -0,0 +1,22 @@
+package kapture
+
+import "time"
+
+// SetTime sets both the second and the nanosecond capture timestamps.
+func (x *CaptureInfo) SetTime(t time.Time) {
+	x.Timestamp = t.Unix()
+	x.TimestampNano = t.UnixNano()
+}
+
+// Time returns the capture timestamp with the best precision sent by the agent.
+// Older agents only send seconds, a zero time is returned when no timestamp is set.
+func (x *CaptureInfo) Time() time.Time {
+	switch {
+	case x.GetTimestampNano() != 0:
+		return time.Unix(0, x.GetTimestampNano())
+	case x.GetTimestamp() != 0:
+		return time.Unix(x.GetTimestamp(), 0)
+	default:
+		return time.Time{}
+	}
+}
@@ -12,12 +12,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
+	"net"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	capture "github.com/gmtstephane/kpture/api/kpture"
 	"github.com/gmtstephane/kpture/cmd/utils"
 	"github.com/google/gopacket"
-	"github.com/google/gopacket/pcap"
+	"github.com/google/gopacket/layers"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -31,11 +36,22 @@ var (
 	enableTermMessagePath bool
 	filter                string
 	termMessagePath       string
+	engine                string
+	ringSize              int
+	blockTimeout          time.Duration
+	session               string
+	podName               string
+	podNamespace          string
+	nodeName              string
+	waitForStart          bool
 )
 
 const (
-	defaultSnapLen    = int32(1500)
-	defaultTargetPort = 10000
+	defaultSnapLen      = int32(1500)
+	defaultTargetPort   = 10000
+	defaultRingSize     = 64 // MB
+	defaultBlockTimeout = 64 * time.Millisecond
+	statsInterval       = 2 * time.Second
 )
 
 var agentCmd = &cobra.Command{
@@ -58,12 +74,14 @@ It is meant to be run as a sidecar/ephemeral container in a pod but can be run s
 			return t.TerminationMessage(errors.New("agentProxyTarget not set"))
 		}
 
-		// Open device to capture on
-		handle, err := pcap.OpenLive(device, snapLen, false, -1)
+		interfaces, err := net.Interfaces()
+		if err != nil {
+			return t.TerminationMessage(err)
+		}
+		devices, err := utils.Devices(device, interfaces)
 		if err != nil {
 			return t.TerminationMessage(err)
 		}
-		defer handle.Close()
 
 		//Handle filter
 		defaultfilter := fmt.Sprintf("port not %d", proxyPort)
@@ -72,8 +90,27 @@ It is meant to be run as a sidecar/ephemeral container in a pod but can be run s
 		} else {
 			filter = fmt.Sprintf("%s and %s", filter, defaultfilter)
 		}
-		if err = handle.SetBPFFilter(filter); err != nil {
-			return t.TerminationMessage(err)
+
+		// Open the devices to capture on
+		sources := make([]packetEngine, 0, len(devices))
+		defer func() {
+			logEngineStats(sources, devices)
+			for _, e := range sources {
+				e.Close()
+			}
+		}()
+		for _, d := range devices {
+			e, errOpen := openEngine(engine, engineOpts{
+				device:       d,
+				snapLen:      snapLen,
+				filter:       filter,
+				ringSize:     ringSize,
+				blockTimeout: blockTimeout,
+			})
+			if errOpen != nil {
+				return t.TerminationMessage(fmt.Errorf("%s: %w", d, errOpen))
+			}
+			sources = append(sources, e)
 		}
 
 		// Connect to proxy server
@@ -85,19 +122,43 @@ It is meant to be run as a sidecar/ephemeral container in a pod but can be run s
 		defer conn.Close()
 
 		cli := capture.NewAgentServiceClient(conn)
-		packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
+		packets := mergePackets(sources)
+
+		// the calls are routed to the capture session by the proxy
+		ctx := capture.WithSession(context.Background(), session)
 
-		// Check if proxy server is ready
-		_, err = cli.Ready(context.Background(), &capture.Pod{})
+		// the agent registers its pod in the proxy, the packets are sent with the pod name
+		if podName == "" {
+			podName = hostname
+		}
+		pod := &capture.Pod{
+			Name:       podName,
+			Namespace:  podNamespace,
+			Node:       nodeName,
+			Interfaces: devices,
+			Version:    utils.BuildVersion(),
+		}
+		_, err = cli.Ready(ctx, pod)
 		if err != nil {
 			return t.TerminationMessage(err)
 		}
 
-		addPacketClient, err := cli.AddPacket(context.Background())
+		// the packets are discarded until the client starts the capture of every agent at the same time
+		started := !waitForStart
+		var start <-chan struct{}
+		if waitForStart {
+			start = waitStart(ctx, cli, pod)
+		}
+
+		addPacketClient, err := cli.AddPacket(ctx)
 		if err != nil {
 			return t.TerminationMessage(err)
 		}
 
+		ticker := time.NewTicker(statsInterval)
+		defer ticker.Stop()
+		var lastStats []engineStats
+
 		stopchan := make(chan error, 1)
 		// If we receive a message back, we close the connexion and exit
 		go func() {
@@ -112,18 +173,41 @@ It is meant to be run as a sidecar/ephemeral container in a pod but can be run s
 			case <-stopchan:
 				return nil
 
+			// the capture counters are sent to the proxy with the packets
+			case <-ticker.C:
+				lastStats = logEngineStatsChange(sources, devices, lastStats)
+				err = addPacketClient.Send(&capture.PacketDescriptor{Name: podName, Stats: agentStats(lastStats)})
+				if err != nil {
+					if errors.Is(err, io.EOF) {
+						return nil
+					}
+					return t.TerminationMessage(err)
+				}
+
+			case <-start:
+				started, start = true, nil
+
 			// If we receive a packet, we send it to the proxy server
-			case packet := <-packetSource.Packets():
+			case packet, ok := <-packets:
+				if !ok {
+					return t.TerminationMessage(errors.New("capture of " + strings.Join(devices, ",") + " stopped"))
+				}
+				if !started {
+					continue
+				}
+				ci := &capture.CaptureInfo{
+					CaptureLength:  int64(packet.ci.CaptureLength),
+					Length:         int64(packet.ci.Length),
+					InterfaceIndex: int64(packet.index),
+					InterfaceName:  devices[packet.index],
+				}
+				ci.SetLink(packet.link)
+				ci.SetTime(packet.ci.Timestamp)
 				err = addPacketClient.Send(&capture.PacketDescriptor{
-					Name: hostname,
+					Name: podName,
 					Packet: &capture.Packet{
-						Data: packet.Data(),
-						CaptureInfo: &capture.CaptureInfo{
-							Timestamp:      packet.Metadata().Timestamp.Unix(),
-							CaptureLength:  int64(packet.Metadata().CaptureLength),
-							Length:         int64(packet.Metadata().Length),
-							InterfaceIndex: int64(packet.Metadata().InterfaceIndex),
-						},
+						Data:        packet.data,
+						CaptureInfo: ci,
 					},
 				})
 				if err != nil {
@@ -137,6 +221,99 @@ It is meant to be run as a sidecar/ephemeral container in a pod but can be run s
 	},
 }
 
+// waitStart returns a channel closed when the proxy releases the agent, the packets are forwarded from then on.
+// The proxy start time is not compared to the packet timestamps, the clocks of the nodes may differ.
+// The agent starts immediately if the proxy cannot be waited for.
+func waitStart(ctx context.Context, cli capture.AgentServiceClient, pod *capture.Pod) <-chan struct{} {
+	start := make(chan struct{})
+	go func() {
+		defer close(start)
+		if _, err := cli.WaitStart(ctx, pod); err != nil {
+			log.Println("waiting for the capture start:", err)
+		}
+	}()
+	return start
+}
+
+// devicePacket is a packet captured on one of the agent devices
+type devicePacket struct {
+	data  []byte
+	ci    gopacket.CaptureInfo
+	index int
+	link  layers.LinkType
+}
+
+// mergePackets reads the packets of all the engines, the channel is closed
+// when every capture stopped. Packets are forwarded without being decoded.
+func mergePackets(sources []packetEngine) <-chan devicePacket {
+	packets := make(chan devicePacket)
+	var wg sync.WaitGroup
+	for i, e := range sources {
+		wg.Add(1)
+		go func(index int, e packetEngine) {
+			defer wg.Done()
+			for {
+				data, ci, err := e.ReadPacketData()
+				if err != nil {
+					if !errors.Is(err, io.EOF) {
+						log.Println(err)
+					}
+					return
+				}
+				packets <- devicePacket{data: data, ci: ci, index: index, link: e.LinkType()}
+			}
+		}(i, e)
+	}
+	go func() {
+		wg.Wait()
+		close(packets)
+	}()
+	return packets
+}
+
+// logEngineStatsChange reads the counters of the engines, the drops are logged when they changed since the last call
+func logEngineStatsChange(sources []packetEngine, devices []string, last []engineStats) []engineStats {
+	if last == nil {
+		last = make([]engineStats, len(sources))
+	}
+	for i, e := range sources {
+		s, err := e.Stats()
+		if err != nil {
+			continue
+		}
+		if s.Dropped != last[i].Dropped || s.IfDropped != last[i].IfDropped {
+			logStats(devices[i], s)
+		}
+		last[i] = s
+	}
+	return last
+}
+
+// agentStats sums the counters of the engines
+func agentStats(stats []engineStats) *capture.AgentStats {
+	total := &capture.AgentStats{}
+	for _, s := range stats {
+		total.Received += s.Received
+		total.Dropped += s.Dropped
+		total.IfDropped += s.IfDropped
+	}
+	return total
+}
+
+// logEngineStats logs the counters of all the engines
+func logEngineStats(sources []packetEngine, devices []string) {
+	for i, e := range sources {
+		if s, err := e.Stats(); err == nil {
+			logStats(devices[i], s)
+		}
+	}
+}
+
+func logStats(device string, s engineStats) {
+	log.Printf("%s: %d packets received, %d dropped by kernel, %d dropped by interface",
+		device, s.Received, s.Dropped, s.IfDropped)
+}
+
 func init() {
 	RootCmd.AddCommand(agentCmd)
 	initAgentFlags(agentCmd)
@@ -144,10 +321,18 @@ func init() {
 
 func initAgentFlags(cmd *cobra.Command) {
 	cmd.Flags().Int32VarP(&snapLen, "snaplen", "l", defaultSnapLen, "Capture snapshot len")
-	cmd.Flags().StringVarP(&device, "device", "d", "eth0", "Capture device")
+	cmd.Flags().StringVarP(&device, "device", "d", "eth0", "Capture devices, comma separated, or all for every non-loopback interface")
 	cmd.Flags().StringVarP(&proxyTarget, "target", "t", "", "Proxy server address")
 	cmd.Flags().StringVarP(&termMessagePath, "messagePath", "m", utils.DefaultKubePath, "Termination message path")
 	cmd.Flags().StringVarP(&filter, "filter", "f", "", "Capture filter")
 	cmd.Flags().BoolVar(&enableTermMessagePath, "togglemessagePath", true, "Toggle  message path")
 	cmd.Flags().IntVarP(&proxyPort, "port", "p", defaultTargetPort, "Proxy server port")
+	cmd.Flags().StringVar(&engine, "engine", "", "Capture engine, pcap or afpacket (default pcap, afpacket when built without cgo)")
+	cmd.Flags().IntVar(&ringSize, "ring-size", defaultRingSize, "Size in MB of the afpacket ring of each device")
+	cmd.Flags().DurationVar(&blockTimeout, "block-timeout", defaultBlockTimeout, "Timeout of the afpacket ring blocks")
+	cmd.Flags().StringVar(&session, "session", "", "Capture session of the proxy the packets are sent to")
+	cmd.Flags().StringVar(&podName, "pod", "", "Name of the captured pod (default hostname)")
+	cmd.Flags().StringVar(&podNamespace, "namespace", "", "Namespace of the captured pod")
+	cmd.Flags().StringVar(&nodeName, "node", "", "Node of the captured pod")
+	cmd.Flags().BoolVar(&waitForStart, "wait-start", false, "Discard the packets until the client starts the capture of every agent")
 }
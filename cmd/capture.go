@@ -0,0 +1,479 @@
+//go:build cli || all
+// +build cli all
+
+/*
+Copyright © 2023 Stephane Guillemot <gmtstephane@gmail.com>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	capture "github.com/gmtstephane/kpture/api/kpture"
+	"github.com/gmtstephane/kpture/pkg/dashboard"
+	"github.com/gmtstephane/kpture/pkg/k8s"
+	"github.com/gmtstephane/kpture/pkg/sink"
+	"github.com/google/gopacket"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// inFlightPackets is the number of packets received from the proxy waiting to be written.
+	inFlightPackets = 1024
+	// statsRefresh is the interval the capture statistics are read from the proxy
+	statsRefresh = 2 * time.Second
+	// statsTimeout is the timeout of the last read of the capture statistics and of the session end
+	statsTimeout = 2 * time.Second
+)
+
+// captureOpts are the settings of a capture shared by the cli commands
+type captureOpts struct {
+	filter   string
+	limits   sink.Limits
+	duration time.Duration
+	// podFilter returns the capture filter of a pod, overriding filter when not empty
+	podFilter func(pod corev1.Pod) string
+	// agentOpts and proxyOpts are the settings without command line flags, e.g from a profile
+	agentOpts []k8s.AgentOpt
+	proxyOpts []k8s.ProxyOpt
+	// newSink builds the sink the packets are written to
+	newSink func(pods []corev1.Pod, snaplen uint32) (sink.Sink, error)
+	// onStatus is called when the state of an agent changes
+	onStatus func(k8s.AgentStatus)
+	// onDrops is called with the packets of a pod dropped by its agent or by the proxy
+	onDrops func(pod string, drops int64)
+	// follow matches the pods starting during the capture, the pods are watched with the select options
+	follow     func(pod corev1.Pod) (bool, error)
+	selectOpts []k8s.SelectOpt
+}
+
+// capturePods captures the packets of the pods through a temporary or shared proxy until
+// the user or a stop condition ends the capture.
+// The sink is flushed and the temporary proxy torn down before returning the per-pod totals,
+// which are nil when the capture did not start.
+func capturePods(client *k8s.KubeClient, pods []corev1.Pod, o captureOpts) ([]sink.PodCount, error) {
+	kptureID := uuid.New().String()
+
+	opts := append([]k8s.AgentOpt{k8s.WithAgentUUID(kptureID), k8s.WithAgentSnapLen(-1)}, o.agentOpts...)
+	agentOpts := k8s.LoadAgentOpts(append(opts,
+		k8s.WithAgentCaptureFilter(o.filter),
+		k8s.WithAgentPodFilter(o.podFilter),
+		k8s.WithAgentStatusHandler(o.onStatus),
+	)...)
+	proxyOpts := k8s.LoadProxyOpts(append(o.proxyOpts, k8s.WithProxyUUID(kptureID))...)
+
+	writer, err := o.newSink(pods, uint32(agentOpts.SnapshotLen))
+	if err != nil {
+		return nil, err
+	}
+	var closeOnce sync.Once
+	closeWriter := func() {
+		closeOnce.Do(func() {
+			if errClose := writer.Close(); errClose != nil {
+				log.Println(errClose)
+			}
+		})
+	}
+	defer closeWriter()
+
+	// cleanup the proxy at the end, a shared proxy is kept for the next captures
+	var tearDownOnce sync.Once
+	cleanup := func() {
+		if !proxyOpts.Shared {
+			tearDownOnce.Do(func() { tearDown(client, kptureID) })
+		}
+	}
+	defer cleanup()
+
+	// or on interrupt, the capture is stopped and the writers are flushed
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	release := handleInterrupts(stop, cleanup)
+	defer func() {
+		// keep forcing the exit while the proxy is torn down
+		cleanup()
+		release()
+	}()
+
+	proxyName, ip, err := deployProxy(client, &proxyOpts)
+	if err != nil {
+		return nil, err
+	}
+	agentOpts = agentOpts.WithTargetIP(ip).WithTargetPort(int(proxyOpts.ServerPort))
+	if ctx.Err() != nil {
+		return nil, nil
+	}
+
+	log.Println("Forwarding Proxy")
+
+	readychan, stopchan := make(chan struct{}, 1), make(chan struct{}, 1)
+	forwarder, port, err := k8s.GetKubeForwarder(
+		client.RestConf,
+		fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/portforward", client.Namespace, proxyName),
+		readychan,
+		stopchan,
+		proxyOpts.ServerPort,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	//Port forward the proxy
+	err = k8s.PortForward(forwarder, readychan, agentOpts.SetupTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer close(stopchan)
+	if ctx.Err() != nil {
+		return nil, nil
+	}
+
+	// inject the debug containers
+	err = k8s.SetupEphemeralContainers(pods, client.Clientset.CoreV1().Pods(client.Namespace), agentOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.Dial(
+		fmt.Sprintf("%s:%d", "127.0.0.1", port),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	cli := capture.NewClientServiceClient(conn)
+
+	// the stream is closed when the capture duration is over,
+	// the calls are routed to the capture session by the proxy
+	captureCtx, cancel := captureContext(capture.WithSession(ctx, kptureID), o.duration)
+	defer cancel()
+
+	// Handle the stream
+	packets, err := cli.GetPackets(captureCtx, &capture.Empty{})
+	if err != nil {
+		return nil, stopReason(captureCtx, err)
+	}
+
+	// the pods whose agent did not register in the proxy are reported,
+	// with a synchronized start the agents wait for the registration of the others
+	if agentOpts.SyncStart {
+		waitAgents(captureCtx, cli, pods, agentOpts.SetupTimeout)
+		start, errStart := cli.Start(captureCtx, &capture.Empty{})
+		if errStart != nil {
+			return nil, stopReason(captureCtx, errStart)
+		}
+		log.Println("capture of every agent started at", time.Unix(0, start.GetStartTime()).Format(time.RFC3339Nano))
+	} else {
+		go waitAgents(captureCtx, cli, pods, agentOpts.SetupTimeout)
+	}
+
+	counter := sink.NewCounter(pods)
+
+	// the drops reported by the agents and the proxy are read during the capture and at its end
+	drops := func(stats *capture.StatsRsp) {
+		for _, agent := range stats.GetAgents() {
+			counter.SetDrops(agent.GetName(), int64(agent.Drops()))
+			if o.onDrops != nil {
+				o.onDrops(agent.GetName(), int64(agent.Drops()))
+			}
+		}
+	}
+	polled := make(chan struct{})
+	go func() {
+		pollStats(captureCtx, cli, statsRefresh, drops)
+		close(polled)
+	}()
+
+	// the sinks are updated by the capture loop when pods are added or agents restarted
+	updates := make(chan sinkUpdate)
+	update := func(u sinkUpdate) bool {
+		select {
+		case updates <- u:
+			return true
+		case <-captureCtx.Done():
+			return false
+		}
+	}
+
+	handler := client.Clientset.CoreV1().Pods(client.Namespace)
+	supervisor := k8s.NewSupervisor(handler, agentOpts, func(r k8s.AgentRestart) {
+		gap := sink.Gap{From: r.Lost, To: r.Restarted, Reason: r.Reason}
+		update(func(s sink.Sink) error { return sink.MarkGap(s, r.Pod, gap) })
+	}, func(pod string) {
+		// the pods which ended are done for the per-pod limits
+		update(func(s sink.Sink) error { return sink.EndPod(s, pod) })
+	})
+	supervisor.Track(pods)
+	supervised := make(chan struct{})
+	go func() {
+		supervisor.Run(captureCtx)
+		close(supervised)
+	}()
+
+	if o.follow != nil {
+		f := newFollower(pods, o.follow, update, handler, agentOpts, supervisor)
+		err = k8s.FollowPods(captureCtx, client.Clientset, client.Namespace, f.events(), o.selectOpts...)
+		if err != nil {
+			cancel()
+			<-supervised
+			return nil, stopReason(captureCtx, err)
+		}
+	}
+
+	log.Println("Kpture started, press Ctrl+C to exit")
+	errCapture := runCapture(captureCtx, cancel, packets, updates, sink.Limit(sink.Multi(writer, counter), o.limits, pods))
+
+	// the agents stop when the proxy is torn down, they must not be re-attached
+	cancel()
+	<-supervised
+	<-polled
+	// the last statistics are read before the session end stops the agents,
+	// the proxy exits once the agents stopped and its pod is deleted even if it did not answer
+	endCtx, cancelEnd := context.WithTimeout(capture.WithSession(context.Background(), kptureID), statsTimeout)
+	if stats, errStats := cli.GetStats(endCtx, &capture.Empty{}); errStats == nil {
+		drops(stats)
+	}
+	_, _ = cli.EndSession(endCtx, &capture.Empty{})
+	cancelEnd()
+
+	// the packets in flight are written, flush the writers before tearing down the proxy
+	closeWriter()
+	cleanup()
+
+	return counter.Counts(), errCapture
+}
+
+// deployProxy creates the proxy of the capture, a running shared proxy of the namespace is reused
+// when opts is shared. It returns the name and address of the proxy pod.
+func deployProxy(client *k8s.KubeClient, opts *k8s.ProxyOpts) (string, string, error) {
+	pods := client.Clientset.CoreV1().Pods(client.Namespace)
+	if opts.Shared {
+		pod, err := k8s.FindSharedProxy(pods)
+		if err != nil {
+			return "", "", err
+		}
+		if pod != nil {
+			log.Println("Reusing Proxy", pod.Name)
+			opts.ServerPort = k8s.ProxyPort(*pod)
+			return pod.Name, pod.Status.PodIP, nil
+		}
+	}
+
+	log.Println("Deploying Proxy")
+	ip, err := k8s.SetupProxy(pods, *opts)
+	if err != nil {
+		return "", "", errors.New("failed to setup proxy in namespace " + client.Namespace + " : " + err.Error())
+	}
+	return k8s.ProxyPodName(opts.UUID), ip, nil
+}
+
+// sinkUpdate changes the sinks of a running capture, it is run by the capture loop
+type sinkUpdate func(s sink.Sink) error
+
+// captureContext stops the capture after the duration, 0 means no duration limit.
+func captureContext(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
+
+// runCapture writes the packets of the stream to s until the stream ends.
+// The packets already received are written before returning, cancel is called
+// to close the stream when s stops the capture. The updates are applied to s between two packets.
+// It returns nil when the capture is stopped by the user or by a stop condition.
+func runCapture(
+	ctx context.Context,
+	cancel context.CancelFunc,
+	stream capture.ClientService_GetPacketsClient,
+	updates <-chan sinkUpdate,
+	s sink.Sink,
+) error {
+	packets := make(chan *capture.PacketDescriptor, inFlightPackets)
+	errRecv := make(chan error, 1)
+	go func() {
+		defer close(packets)
+		for {
+			p, err := stream.Recv()
+			if err != nil {
+				errRecv <- err
+				return
+			}
+			packets <- p
+		}
+	}()
+
+	var errWrite error
+loop:
+	for {
+		select {
+		case u := <-updates:
+			if err := u(s); err != nil {
+				if errors.Is(err, sink.ErrLimitReached) && errWrite == nil {
+					// every pod ended or reached its limits
+					errWrite = err
+					cancel()
+					continue
+				}
+				log.Println(err)
+			}
+		case p, ok := <-packets:
+			if !ok {
+				break loop
+			}
+			if errWrite != nil || skipPacket(p) {
+				continue
+			}
+			if errWrite = s.Write(p); errWrite != nil {
+				cancel()
+			}
+		}
+	}
+
+	err := <-errRecv
+	if errWrite != nil {
+		err = errWrite
+	}
+	return stopReason(ctx, err)
+}
+
+// waitAgents logs the pods whose agent did not register in the proxy before the timeout
+func waitAgents(ctx context.Context, cli capture.ClientServiceClient, pods []corev1.Pod, timeout time.Duration) {
+	names := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+	}
+	rsp, err := cli.WaitReady(ctx, &capture.WaitReadyReq{Pods: names, Timeout: int64(timeout)})
+	if err != nil {
+		return
+	}
+	if !rsp.GetReady() {
+		log.Println("agents not ready:", strings.Join(rsp.GetNotReady(), ", "))
+	}
+}
+
+// pollStats reads the capture statistics from the proxy every interval until ctx is done
+func pollStats(ctx context.Context, cli capture.ClientServiceClient, interval time.Duration, report func(*capture.StatsRsp)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		stats, err := cli.GetStats(ctx, &capture.Empty{})
+		if err != nil {
+			continue
+		}
+		report(stats)
+	}
+}
+
+// skipPacket filters the noise of the pod interfaces
+func skipPacket(p *capture.PacketDescriptor) bool {
+	gop := gopacket.NewPacket(p.GetPacket().GetData(), p.GetPacket().GetCaptureInfo().Link(), gopacket.Default)
+	return isArp(gop) || isicmpv6sol(gop)
+}
+
+// stopReason returns nil for the clean stops of a capture
+func stopReason(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, sink.ErrLimitReached):
+		log.Println("capture limit reached")
+		return nil
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		log.Println("capture duration reached")
+		return nil
+	case errors.Is(ctx.Err(), context.Canceled):
+		return nil
+	case errors.Is(err, io.EOF):
+		return errors.New("proxy closed the capture stream")
+	default:
+		return err
+	}
+}
+
+// handleInterrupts stops the capture on the first interrupt, a second one forces the exit.
+// The signals are released by the returned function.
+func handleInterrupts(stop context.CancelFunc, force func()) func() {
+	c := make(chan os.Signal, 2)
+	done := make(chan struct{})
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-c:
+		case <-done:
+			return
+		}
+		log.Println("")
+		log.Println("stopping kpture, press Ctrl+C again to force exit")
+		stop()
+		select {
+		case <-c:
+		case <-done:
+			return
+		}
+		force()
+		os.Exit(1)
+	}()
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
+}
+
+// dashboardRefresh is the refresh interval of the tui
+const dashboardRefresh = time.Second
+
+// startDashboard renders the live dashboard of the pods on the standard output,
+// log messages are shown under the table until the returned stop function is called.
+func startDashboard(pods []corev1.Pod) (*dashboard.Dashboard, func()) {
+	d := dashboard.New(pods)
+	log.SetOutput(d.Log())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx, os.Stdout, dashboardRefresh)
+		close(done)
+	}()
+	return d, func() {
+		cancel()
+		<-done
+		log.SetOutput(os.Stderr)
+	}
+}
+
+// printSummary prints the packets and bytes written for each pod, its capture gaps, its dropped packets
+// and if it was deleted during the capture
+func printSummary(w io.Writer, counts []sink.PodCount) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "POD\tPACKETS\tBYTES\tGAPS\tDROPS\tSTATUS")
+	for _, c := range counts {
+		status := "captured"
+		if c.Ended {
+			status = "ended"
+		}
+		drops := "-"
+		if c.HasDrops {
+			drops = fmt.Sprint(c.Drops)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t%s\n", c.Name, c.Packets, c.Bytes, c.Gaps, drops, status)
+	}
+	tw.Flush()
+}
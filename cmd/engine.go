@@ -0,0 +1,61 @@
+//go:build agent || all
+// +build agent all
+
+/*
+Copyright © 2023 Stephane Guillemot <gmtstephane@gmail.com>
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gmtstephane/kpture/pkg/k8s"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// packetEngine reads the packets of one device
+type packetEngine interface {
+	ReadPacketData() ([]byte, gopacket.CaptureInfo, error)
+	LinkType() layers.LinkType
+	// Stats returns the kernel counters since the capture started
+	Stats() (engineStats, error)
+	Close()
+}
+
+// engineStats are the packet counters of a capture engine
+type engineStats struct {
+	Received  uint64 // packets received by the filter
+	Dropped   uint64 // packets dropped because the buffer was full
+	IfDropped uint64 // packets dropped by the interface
+}
+
+// engineOpts are the options of a capture engine
+type engineOpts struct {
+	device       string
+	snapLen      int32
+	filter       string
+	ringSize     int           // afpacket ring size in megabytes
+	blockTimeout time.Duration // afpacket block timeout
+}
+
+// engines are the capture engines available in this build
+var engines = map[string]func(o engineOpts) (packetEngine, error){}
+
+// openEngine opens a capture engine on a device, an empty name selects pcap,
+// or afpacket in the builds without libpcap
+func openEngine(name string, o engineOpts) (packetEngine, error) {
+	if name == "" {
+		name = k8s.AgentEnginePcap
+		if _, ok := engines[name]; !ok {
+			name = k8s.AgentEngineAFPacket
+		}
+	}
+	open, ok := engines[name]
+	if !ok {
+		return nil, fmt.Errorf("capture engine %q is not available in this build", name)
+	}
+	return open(o)
+}
@@ -0,0 +1,128 @@
+//go:build (agent || all) && linux && cgo
+// +build agent all
+// +build linux
+// +build cgo
+
+/*
+Copyright © 2023 Stephane Guillemot <gmtstephane@gmail.com>
+*/
+
+package cmd
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gmtstephane/kpture/cmd/utils"
+	"github.com/gmtstephane/kpture/pkg/k8s"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/afpacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"golang.org/x/net/bpf"
+)
+
+const (
+	// afpacketSnapLen is the snapshot length used when the agent snapshot length is unlimited
+	afpacketSnapLen = 65535
+	// afpacketPollTimeout is how often a blocked read checks the engine was closed
+	afpacketPollTimeout = 200 * time.Millisecond
+)
+
+// afpacketEngine captures with a TPACKET_V3 AF_PACKET mmap ring
+type afpacketEngine struct {
+	*afpacket.TPacket
+	link layers.LinkType
+
+	// the ring is unmapped on close, reads hold the lock to not access it afterwards
+	mu     sync.Mutex
+	closed atomic.Bool
+}
+
+func init() {
+	engines[k8s.AgentEngineAFPacket] = openAFPacket
+}
+
+func openAFPacket(o engineOpts) (packetEngine, error) {
+	snapLen := int(o.snapLen)
+	if snapLen <= 0 {
+		snapLen = afpacketSnapLen
+	}
+	link, err := utils.InterfaceLinkType(o.device)
+	if err != nil {
+		return nil, err
+	}
+	frameSize, blockSize, numBlocks, err := utils.AFPacketRing(o.ringSize, snapLen, os.Getpagesize())
+	if err != nil {
+		return nil, err
+	}
+	// the returned value of the compiled filter also truncates the packets to the snapshot length
+	instructions, err := pcap.CompileBPFFilter(link, snapLen, o.filter)
+	if err != nil {
+		return nil, err
+	}
+	raw := make([]bpf.RawInstruction, 0, len(instructions))
+	for _, i := range instructions {
+		raw = append(raw, bpf.RawInstruction{Op: i.Code, Jt: i.Jt, Jf: i.Jf, K: i.K})
+	}
+
+	tp, err := afpacket.NewTPacket(
+		afpacket.OptInterface(o.device),
+		afpacket.OptFrameSize(frameSize),
+		afpacket.OptBlockSize(blockSize),
+		afpacket.OptNumBlocks(numBlocks),
+		afpacket.OptBlockTimeout(o.blockTimeout),
+		afpacket.OptPollTimeout(afpacketPollTimeout),
+		afpacket.TPacketVersion3,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err = tp.SetBPF(raw); err != nil {
+		tp.Close()
+		return nil, err
+	}
+	return &afpacketEngine{TPacket: tp, link: link}, nil
+}
+
+// ReadPacketData waits for the next packet, it returns io.EOF once the engine is closed
+func (e *afpacketEngine) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for {
+		if e.closed.Load() {
+			return nil, gopacket.CaptureInfo{}, io.EOF
+		}
+		data, ci, err := e.TPacket.ReadPacketData()
+		if !errors.Is(err, afpacket.ErrTimeout) {
+			return data, ci, err
+		}
+	}
+}
+
+// Close waits for the pending read before releasing the ring
+func (e *afpacketEngine) Close() {
+	e.closed.Store(true)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.TPacket.Close()
+}
+
+func (e *afpacketEngine) LinkType() layers.LinkType {
+	return e.link
+}
+
+func (e *afpacketEngine) Stats() (engineStats, error) {
+	_, s, err := e.TPacket.SocketStats()
+	if err != nil {
+		return engineStats{}, err
+	}
+	return engineStats{
+		Received: uint64(s.Packets()),
+		Dropped:  uint64(s.Drops()),
+	}, nil
+}
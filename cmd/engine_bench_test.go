@@ -0,0 +1,89 @@
+//go:build (agent || all) && linux && cgo
+// +build agent all
+// +build linux
+// +build cgo
+
+/*
+Copyright © 2023 Stephane Guillemot <gmtstephane@gmail.com>
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gmtstephane/kpture/pkg/k8s"
+)
+
+// benchmarkPort is the udp port of the traffic sent on the loopback during the benchmark
+const benchmarkPort = 40000
+
+// BenchmarkEngines compares the capture engines on udp traffic sent on the loopback,
+// it reports the cpu time of the capture per packet and the kernel drops.
+// Run as root: go test -tags agent -run '^$' -bench Engines ./cmd/
+func BenchmarkEngines(b *testing.B) {
+	if os.Geteuid() != 0 {
+		b.Skip("capturing needs root")
+	}
+	for _, name := range []string{k8s.AgentEnginePcap, k8s.AgentEngineAFPacket} {
+		b.Run(name, func(b *testing.B) {
+			benchmarkEngine(b, name)
+		})
+	}
+}
+
+func benchmarkEngine(b *testing.B, name string) {
+	e, err := openEngine(name, engineOpts{device: "lo", snapLen: 65535, filter: fmt.Sprintf("udp dst port %d", benchmarkPort)})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer e.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sendTraffic(ctx, b)
+
+	var before, after syscall.Rusage
+	if err = syscall.Getrusage(syscall.RUSAGE_SELF, &before); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err = e.ReadPacketData(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	if err = syscall.Getrusage(syscall.RUSAGE_SELF, &after); err != nil {
+		b.Fatal(err)
+	}
+
+	// the sender cpu time is included, it is the same for both engines
+	cpu := time.Duration(syscall.TimevalToNsec(after.Utime) - syscall.TimevalToNsec(before.Utime) +
+		syscall.TimevalToNsec(after.Stime) - syscall.TimevalToNsec(before.Stime))
+	b.ReportMetric(float64(cpu.Nanoseconds())/float64(b.N), "cpu-ns/packet")
+	if stats, errStats := e.Stats(); errStats == nil {
+		b.ReportMetric(float64(stats.Dropped), "drops")
+	}
+}
+
+// sendTraffic sends udp datagrams on the loopback until ctx is done
+func sendTraffic(ctx context.Context, b *testing.B) {
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: benchmarkPort})
+	if err != nil {
+		b.Error(err)
+		return
+	}
+	defer conn.Close()
+	payload := make([]byte, 512)
+	for ctx.Err() == nil {
+		// nothing listens on the port, the write errors of the icmp replies are ignored
+		_, _ = conn.Write(payload)
+	}
+}
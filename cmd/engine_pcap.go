@@ -0,0 +1,47 @@
+//go:build (agent || all) && cgo
+// +build agent all
+// +build cgo
+
+/*
+Copyright © 2023 Stephane Guillemot <gmtstephane@gmail.com>
+*/
+
+package cmd
+
+import (
+	"github.com/gmtstephane/kpture/pkg/k8s"
+	"github.com/google/gopacket/pcap"
+)
+
+// pcapEngine captures with libpcap
+type pcapEngine struct {
+	*pcap.Handle
+}
+
+func init() {
+	engines[k8s.AgentEnginePcap] = openPcap
+}
+
+func openPcap(o engineOpts) (packetEngine, error) {
+	handle, err := pcap.OpenLive(o.device, o.snapLen, false, -1)
+	if err != nil {
+		return nil, err
+	}
+	if err = handle.SetBPFFilter(o.filter); err != nil {
+		handle.Close()
+		return nil, err
+	}
+	return pcapEngine{handle}, nil
+}
+
+func (e pcapEngine) Stats() (engineStats, error) {
+	s, err := e.Handle.Stats()
+	if err != nil {
+		return engineStats{}, err
+	}
+	return engineStats{
+		Received:  uint64(s.PacketsReceived),
+		Dropped:   uint64(s.PacketsDropped),
+		IfDropped: uint64(s.PacketsIfDropped),
+	}, nil
+}
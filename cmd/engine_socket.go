@@ -0,0 +1,216 @@
+//go:build (agent || all) && linux && !cgo
+// +build agent all
+// +build linux
+// +build !cgo
+
+/*
+Copyright © 2023 Stephane Guillemot <gmtstephane@gmail.com>
+*/
+
+package cmd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/gmtstephane/kpture/cmd/utils"
+	pcapfilter "github.com/gmtstephane/kpture/pkg/filter"
+	"github.com/gmtstephane/kpture/pkg/k8s"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+// socketReadTimeout is how often a blocked read checks the engine was closed
+const socketReadTimeout = 200 * time.Millisecond
+
+// socketEngine captures with a raw AF_PACKET socket and a filter compiled in go,
+// it is the afpacket engine of the agents built without cgo.
+type socketEngine struct {
+	fd       int
+	link     layers.LinkType
+	buf      []byte
+	oob      []byte
+	loopback bool
+
+	// the socket is closed once the pending read returned
+	mu     sync.Mutex
+	closed atomic.Bool
+
+	statsMu sync.Mutex
+	stats   engineStats // the kernel counters are reset when read
+}
+
+func init() {
+	engines[k8s.AgentEngineAFPacket] = openSocket
+}
+
+func openSocket(o engineOpts) (packetEngine, error) {
+	snapLen := int(o.snapLen)
+	if snapLen <= 0 {
+		snapLen = pcapfilter.MaxSnapLen
+	}
+	iface, err := net.InterfaceByName(o.device)
+	if err != nil {
+		return nil, err
+	}
+	link, err := utils.InterfaceLinkType(o.device)
+	if err != nil {
+		return nil, err
+	}
+	program, err := pcapfilter.Compile(o.filter, link, snapLen)
+	if errors.Is(err, pcapfilter.ErrUnsupported) {
+		return nil, fmt.Errorf("%w, use the agent image with libpcap", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	raw, err := bpf.Assemble(program)
+	if err != nil {
+		return nil, err
+	}
+	instructions := make([]unix.SockFilter, len(raw))
+	for i, ins := range raw {
+		instructions[i] = unix.SockFilter{Code: ins.Op, Jt: ins.Jt, Jf: ins.Jf, K: ins.K}
+	}
+
+	// the socket receives no packet until it is bound, after the filter is attached
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	setup := []func() error{
+		func() error {
+			prog := &unix.SockFprog{Len: uint16(len(instructions)), Filter: &instructions[0]}
+			return unix.SetsockoptSockFprog(fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, prog)
+		},
+		func() error { return unix.SetsockoptInt(fd, unix.SOL_PACKET, unix.PACKET_AUXDATA, 1) },
+		func() error { return unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_TIMESTAMPNS, 1) },
+		func() error {
+			// raising the buffer over the system limit needs CAP_NET_ADMIN
+			size := o.ringSize * 1024 * 1024
+			if unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUFFORCE, size) == nil {
+				return nil
+			}
+			return unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF, size)
+		},
+		func() error {
+			tv := unix.NsecToTimeval(socketReadTimeout.Nanoseconds())
+			return unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv)
+		},
+		func() error {
+			return unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: htons(unix.ETH_P_ALL), Ifindex: iface.Index})
+		},
+	}
+	for _, f := range setup {
+		if err = f(); err != nil {
+			unix.Close(fd)
+			return nil, err
+		}
+	}
+	return &socketEngine{
+		fd:       fd,
+		link:     link,
+		buf:      make([]byte, snapLen),
+		oob:      make([]byte, unix.CmsgSpace(int(unsafe.Sizeof(unix.TpacketAuxdata{})))+unix.CmsgSpace(int(unsafe.Sizeof(unix.Timespec{})))),
+		loopback: iface.Flags&net.FlagLoopback != 0,
+	}, nil
+}
+
+// ReadPacketData waits for the next packet, it returns io.EOF once the engine is closed
+func (e *socketEngine) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for {
+		if e.closed.Load() {
+			return nil, gopacket.CaptureInfo{}, io.EOF
+		}
+		n, oobn, _, from, err := unix.Recvmsg(e.fd, e.buf, e.oob, unix.MSG_TRUNC)
+		if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			return nil, gopacket.CaptureInfo{}, err
+		}
+		// like libpcap, the loopback packets are only read once when they are received
+		if sll, ok := from.(*unix.SockaddrLinklayer); ok && e.loopback && sll.Pkttype == unix.PACKET_OUTGOING {
+			continue
+		}
+		data := make([]byte, n)
+		if n > len(e.buf) {
+			data = data[:len(e.buf)]
+		}
+		copy(data, e.buf)
+		ci := gopacket.CaptureInfo{CaptureLength: len(data), Length: n}
+		e.control(e.oob[:oobn], &ci)
+		if ci.Timestamp.IsZero() {
+			ci.Timestamp = time.Now()
+		}
+		return data, ci, nil
+	}
+}
+
+// control reads the original length and the timestamp of the packet
+func (e *socketEngine) control(oob []byte, ci *gopacket.CaptureInfo) {
+	messages, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return
+	}
+	for _, m := range messages {
+		switch {
+		case m.Header.Level == unix.SOL_PACKET && m.Header.Type == unix.PACKET_AUXDATA &&
+			len(m.Data) >= int(unsafe.Sizeof(unix.TpacketAuxdata{})):
+			aux := (*unix.TpacketAuxdata)(unsafe.Pointer(&m.Data[0]))
+			ci.Length = int(aux.Len)
+		case m.Header.Level == unix.SOL_SOCKET && m.Header.Type == unix.SCM_TIMESTAMPNS &&
+			len(m.Data) >= int(unsafe.Sizeof(unix.Timespec{})):
+			ts := (*unix.Timespec)(unsafe.Pointer(&m.Data[0]))
+			ci.Timestamp = time.Unix(ts.Unix())
+		}
+	}
+}
+
+func (e *socketEngine) LinkType() layers.LinkType {
+	return e.link
+}
+
+// Stats adds the kernel counters to the counters read before
+func (e *socketEngine) Stats() (engineStats, error) {
+	e.statsMu.Lock()
+	defer e.statsMu.Unlock()
+	if e.closed.Load() {
+		return e.stats, nil
+	}
+	s, err := unix.GetsockoptTpacketStats(e.fd, unix.SOL_PACKET, unix.PACKET_STATISTICS)
+	if err != nil {
+		return engineStats{}, err
+	}
+	e.stats.Received += uint64(s.Packets)
+	e.stats.Dropped += uint64(s.Drops)
+	return e.stats, nil
+}
+
+// Close waits for the pending read before closing the socket
+func (e *socketEngine) Close() {
+	e.closed.Store(true)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.statsMu.Lock()
+	defer e.statsMu.Unlock()
+	unix.Close(e.fd)
+}
+
+// htons converts a short to the network byte order
+func htons(v uint16) uint16 {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return *(*uint16)(unsafe.Pointer(&b[0]))
+}
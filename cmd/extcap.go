@@ -0,0 +1,239 @@
+//go:build cli || all
+// +build cli all
+
+/*
+Copyright © 2023 Stephane Guillemot <gmtstephane@gmail.com>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/gmtstephane/kpture/pkg/extcap"
+	pcapfilter "github.com/gmtstephane/kpture/pkg/filter"
+	"github.com/gmtstephane/kpture/pkg/k8s"
+	"github.com/gmtstephane/kpture/pkg/sink"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	extcapInterface = "kpture"
+	extcapHelp      = "https://github.com/gmtstephane/kpture"
+)
+
+var (
+	extcapInterfaces bool
+	extcapDLTs       bool
+	extcapConfig     bool
+	extcapCapture    bool
+	extcapVersion    string
+	extcapIface      string
+	extcapFifo       string
+	extcapFilter     string
+	extcapPods       string
+)
+
+var extcapCmd = &cobra.Command{
+	Use:   "extcap",
+	Short: "Wireshark extcap interface",
+	Long: `
+Implements the Wireshark extcap protocol so that kpture captures can be started from the Wireshark interface list.
+Link the kpture binary in the Wireshark personal extcap folder (Help > About Wireshark > Folders), kpture
+detects the extcap arguments and runs this command.`,
+	Hidden: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// wireshark shows the standard error to the user, keep it for errors
+		log.SetOutput(io.Discard)
+
+		switch {
+		case extcapInterfaces:
+			return extcap.WriteInterfaces(os.Stdout, extcapHelp, []extcap.Interface{
+				{Value: extcapInterface, Display: "Kubernetes pods (kpture)"},
+			})
+		case extcapIface != extcapInterface:
+			return errors.New("unknown extcap interface " + extcapIface)
+		case extcapDLTs:
+			// the capture is written as pcapng, each pod interface is described with its own link type.
+			// the interface dlt is used by wireshark to check the capture filters, which are compiled for ethernet
+			return extcap.WriteDLTs(os.Stdout, []extcap.DLT{{Number: 1, Name: "EN10MB", Display: "pcapng, link type of each pod interface"}})
+		case extcapConfig:
+			client, err := k8s.GetClient(namespace)
+			if err != nil {
+				return err
+			}
+			args, err := extcapArgs(client)
+			if err != nil {
+				return err
+			}
+			return extcap.WriteConfig(os.Stdout, args)
+		case extcapCapture:
+			return extcapRun()
+		default:
+			// filter validation, wireshark shows the error written to the standard output
+			if err := pcapfilter.Validate(extcapFilter); err != nil {
+				fmt.Println(err)
+			}
+			return nil
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(extcapCmd)
+	extcapCmd.Flags().BoolVar(&extcapInterfaces, "extcap-interfaces", false, "list the extcap interfaces")
+	extcapCmd.Flags().StringVar(&extcapVersion, "extcap-version", "", "wireshark version")
+	extcapCmd.Flags().StringVar(&extcapIface, "extcap-interface", "", "extcap interface")
+	extcapCmd.Flags().BoolVar(&extcapDLTs, "extcap-dlts", false, "list the link layer types of the interface")
+	extcapCmd.Flags().BoolVar(&extcapConfig, "extcap-config", false, "list the configuration options of the interface")
+	extcapCmd.Flags().BoolVar(&extcapCapture, "capture", false, "start the capture")
+	extcapCmd.Flags().StringVar(&extcapFifo, "fifo", "", "fifo the capture is written to")
+	extcapCmd.Flags().StringVar(&extcapFilter, "extcap-capture-filter", "", "capture filter")
+	extcapCmd.Flags().StringVar(&namespace, "namespace", "", "namespace of the pods")
+	extcapCmd.Flags().StringVar(&extcapPods, "pods", "", "comma separated namespace/pod list")
+	extcapCmd.Flags().BoolVar(&all, "all", false, "capture from all pods in the namespace")
+
+	// wireshark runs the extcap binary without the extcap subcommand
+	if isExtcapCall(os.Args[1:]) {
+		RootCmd.SetArgs(append([]string{extcapCmd.Name()}, os.Args[1:]...))
+	}
+}
+
+// isExtcapCall returns true when kpture is started by wireshark
+func isExtcapCall(args []string) bool {
+	if len(args) == 0 || args[0] == extcapCmd.Name() {
+		return false
+	}
+	for _, a := range args {
+		if strings.HasPrefix(a, "--extcap-interface") {
+			return true
+		}
+	}
+	return false
+}
+
+// extcapArgs lists the namespaces and their pods as capture options
+func extcapArgs(client *k8s.KubeClient) ([]extcap.Arg, error) {
+	namespaces, err := client.Clientset.CoreV1().Namespaces().List(context.Background(), v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	pods, err := client.Clientset.CoreV1().Pods("").List(context.Background(), v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	nsValues := []extcap.Value{}
+	for _, ns := range namespaces.Items {
+		nsValues = append(nsValues, extcap.Value{Value: ns.Name, Display: ns.Name, Default: ns.Name == client.Namespace})
+	}
+
+	// pods are grouped by namespace
+	byNamespace := map[string][]corev1.Pod{}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning {
+			byNamespace[pod.Namespace] = append(byNamespace[pod.Namespace], pod)
+		}
+	}
+	names := []string{}
+	for ns := range byNamespace {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+	podValues := []extcap.Value{}
+	for _, ns := range names {
+		podValues = append(podValues, extcap.Value{Value: ns, Display: ns, Disabled: true})
+		for _, pod := range byNamespace[ns] {
+			podValues = append(podValues, extcap.Value{Value: ns + "/" + pod.Name, Display: pod.Name, Parent: ns})
+		}
+	}
+
+	return []extcap.Arg{
+		{Call: "--namespace", Display: "Namespace", Type: extcap.ArgSelector, Values: nsValues},
+		{
+			Call: "--pods", Display: "Pods", Type: extcap.ArgMultiCheck, Values: podValues,
+			Tooltip: "Pods of the selected namespace to capture",
+		},
+		{Call: "--all", Display: "All pods", Type: extcap.ArgBoolFlag, Tooltip: "Capture from all pods in the namespace"},
+	}, nil
+}
+
+// extcapPodNames returns the names of the checked pods, they must be in the namespace
+func extcapPodNames(checked string, ns string) ([]string, error) {
+	names := []string{}
+	for _, v := range extcap.SplitMultiCheck(checked) {
+		podNs, name, found := strings.Cut(v, "/")
+		if !found {
+			// namespace nodes of the pod tree
+			continue
+		}
+		if podNs != ns {
+			return nil, errors.New("pod " + v + " is not in namespace " + ns)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// extcapRun captures the selected pods to the wireshark fifo
+func extcapRun() error {
+	if extcapFifo == "" {
+		return errors.New("missing --fifo")
+	}
+	if err := pcapfilter.Validate(extcapFilter); err != nil {
+		return err
+	}
+	client, err := k8s.GetClient(namespace)
+	if err != nil {
+		return err
+	}
+	if err = k8s.CheckEphemeralContainerSupport(client.Clientset.Discovery()); err != nil {
+		return err
+	}
+	names, err := extcapPodNames(extcapPods, client.Namespace)
+	if err != nil {
+		return err
+	}
+	pods, err := k8s.SelectPods(names, all, client.Clientset.CoreV1().Pods(client.Namespace))
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		return errors.New("no pod selected in namespace " + client.Namespace)
+	}
+	if err = k8s.CheckPodsContext(pods); err != nil {
+		return err
+	}
+
+	fifo, err := os.OpenFile(extcapFifo, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer fifo.Close()
+
+	_, err = capturePods(client, pods, captureOpts{
+		filter: extcapFilter,
+		newSink: func(pods []corev1.Pod, snaplen uint32) (sink.Sink, error) {
+			return sink.NewWriter(fifo, pods, sink.LoadOpts(
+				// a pcap file would drop the packets of the interfaces which are not ethernet
+				sink.WithFormat(sink.FormatPcapng),
+				sink.WithSnapLen(snaplen),
+				sink.WithFilter(extcapFilter),
+			))
+		},
+	})
+	// wireshark closed the fifo to stop the capture
+	if errors.Is(err, syscall.EPIPE) {
+		return nil
+	}
+	return err
+}
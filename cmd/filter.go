@@ -0,0 +1,90 @@
+//go:build cli || all
+// +build cli all
+
+/*
+Copyright © 2023 Stephane Guillemot <gmtstephane@gmail.com>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	pcapfilter "github.com/gmtstephane/kpture/pkg/filter"
+	"github.com/gmtstephane/kpture/pkg/k8s"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// podFilter is a capture filter applied to the pods matching a selection
+type podFilter struct {
+	selection string // pod name, glob, /regexp/ or kind/name
+	filter    string
+}
+
+// parsePodFilters parses and validates the selection=filter values of --pod-filter
+func parsePodFilters(values []string) ([]podFilter, error) {
+	filters := []podFilter{}
+	for _, v := range values {
+		selection, f, found := strings.Cut(v, "=")
+		if !found || selection == "" || strings.TrimSpace(f) == "" {
+			return nil, fmt.Errorf("invalid pod filter %q, expected selection=filter", v)
+		}
+		if err := pcapfilter.Validate(f); err != nil {
+			return nil, fmt.Errorf("pod filter %s: %w", selection, err)
+		}
+		filters = append(filters, podFilter{selection: selection, filter: f})
+	}
+	return filters, nil
+}
+
+// podFilterSet resolves the pod filters of the captured pods. The workloads are resolved
+// when the pods are selected or followed, the filters are then looked up by pod name.
+type podFilterSet struct {
+	filters  []podFilter
+	opts     []k8s.SelectOpt
+	mu       sync.Mutex
+	resolved map[string]string
+}
+
+func newPodFilterSet(filters []podFilter, opts ...k8s.SelectOpt) *podFilterSet {
+	return &podFilterSet{filters: filters, opts: opts, resolved: map[string]string{}}
+}
+
+// resolve records the filter of the first pod filter matching each pod,
+// an empty filter keeps the capture filter
+func (s *podFilterSet) resolve(pods ...corev1.Pod) {
+	if len(s.filters) == 0 {
+		return
+	}
+	for _, pod := range pods {
+		filter := ""
+		for _, f := range s.filters {
+			match, err := k8s.MatchPod(pod, []string{f.selection}, false, s.opts...)
+			if err != nil {
+				log.Println("pod filter " + f.selection + ": " + err.Error())
+				continue
+			}
+			if match {
+				filter = f.filter
+				break
+			}
+		}
+		s.mu.Lock()
+		s.resolved[pod.Name] = filter
+		s.mu.Unlock()
+	}
+}
+
+// lookup returns the function returning the resolved filter of a pod, nil without pod filters
+func (s *podFilterSet) lookup() func(pod corev1.Pod) string {
+	if len(s.filters) == 0 {
+		return nil
+	}
+	return func(pod corev1.Pod) string {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.resolved[pod.Name]
+	}
+}
@@ -0,0 +1,100 @@
+//go:build cli || all
+// +build cli all
+
+/*
+Copyright © 2023 Stephane Guillemot <gmtstephane@gmail.com>
+*/
+package cmd
+
+import (
+	"log"
+
+	"github.com/gmtstephane/kpture/pkg/k8s"
+	"github.com/gmtstephane/kpture/pkg/sink"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// follower attaches agents to the pods starting during a capture.
+// Its methods are called by the pod watcher goroutine.
+type follower struct {
+	match      func(pod corev1.Pod) (bool, error)
+	update     func(u sinkUpdate) bool
+	handler    k8s.KubeEphemeralHandler
+	agentOpts  k8s.AgentOpts
+	supervisor *k8s.Supervisor
+	captured   map[types.UID]bool
+}
+
+func newFollower(
+	pods []corev1.Pod,
+	match func(pod corev1.Pod) (bool, error),
+	update func(u sinkUpdate) bool,
+	handler k8s.KubeEphemeralHandler,
+	agentOpts k8s.AgentOpts,
+	supervisor *k8s.Supervisor,
+) *follower {
+	f := &follower{
+		match:      match,
+		update:     update,
+		handler:    handler,
+		agentOpts:  agentOpts,
+		supervisor: supervisor,
+		captured:   make(map[types.UID]bool, len(pods)),
+	}
+	for _, pod := range pods {
+		f.captured[pod.UID] = true
+	}
+	return f
+}
+
+func (f *follower) events() k8s.PodEvents {
+	return k8s.PodEvents{Running: f.running, Deleted: f.deleted}
+}
+
+// running injects an agent in a new pod matching the selection.
+// recreated pods keep the name of a captured pod, their agent is re-attached by the supervisor.
+func (f *follower) running(pod corev1.Pod) {
+	if f.captured[pod.UID] {
+		return
+	}
+	if f.supervisor.Supervised(pod) {
+		f.captured[pod.UID] = true
+		return
+	}
+	ok, err := f.match(pod)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if !ok {
+		return
+	}
+
+	// the sinks are ready for the pod before its agent sends packets
+	if !f.update(func(s sink.Sink) error { return sink.AddPod(s, pod) }) {
+		return
+	}
+	f.captured[pod.UID] = true
+
+	log.Println("following new pod " + pod.Name)
+	err = k8s.SetupEphemeralContainers([]corev1.Pod{pod}, f.handler, f.agentOpts)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	f.supervisor.Track([]corev1.Pod{pod})
+}
+
+// deleted marks a captured pod as ended
+func (f *follower) deleted(pod corev1.Pod) {
+	if !f.captured[pod.UID] {
+		return
+	}
+	delete(f.captured, pod.UID)
+	log.Println("pod " + pod.Name + " ended")
+	f.update(func(s sink.Sink) error { return sink.EndPod(s, pod.Name) })
+	if f.agentOpts.OnStatus != nil {
+		f.agentOpts.OnStatus(k8s.AgentStatus{Pod: pod.Name, State: k8s.AgentEnded})
+	}
+}
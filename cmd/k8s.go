@@ -7,42 +7,68 @@ Copyright © 2023 Stephane Guillemot <gmtstephane@gmail.com>
 package cmd
 
 import (
-	"context"
 	"errors"
-	"fmt"
-	"io"
 	"log"
 	"os"
-	"os/signal"
 	"path/filepath"
-	"syscall"
+	"strings"
 	"time"
 
-	capture "github.com/gmtstephane/kpture/api/kpture"
+	pcapfilter "github.com/gmtstephane/kpture/pkg/filter"
 	"github.com/gmtstephane/kpture/pkg/k8s"
+	"github.com/gmtstephane/kpture/pkg/profile"
+	"github.com/gmtstephane/kpture/pkg/sink"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
-	"github.com/google/gopacket/pcapgo"
-	"github.com/google/uuid"
 	"github.com/spf13/cobra"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const megabyte = 1000000 // tcpdump -C unit
+
 var packetsCmd = &cobra.Command{
-	Use:   "packets",
+	Use:   "packets [pod|glob|/regexp/|kind/name]...",
 	Short: "Capture packet from kubernetes pods",
 	Long: `
 Start a kubernetes packet kpture running these steps:
+- Select pods by name, glob, /regexp/ or workload (deployment/api, sts/db, ds/agent, job/migrate, svc/redis)
 - Inject ephemeral containers to target pods
-- Create temporary proxy pod
+- Create temporary proxy pod, or reuse the shared proxy of the namespace
 - Port forwarding proxy pod to local machine
 - Retrieve packet via proxy`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if !cmd.Flag("output").Changed && !cmd.Flag("raw").Changed {
-			return errors.New("must provide output and/or raw flag")
+		var p profile.Profile
+		if profilePath != "" {
+			var err error
+			if p, err = profile.Load(profilePath); err != nil {
+				return err
+			}
+			if args, err = applyProfile(cmd, p, args); err != nil {
+				return err
+			}
+		}
+
+		if !cmd.Flag("output").Changed && !cmd.Flag("raw").Changed && !tui {
+			return errors.New("must provide output, raw and/or tui flag")
+		}
+		if tui && raw {
+			return errors.New("tui cannot be used with raw output")
+		}
+
+		// every filter is checked before injecting the agents
+		if err := pcapfilter.Validate(capturefilter); err != nil {
+			return err
+		}
+		filters, err := parsePodFilters(podFilters)
+		if err != nil {
+			return err
+		}
+		if err = k8s.CheckInterfaces(interfaces); err != nil {
+			return err
+		}
+		if err = k8s.CheckEngine(captureEngine); err != nil {
+			return err
 		}
 
 		log.SetFlags(0)
@@ -58,97 +84,98 @@ Start a kubernetes packet kpture running these steps:
 		}
 
 		// Select pods based on cli args
-		pods, err := k8s.SelectPods(args, all, client.Clientset.CoreV1().Pods(client.Namespace))
+		workloads := k8s.NewWorkloadHandler(client.Clientset, client.Namespace)
+		selectOpts := []k8s.SelectOpt{
+			k8s.WithLabelSelector(labelSelector),
+			k8s.WithFieldSelector(fieldSelector),
+			k8s.WithWorkloadHandler(workloads),
+		}
+		pods, err := k8s.SelectPods(args, all, client.Clientset.CoreV1().Pods(client.Namespace), selectOpts...)
 		if err != nil {
 			return err
 		}
+		if len(pods) == 0 {
+			return errors.New("no pod selected in namespace " + client.Namespace + ", provide pod names, --all or --selector")
+		}
+
+		podFilters := newPodFilterSet(filters, k8s.WithWorkloadHandler(workloads))
+		podFilters.resolve(pods...)
 
 		// Check if pods are ready and necessary security context for traffic capture
 		if err = k8s.CheckPodsContext(pods); err != nil {
 			return err
 		}
 
-		kptureID := uuid.New().String()
-
-		agentOpts := k8s.LoadAgentOpts(k8s.WithAgentUUID(kptureID), k8s.WithAgentSnapLen(-1), k8s.WithAgentCaptureFilter(capturefilter))
-		proxyOpts := k8s.LoadProxyOpts(k8s.WithProxyUUID(kptureID))
-
-		writer, err := newpcapWriter(cmd, pods, uint32(agentOpts.SnapshotLen))
-		if err != nil {
+		limits := sink.Limits{Packets: packetCount, Bytes: maxBytes, PerPod: limitPerPod}
+		if err = limits.Validate(); err != nil {
 			return err
 		}
 
-		log.Println("Deploying Proxy")
-
-		// cleanup the proxy at the end
-		defer tearDown(client, kptureID)
-
-		ip, err := k8s.SetupProxy(client.Clientset.CoreV1().Pods(client.Namespace), proxyOpts)
-		if err != nil {
-			return errors.New("failed to setup proxy in namespace " + client.Namespace + " : " + err.Error())
-		}
-		agentOpts = agentOpts.WithTargetIP(ip).WithTargetPort(int(proxyOpts.ServerPort))
-
-		// or on interrupt
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-		go func() {
-			<-c
-			log.Println("")
-			tearDown(client, kptureID)
-			writer.cleanup()
-			os.Exit(1)
-		}()
-
-		log.Println("Forwarding Proxy")
-
-		readychan, stopchan := make(chan struct{}, 1), make(chan struct{}, 1)
-		forwarder, port, err := k8s.GetKubeForwarder(
-			client.RestConf,
-			fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/portforward", client.Namespace, "kpture-proxy-"+kptureID),
-			readychan,
-			stopchan,
-			proxyOpts.ServerPort,
-		)
-		if err != nil {
-			return err
+		o := captureOpts{
+			filter:    capturefilter,
+			limits:    limits,
+			duration:  duration,
+			podFilter: podFilters.lookup(),
+			agentOpts: p.AgentOpts(),
+			proxyOpts: p.ProxyOpts(),
 		}
-
-		//Port forward the proxy
-		err = k8s.PortForward(forwarder, readychan, agentOpts.SetupTimeout)
-		if err != nil {
-			return err
+		if len(interfaces) > 0 {
+			o.agentOpts = append(o.agentOpts, k8s.WithAgentDevice(strings.Join(interfaces, ",")))
 		}
-		defer close(stopchan)
-
-		// inject the debug containers
-		err = k8s.SetupEphemeralContainers(pods, client.Clientset.CoreV1().Pods(client.Namespace), agentOpts)
-		if err != nil {
-			return err
+		if captureEngine != "" {
+			o.agentOpts = append(o.agentOpts, k8s.WithAgentEngine(captureEngine))
 		}
-
-		conn, err := grpc.Dial(
-			fmt.Sprintf("%s:%d", "127.0.0.1", port),
-			grpc.WithTransportCredentials(insecure.NewCredentials()))
-		if err != nil {
-			return err
+		if agentImage != "" {
+			o.agentOpts = append(o.agentOpts, k8s.WithAgentImage(agentImage))
+		}
+		if agentRingSize > 0 {
+			o.agentOpts = append(o.agentOpts, k8s.WithAgentRingSize(agentRingSize))
+		}
+		if ringTimeout > 0 {
+			o.agentOpts = append(o.agentOpts, k8s.WithAgentBlockTimeout(ringTimeout))
+		}
+		if syncStart {
+			o.agentOpts = append(o.agentOpts, k8s.WithAgentSyncStart(true))
+		}
+		if reuseProxy {
+			o.proxyOpts = append(o.proxyOpts, k8s.WithProxyShared(true))
+		}
+		o.newSink = func(pods []corev1.Pod, snaplen uint32) (sink.Sink, error) {
+			return newSink(cmd, pods, snaplen, o.podFilter)
+		}
+		if follow {
+			o.selectOpts = selectOpts
+			o.follow = func(pod corev1.Pod) (bool, error) {
+				match, errMatch := k8s.MatchPod(pod, args, all, selectOpts...)
+				if match {
+					podFilters.resolve(pod)
+				}
+				return match, errMatch
+			}
+		}
+		if tui {
+			dash, stopDashboard := startDashboard(pods)
+			o.onStatus = dash.AgentStatus
+			o.onDrops = dash.SetDrops
+			o.newSink = func(pods []corev1.Pod, snaplen uint32) (sink.Sink, error) {
+				s, errSink := newSink(cmd, pods, snaplen, o.podFilter)
+				if errSink != nil {
+					return nil, errSink
+				}
+				return sink.Multi(s, dash), nil
+			}
+			defer stopDashboard()
 		}
-		defer conn.Close()
-
-		cli := capture.NewClientServiceClient(conn)
 
-		// Handle the stream
-		packets, err := cli.GetPackets(context.Background(), &capture.Empty{})
-		if err != nil {
+		counts, err := capturePods(client, pods, o)
+		if tui {
+			// the last dashboard frame shows the per-pod totals
 			return err
 		}
-
-		log.Println("Kpture started, press Ctrl+C to exit")
-		if errWriteCapture := writer.WriteCapture(packets); err != nil {
-			return errWriteCapture
+		if counts != nil {
+			printSummary(os.Stderr, counts)
 		}
-
-		return nil
+		return err
 	},
 
 	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
@@ -182,11 +209,33 @@ Start a kubernetes packet kpture running these steps:
 
 func init() {
 	RootCmd.AddCommand(packetsCmd)
+	packetsCmd.Flags().StringVarP(&profilePath, "profile", "c", "", "yaml capture profile, flags override the profile values")
 	packetsCmd.Flags().BoolVarP(&all, "all", "a", false, "Capture from all pods in the selected namespace")
 	packetsCmd.Flags().BoolVarP(&raw, "raw", "r", false, "Print raw packet to stdout (for tshark/wireshark)")
 	packetsCmd.Flags().StringVarP(&output, "output", "o", "random-kpture-id", "output folder")
+	packetsCmd.Flags().StringVarP(&labelSelector, "selector", "l", "", "select pods by label (e.g. app=nginx,tier!=db)")
+	packetsCmd.Flags().StringVar(&fieldSelector, "field-selector", "", "select pods by field (e.g. spec.nodeName=node1)")
 	packetsCmd.Flags().StringVarP(&capturefilter, "filter", "f", "", "capture filter")
+	packetsCmd.Flags().StringArrayVar(&podFilters, "pod-filter", nil, "capture filter of the pods matching a selection, replaces --filter (e.g. 'api-*=port 8080', repeatable)")
 	packetsCmd.Flags().BoolVarP(&split, "split", "s", true, "split pcap files per pod")
+	packetsCmd.Flags().StringVar(&format, "format", string(sink.FormatPcap), "output format (pcap|pcapng)")
+	packetsCmd.Flags().IntVarP(&maxFileSize, "max-size", "C", 0, "rotate output files after N megabytes (1,000,000 bytes)")
+	packetsCmd.Flags().IntVarP(&rotateSeconds, "rotate", "G", 0, "rotate output files every N seconds")
+	packetsCmd.Flags().IntVarP(&fileCount, "file-count", "W", 0, "number of rotated files to keep per output, the oldest is deleted")
+	packetsCmd.Flags().StringVar(&compress, "compress", "", "compress output files (gzip|zstd)")
+	packetsCmd.Flags().Int64Var(&packetCount, "count", 0, "stop after capturing N packets")
+	packetsCmd.Flags().Int64Var(&maxBytes, "max-bytes", 0, "stop after capturing N bytes")
+	packetsCmd.Flags().DurationVar(&duration, "duration", 0, "stop after the given duration (e.g. 30s, 5m)")
+	packetsCmd.Flags().StringSliceVar(&interfaces, "interfaces", nil, "pod interfaces to capture, all for every non-loopback interface, multus for the interfaces of the multus network-status annotation (default eth0)")
+	packetsCmd.Flags().StringVar(&captureEngine, "engine", "", "agent capture engine, pcap or afpacket (default pcap), afpacket still compiles the filters with libpcap (cgo) in the default agent image")
+	packetsCmd.Flags().StringVar(&agentImage, "agent-image", "", "agent container image, e.g. ghcr.io/gmtstephane/kpture:latest-nocgo (default ghcr.io/gmtstephane/kpture:latest)")
+	packetsCmd.Flags().IntVar(&agentRingSize, "ring-size", 0, "size in MB of the afpacket ring of each interface (default 64)")
+	packetsCmd.Flags().DurationVar(&ringTimeout, "block-timeout", 0, "timeout of the afpacket ring blocks (default 64ms)")
+	packetsCmd.Flags().BoolVar(&reuseProxy, "reuse-proxy", false, "reuse the shared proxy of the namespace, it is created and kept after the capture if not running")
+	packetsCmd.Flags().BoolVar(&syncStart, "sync-start", false, "wait for every agent and start the capture of all the pods at the same time")
+	packetsCmd.Flags().BoolVar(&follow, "follow", false, "capture the pods matching the selection that start during the capture")
+	packetsCmd.Flags().BoolVar(&tui, "tui", false, "show a live dashboard of the captured pods")
+	packetsCmd.Flags().BoolVar(&limitPerPod, "per-pod", false, "apply --count and --max-bytes to each pod")
 }
 
 func tearDown(client *k8s.KubeClient, id string) {
@@ -197,139 +246,57 @@ func tearDown(client *k8s.KubeClient, id string) {
 	}
 }
 
-// pcapWriter is a struct that handles the writing of the packets to the pcap file
-// each pod can have its own writer to a different file
-// the additionnalWriters are used to write to the same file as the podMapWriter or to stdout
-// TODO: refactor this in a lib as pkg
-type pcapWriter struct {
-	podMapWriter       map[string]*pcapgo.Writer
-	additionnalWriters []*pcapgo.Writer
-	files              []*os.File
-	snaplen            uint32
-}
-
-func (p *pcapWriter) cleanup() {
-	for _, file := range p.files {
-		if err := file.Close(); err != nil {
-			log.Println(err)
-		}
-	}
-}
-
-// WriteCapture writes the capture to the pcap file
-func (p *pcapWriter) WriteCapture(
-	stream capture.ClientService_GetPacketsClient,
-) error {
-	for {
-		pktStr, errReceive := stream.Recv()
-		if errReceive != nil {
-			return errReceive
-		}
-		gop := gopacket.NewPacket(pktStr.Packet.GetData(), layers.LayerTypeEthernet, gopacket.Default)
-		if isArp(gop) || isicmpv6sol(gop) {
-			continue
-		}
-
-		if p.podMapWriter != nil {
-			if w, ok := p.podMapWriter[pktStr.GetName()]; ok {
-				err := w.WritePacket(gopacket.CaptureInfo{
-					Timestamp:      time.Now(),
-					CaptureLength:  int(pktStr.Packet.GetCaptureInfo().GetCaptureLength()),
-					Length:         int(pktStr.Packet.GetCaptureInfo().GetLength()),
-					InterfaceIndex: int(pktStr.Packet.GetCaptureInfo().GetInterfaceIndex()),
-				}, pktStr.Packet.GetData())
-				if err != nil {
-					return err
-				}
-			}
-			for _, additionnal := range p.additionnalWriters {
-				err := additionnal.WritePacket(gopacket.CaptureInfo{
-					Timestamp:      time.Now(),
-					CaptureLength:  int(pktStr.Packet.GetCaptureInfo().GetCaptureLength()),
-					Length:         int(pktStr.Packet.GetCaptureInfo().GetLength()),
-					InterfaceIndex: int(pktStr.Packet.GetCaptureInfo().GetInterfaceIndex()),
-				}, pktStr.Packet.GetData())
-				if err != nil {
-					return err
-				}
-			}
-		}
+// newSink builds the sinks selected by the cli flags
+func newSink(cmd *cobra.Command, pods []corev1.Pod, snaplen uint32, podFilter func(corev1.Pod) string) (sink.Sink, error) {
+	f, err := sink.ParseFormat(format)
+	if err != nil {
+		return nil, err
 	}
-}
-
-func newpcapWriter(cmd *cobra.Command, pods []corev1.Pod, snaplen uint32) (*pcapWriter, error) {
-	pw := pcapWriter{
-		podMapWriter:       make(map[string]*pcapgo.Writer),
-		additionnalWriters: []*pcapgo.Writer{},
-		files:              []*os.File{},
-		snaplen:            snaplen,
+	c, err := sink.ParseCompression(compress)
+	if err != nil {
+		return nil, err
 	}
-
+	opts := sink.LoadOpts(
+		sink.WithFormat(f),
+		sink.WithCompression(c),
+		sink.WithSnapLen(snaplen),
+		sink.WithFilter(capturefilter),
+		sink.WithPodFilter(podFilter),
+		sink.WithRotation(sink.Rotation{
+			MaxSize:  int64(maxFileSize) * megabyte,
+			Interval: time.Duration(rotateSeconds) * time.Second,
+			Count:    fileCount,
+		}),
+	)
+
+	sinks := []sink.Sink{}
 	if cmd.Flag("output").Changed {
-		err := os.MkdirAll(output, os.ModePerm)
-		if err != nil {
-			return nil, err
-		}
-		if errAddFile := pw.addGlobalFile(filepath.Join(output, "kpture.pcap")); errAddFile != nil {
-			return nil, errAddFile
+		file, errFile := sink.NewFile(filepath.Join(output, "kpture"+f.Ext()), pods, opts)
+		if errFile != nil {
+			return nil, errFile
 		}
+		sinks = append(sinks, file)
 	}
 
 	if cmd.Flag("output").Changed && (split && len(pods) > 1) {
-		if err := pw.buildpodMap(pods); err != nil {
-			return nil, err
+		podFiles, errFiles := sink.NewPodFiles(output, pods, opts)
+		if errFiles != nil {
+			sink.Multi(sinks...).Close()
+			return nil, errFiles
 		}
+		sinks = append(sinks, podFiles)
 	}
 
 	if raw {
-		if err := pw.addGlobalWriter(os.Stdout); err != nil {
-			return nil, err
-		}
-	}
-
-	return &pw, nil
-}
-
-func (p *pcapWriter) addGlobalWriter(o io.Writer) error {
-	w := pcapgo.NewWriter(o)
-	err := w.WriteFileHeader(p.snaplen, layers.LinkTypeEthernet)
-	if err != nil {
-		return err
-	}
-	p.additionnalWriters = append(p.additionnalWriters, w)
-	return nil
-}
-
-func (p *pcapWriter) addGlobalFile(path string) error {
-	f, errOpenFile := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o666)
-	if errOpenFile != nil {
-		return errOpenFile
-	}
-	if erraddWriter := p.addGlobalWriter(f); erraddWriter != nil {
-		return erraddWriter
-	}
-	p.files = append(p.files, f)
-	return nil
-}
-
-func (p *pcapWriter) buildpodMap(pods []corev1.Pod) error {
-	for _, pod := range pods {
-		file := filepath.Join(output, pod.Name+".pcap")
-		podfile, errOpenPodFile := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o666)
-		if errOpenPodFile != nil {
-			return errOpenPodFile
+		stdout, errStdout := sink.NewStdout(pods, opts)
+		if errStdout != nil {
+			sink.Multi(sinks...).Close()
+			return nil, errStdout
 		}
-		podwriter := pcapgo.NewWriter(podfile)
-		err := podwriter.WriteFileHeader(p.snaplen, layers.LinkTypeEthernet)
-		if err != nil {
-			return err
-		}
-		p.podMapWriter[pod.Name] = podwriter
-
-		p.files = append(p.files, podfile)
+		sinks = append(sinks, stdout)
 	}
 
-	return nil
+	return sink.Multi(sinks...), nil
 }
 
 func isArp(packet gopacket.Packet) bool {
@@ -0,0 +1,106 @@
+//go:build cli || all
+// +build cli all
+
+/*
+Copyright © 2023 Stephane Guillemot <gmtstephane@gmail.com>
+*/
+package cmd
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gmtstephane/kpture/pkg/profile"
+	"github.com/spf13/cobra"
+)
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manage yaml capture profiles",
+}
+
+var profileValidateCmd = &cobra.Command{
+	Use:   "validate FILE...",
+	Short: "Check the schema and values of capture profiles",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		valid := true
+		for _, path := range args {
+			if _, err := profile.Load(path); err != nil {
+				cmd.PrintErrln(err)
+				valid = false
+				continue
+			}
+			cmd.Println(path + ": valid")
+		}
+		if !valid {
+			return errors.New("invalid profile")
+		}
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileValidateCmd)
+}
+
+// applyProfile sets the flags not given on the command line to the profile values.
+// The profile targets are captured when no pod is given in the arguments.
+func applyProfile(cmd *cobra.Command, p profile.Profile, args []string) ([]string, error) {
+	if p.Namespace != "" {
+		namespace = p.Namespace
+	}
+
+	values := map[string][]string{}
+	set := func(flag string, value string, isSet bool) {
+		if isSet {
+			values[flag] = append(values[flag], value)
+		}
+	}
+	set("all", "true", p.All)
+	set("selector", p.Selector, p.Selector != "")
+	set("field-selector", p.FieldSelector, p.FieldSelector != "")
+	set("follow", "true", p.Follow)
+	set("filter", p.Filter, p.Filter != "")
+	for _, t := range p.Targets {
+		for _, pod := range t.Pods {
+			set("pod-filter", pod+"="+t.Filter, t.Filter != "")
+		}
+	}
+	set("output", p.Output.Dir, p.Output.Dir != "")
+	set("format", p.Output.Format, p.Output.Format != "")
+	if p.Output.Split != nil {
+		set("split", strconv.FormatBool(*p.Output.Split), true)
+	}
+	set("raw", "true", p.Output.Raw)
+	set("compress", p.Output.Compress, p.Output.Compress != "")
+	set("max-size", strconv.Itoa(p.Rotation.MaxSize), p.Rotation.MaxSize > 0)
+	set("rotate", strconv.Itoa(int(p.Rotation.Interval/time.Second)), p.Rotation.Interval > 0)
+	set("file-count", strconv.Itoa(p.Rotation.Count), p.Rotation.Count > 0)
+	set("count", strconv.FormatInt(p.Stop.Count, 10), p.Stop.Count > 0)
+	set("max-bytes", strconv.FormatInt(p.Stop.Bytes, 10), p.Stop.Bytes > 0)
+	set("duration", p.Stop.Duration.String(), p.Stop.Duration > 0)
+	set("per-pod", "true", p.Stop.PerPod)
+
+	for flag, vs := range values {
+		// command line flags override the profile
+		if cmd.Flags().Changed(flag) {
+			continue
+		}
+		for _, v := range vs {
+			if err := cmd.Flags().Set(flag, v); err != nil {
+				return nil, errors.New("profile " + flag + ": " + err.Error())
+			}
+		}
+	}
+
+	if len(args) > 0 {
+		return args, nil
+	}
+	for _, t := range p.Targets {
+		args = append(args, t.Pods...)
+	}
+	return args, nil
+}
@@ -13,6 +13,7 @@ import (
 	"net"
 	"os"
 	"sync"
+	"time"
 
 	capture "github.com/gmtstephane/kpture/api/kpture"
 	"github.com/gmtstephane/kpture/cmd/utils"
@@ -28,6 +29,9 @@ import (
 var (
 	serverPort             int32
 	bufferSize             int
+	sharedProxy            bool
+	sessionTimeout         time.Duration
+	agentTimeout           time.Duration
 	pTermMessagePath       string
 	pEnableTermMessagePath bool
 )
@@ -36,14 +40,23 @@ var proxyCmd = &cobra.Command{
 	Use:   "proxy",
 	Short: "Start proxy server",
 	Long: `
-Kpture proxy is a gRPC server that receives packets from agents. It can then be queried by client to retreive them.`,
+Kpture proxy is a gRPC server that receives packets from agents. It can then be queried by client to retreive them.
+Each capture is a session, a shared proxy hosts the sessions of several captures and keeps running when they end.`,
 	RunE: func(c *cobra.Command, args []string) error {
 		t, err := utils.NewTerminationWriter(pEnableTermMessagePath, pTermMessagePath)
 		if err != nil {
 			return err
 		}
 
-		s := proxy.NewProxyServer(bufferSize, CleanUpExit)
+		cleanup := CleanUpExit
+		if sharedProxy {
+			cleanup = endSession
+		}
+		s := proxy.NewProxyServer(bufferSize, cleanup, proxy.WithAgentTimeout(agentTimeout))
+		// the agents of a client which left without ending its session are stopped
+		if sessionTimeout > 0 {
+			go s.ExpireSessions(context.Background(), sessionTimeout)
+		}
 
 		lis, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", serverPort))
 		if err != nil {
@@ -65,18 +78,22 @@ Kpture proxy is a gRPC server that receives packets from agents. It can then be
 const (
 	defaultProxyPort       = 10000
 	defaultProxyBufferSize = 1500
+	defaultSessionTimeout  = 5 * time.Minute
 )
 
 func init() {
 	RootCmd.AddCommand(proxyCmd)
 	proxyCmd.Flags().Int32VarP(&serverPort, "port", "p", defaultProxyPort, "Server port")
-	proxyCmd.Flags().IntVarP(&bufferSize, "size", "s", defaultProxyBufferSize, "Packet buffer size")
+	proxyCmd.Flags().IntVarP(&bufferSize, "size", "s", defaultProxyBufferSize, "Packet buffer size of each agent")
+	proxyCmd.Flags().BoolVar(&sharedProxy, "shared", false, "Host several capture sessions and keep running when they end")
+	proxyCmd.Flags().DurationVar(&sessionTimeout, "session-timeout", defaultSessionTimeout, "End the sessions without client for this duration and stop their agents, 0 keeps them")
+	proxyCmd.Flags().DurationVar(&agentTimeout, "agent-timeout", proxy.DefaultAgentTimeout, "Expire the agents without packet or heartbeat for this duration, 0 keeps them")
 	proxyCmd.Flags().StringVarP(&pTermMessagePath, "messagePath", "m", utils.DefaultKubePath, "Termination message path")
 	proxyCmd.Flags().BoolVarP(&pEnableTermMessagePath, "togglemessagePath", "t", true, "Toggle  message path")
 }
 
-// CleanUpExit is a function that will be called when the proxy is exiting
-// It will wait for all the goroutines to finish before exiting.
+// CleanUpExit is called when the capture session of a proxy which is not shared ends, the clients leaving do not stop the proxy.
+// It stops the agents and waits for their streams to finish before exiting.
 var CleanUpExit = func(wg *sync.WaitGroup, cancel context.CancelFunc) {
 	go func() {
 		wg.Wait()
@@ -84,3 +101,8 @@ var CleanUpExit = func(wg *sync.WaitGroup, cancel context.CancelFunc) {
 	}()
 	cancel()
 }
+
+// endSession is called when a session of a shared proxy ends, its agents are stopped and the proxy keeps running.
+func endSession(wg *sync.WaitGroup, cancel context.CancelFunc) {
+	cancel()
+}
@@ -5,6 +5,7 @@ package cmd
 
 import (
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -16,6 +17,28 @@ var (
 	all           bool
 	capturefilter string
 	split         bool
+	format        string
+	maxFileSize   int
+	rotateSeconds int
+	fileCount     int
+	compress      string
+	packetCount   int64
+	maxBytes      int64
+	duration      time.Duration
+	limitPerPod   bool
+	tui           bool
+	labelSelector string
+	fieldSelector string
+	follow        bool
+	podFilters    []string
+	profilePath   string
+	interfaces    []string
+	captureEngine string
+	agentImage    string
+	agentRingSize int
+	ringTimeout   time.Duration
+	reuseProxy    bool
+	syncStart     bool
 )
 
 // RootCmd represents the base command when called without any subcommands.
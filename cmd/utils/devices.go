@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"errors"
+	"net"
+	"strings"
+)
+
+// AllDevices selects every non-loopback interface which is up
+const AllDevices = "all"
+
+// Devices returns the devices of a comma separated selection, or the non-loopback
+// interfaces which are up when the selection is AllDevices.
+func Devices(selection string, interfaces []net.Interface) ([]string, error) {
+	devices := []string{}
+	if selection != AllDevices {
+		for _, d := range strings.Split(selection, ",") {
+			if d = strings.TrimSpace(d); d != "" {
+				devices = append(devices, d)
+			}
+		}
+	} else {
+		for _, i := range interfaces {
+			if i.Flags&net.FlagUp != 0 && i.Flags&net.FlagLoopback == 0 {
+				devices = append(devices, i.Name)
+			}
+		}
+	}
+	if len(devices) == 0 {
+		return nil, errors.New("no interface to capture in " + selection)
+	}
+	return devices, nil
+}
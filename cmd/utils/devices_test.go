@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDevices(t *testing.T) {
+	interfaces := []net.Interface{
+		{Name: "lo", Flags: net.FlagUp | net.FlagLoopback},
+		{Name: "eth0", Flags: net.FlagUp},
+		{Name: "net1", Flags: net.FlagUp | net.FlagMulticast},
+		{Name: "net2"},
+	}
+	devices, err := Devices(AllDevices, interfaces)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"eth0", "net1"}, devices)
+
+	devices, err = Devices("eth0, net2", interfaces)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"eth0", "net2"}, devices)
+
+	_, err = Devices(AllDevices, interfaces[:1])
+	assert.Error(t, err)
+	_, err = Devices(",", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+)
+
+// Linux hardware types of the network interfaces (ARPHRD_*).
+const (
+	arphrdEther    = 1
+	arphrdTunnel   = 768
+	arphrdTunnel6  = 769
+	arphrdLoopback = 772
+	arphrdSit      = 776
+	arphrdNone     = 65534
+)
+
+// LinkTypeOfHardware returns the link type of the packets read from a raw AF_PACKET socket
+// bound to an interface of the given hardware type.
+func LinkTypeOfHardware(hwType int) (layers.LinkType, bool) {
+	switch hwType {
+	case arphrdEther, arphrdLoopback:
+		return layers.LinkTypeEthernet, true
+	case arphrdNone, arphrdTunnel, arphrdTunnel6, arphrdSit:
+		// tun, wireguard and ip-in-ip interfaces have no link layer
+		return layers.LinkTypeRaw, true
+	default:
+		return 0, false
+	}
+}
+
+// InterfaceLinkType returns the link type of a network interface from its sysfs hardware type
+func InterfaceLinkType(device string) (layers.LinkType, error) {
+	b, err := os.ReadFile("/sys/class/net/" + device + "/type")
+	if err != nil {
+		return 0, err
+	}
+	hwType, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, err
+	}
+	link, ok := LinkTypeOfHardware(hwType)
+	if !ok {
+		return 0, &UnsupportedHardwareError{Device: device, Type: hwType}
+	}
+	return link, nil
+}
+
+// UnsupportedHardwareError is returned for the interfaces without known link type
+type UnsupportedHardwareError struct {
+	Device string
+	Type   int
+}
+
+func (e *UnsupportedHardwareError) Error() string {
+	return e.Device + ": unsupported hardware type " + strconv.Itoa(e.Type)
+}
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkTypeOfHardware(t *testing.T) {
+	tests := map[int]layers.LinkType{
+		arphrdEther:    layers.LinkTypeEthernet,
+		arphrdLoopback: layers.LinkTypeEthernet,
+		arphrdNone:     layers.LinkTypeRaw,
+		arphrdTunnel:   layers.LinkTypeRaw,
+	}
+	for hwType, expected := range tests {
+		link, ok := LinkTypeOfHardware(hwType)
+		assert.True(t, ok)
+		assert.Equal(t, expected, link)
+	}
+	_, ok := LinkTypeOfHardware(778)
+	assert.False(t, ok)
+}
+
+func TestInterfaceLinkType(t *testing.T) {
+	link, err := InterfaceLinkType("lo")
+	if err == nil {
+		assert.Equal(t, layers.LinkTypeEthernet, link)
+	}
+	_, err = InterfaceLinkType("kpture-missing0")
+	assert.Error(t, err)
+}
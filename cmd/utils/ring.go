@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ringBlockFrames is the number of frames per block of the AF_PACKET ring, the gopacket default
+const ringBlockFrames = 128
+
+// AFPacketRing returns the layout of an AF_PACKET mmap ring of sizeMB megabytes.
+// Frames hold a packet of snapLen bytes and are aligned on pages.
+func AFPacketRing(sizeMB int, snapLen int, pageSize int) (frameSize, blockSize, numBlocks int, err error) {
+	if snapLen <= 0 || pageSize <= 0 {
+		return 0, 0, 0, errors.New("invalid snapshot length or page size")
+	}
+	if snapLen < pageSize {
+		frameSize = pageSize / (pageSize / snapLen)
+	} else {
+		frameSize = (snapLen/pageSize + 1) * pageSize
+	}
+	blockSize = frameSize * ringBlockFrames
+	numBlocks = sizeMB * 1024 * 1024 / blockSize
+	if numBlocks == 0 {
+		return 0, 0, 0, errors.New("ring size of " + strconv.Itoa(sizeMB) + "MB is smaller than a block of " +
+			strconv.Itoa(blockSize) + " bytes")
+	}
+	return frameSize, blockSize, numBlocks, nil
+}
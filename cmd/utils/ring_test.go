@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAFPacketRing(t *testing.T) {
+	frame, block, blocks, err := AFPacketRing(64, 1500, 4096)
+	assert.NoError(t, err)
+	assert.Equal(t, 2048, frame)
+	assert.Equal(t, 2048*128, block)
+	assert.Equal(t, 256, blocks)
+
+	frame, _, blocks, err = AFPacketRing(64, 65535, 4096)
+	assert.NoError(t, err)
+	assert.Equal(t, 65536, frame)
+	assert.Equal(t, 8, blocks)
+
+	_, _, _, err = AFPacketRing(1, 65535, 4096)
+	assert.Error(t, err)
+	_, _, _, err = AFPacketRing(64, 0, 4096)
+	assert.Error(t, err)
+}
@@ -0,0 +1,18 @@
+package utils
+
+import "runtime/debug"
+
+// Version is the kpture version, set at build time with
+// -ldflags "-X github.com/gmtstephane/kpture/cmd/utils.Version=v1.0.0"
+var Version = ""
+
+// BuildVersion returns Version, the module version when kpture was installed with go install, or dev.
+func BuildVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildVersion(t *testing.T) {
+	defer func(v string) { Version = v }(Version)
+	Version = "v1.2.3"
+	assert.Equal(t, "v1.2.3", BuildVersion())
+	Version = ""
+	assert.NotEmpty(t, BuildVersion())
+}
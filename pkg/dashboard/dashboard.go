@@ -0,0 +1,259 @@
+// Package dashboard renders a live table of the captured pods in a terminal.
+package dashboard
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	capture "github.com/gmtstephane/kpture/api/kpture"
+	"github.com/gmtstephane/kpture/pkg/k8s"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// statePending is shown until the agent is injected
+	statePending k8s.AgentState = "pending"
+	// topProtocols is the number of protocols shown per pod
+	topProtocols = 3
+	// clearScreen moves the cursor home and clears the terminal
+	clearScreen = "\033[H\033[2J"
+)
+
+// podStats holds the live statistics of a pod
+type podStats struct {
+	name      string
+	state     k8s.AgentState
+	message   string
+	packets   int64
+	bytes     int64
+	drops     int64
+	hasDrops  bool
+	protocols map[string]int64
+
+	// values at the last tick, used to compute the rates
+	lastPackets int64
+	lastBytes   int64
+	pps         float64
+	bps         float64
+}
+
+// Dashboard is a sink that keeps per-pod traffic statistics and agent states.
+// It is safe to update it from several goroutines while it is rendered.
+type Dashboard struct {
+	mu      sync.Mutex
+	pods    map[string]*podStats
+	order   []string
+	message string
+	last    time.Time
+	now     func() time.Time
+}
+
+// New creates a dashboard listing the pods in order.
+func New(pods []v1.Pod) *Dashboard {
+	d := &Dashboard{pods: make(map[string]*podStats, len(pods)), now: time.Now}
+	d.last = d.now()
+	for _, pod := range pods {
+		d.add(pod.Name)
+	}
+	return d
+}
+
+func (d *Dashboard) add(name string) *podStats {
+	s := &podStats{name: name, state: statePending, protocols: map[string]int64{}}
+	d.pods[name] = s
+	d.order = append(d.order, name)
+	return s
+}
+
+func (d *Dashboard) get(name string) *podStats {
+	s, ok := d.pods[name]
+	if !ok {
+		s = d.add(name)
+	}
+	return s
+}
+
+func (d *Dashboard) Write(p *capture.PacketDescriptor) error {
+	proto := protocol(p.GetPacket().GetData(), p.GetPacket().GetCaptureInfo().Link())
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.get(p.GetName())
+	s.packets++
+	s.bytes += int64(len(p.GetPacket().GetData()))
+	s.protocols[proto]++
+	return nil
+}
+
+func (d *Dashboard) Close() error {
+	return nil
+}
+
+// AddPod lists a pod that started during the capture.
+func (d *Dashboard) AddPod(pod v1.Pod) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.get(pod.Name)
+	return nil
+}
+
+// AgentStatus updates the agent state of a pod, it can be used as an agent status handler.
+func (d *Dashboard) AgentStatus(status k8s.AgentStatus) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.get(status.Pod)
+	s.state = status.State
+	s.message = status.Message
+}
+
+// SetDrops sets the number of packets dropped for a pod
+func (d *Dashboard) SetDrops(pod string, drops int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.get(pod)
+	s.drops = drops
+	s.hasDrops = true
+}
+
+// Log returns a writer showing the last written line under the table, for the log package.
+func (d *Dashboard) Log() io.Writer {
+	return logWriter{d}
+}
+
+type logWriter struct {
+	d *Dashboard
+}
+
+func (l logWriter) Write(b []byte) (int, error) {
+	msg := strings.TrimSpace(string(b))
+	if msg != "" {
+		l.d.mu.Lock()
+		l.d.message = msg
+		l.d.mu.Unlock()
+	}
+	return len(b), nil
+}
+
+// tick computes the rates since the previous tick
+func (d *Dashboard) tick() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	elapsed := now.Sub(d.last).Seconds()
+	d.last = now
+	if elapsed <= 0 {
+		return
+	}
+	for _, s := range d.pods {
+		s.pps = float64(s.packets-s.lastPackets) / elapsed
+		s.bps = float64(s.bytes-s.lastBytes) / elapsed
+		s.lastPackets, s.lastBytes = s.packets, s.bytes
+	}
+}
+
+// Render writes the table of the pods
+func (d *Dashboard) Render(w io.Writer) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "POD\tAGENT\tPACKETS\tPKT/S\tBYTES\tBYTES/S\tDROPS\tPROTOCOLS")
+	for _, name := range d.order {
+		s := d.pods[name]
+		drops := "-"
+		if s.hasDrops {
+			drops = fmt.Sprint(s.drops)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%.0f\t%s\t%s\t%s\t%s\n",
+			s.name, s.state, s.packets, s.pps, humanBytes(float64(s.bytes)), humanBytes(s.bps)+"/s", drops, s.top())
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, name := range d.order {
+		if s := d.pods[name]; s.state == k8s.AgentFailed && s.message != "" {
+			fmt.Fprintf(w, "\n%s: %s", s.name, s.message)
+		}
+	}
+	if d.message != "" {
+		fmt.Fprintf(w, "\n%s\n", d.message)
+	}
+	return nil
+}
+
+// Run refreshes the dashboard on w every interval until ctx is done,
+// the last state is rendered before returning.
+func (d *Dashboard) Run(ctx context.Context, w io.Writer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		d.tick()
+		io.WriteString(w, clearScreen)
+		d.Render(w)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// top returns the most seen protocols of the pod with their share of packets
+func (s *podStats) top() string {
+	if s.packets == 0 {
+		return "-"
+	}
+	names := make([]string, 0, len(s.protocols))
+	for name := range s.protocols {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if s.protocols[names[i]] != s.protocols[names[j]] {
+			return s.protocols[names[i]] > s.protocols[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > topProtocols {
+		names = names[:topProtocols]
+	}
+	top := make([]string, 0, len(names))
+	for _, name := range names {
+		top = append(top, fmt.Sprintf("%s %d%%", name, s.protocols[name]*100/s.packets))
+	}
+	return strings.Join(top, ", ")
+}
+
+// protocol returns the name of the highest decoded layer of the packet
+func protocol(data []byte, link layers.LinkType) string {
+	p := gopacket.NewPacket(data, link, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	name := "unknown"
+	for _, l := range p.Layers() {
+		switch l.LayerType() {
+		case gopacket.LayerTypePayload, gopacket.LayerTypeDecodeFailure, gopacket.LayerTypeFragment:
+		default:
+			name = l.LayerType().String()
+		}
+	}
+	return name
+}
+
+// humanBytes formats a number of bytes with decimal units
+func humanBytes(b float64) string {
+	const unit = 1000
+	if b < unit {
+		return fmt.Sprintf("%.0fB", b)
+	}
+	exp := 0
+	for b >= unit*unit && exp < 3 {
+		b /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", b/unit, "kMGT"[exp])
+}
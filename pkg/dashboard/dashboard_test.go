@@ -0,0 +1,138 @@
+package dashboard
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	capture "github.com/gmtstephane/kpture/api/kpture"
+	"github.com/gmtstephane/kpture/pkg/k8s"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var testPods = []v1.Pod{
+	{ObjectMeta: metav1.ObjectMeta{Name: "pod1"}},
+	{ObjectMeta: metav1.ObjectMeta{Name: "pod2"}},
+}
+
+// testPacket returns an ethernet frame sent by pod with the given transport layer
+func testPacket(t *testing.T, pod string, transport gopacket.SerializableLayer) *capture.PacketDescriptor {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 2},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{Version: 4, TTL: 64, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	switch l := transport.(type) {
+	case *layers.TCP:
+		ip.Protocol = layers.IPProtocolTCP
+		assert.Nil(t, l.SetNetworkLayerForChecksum(ip))
+	case *layers.UDP:
+		ip.Protocol = layers.IPProtocolUDP
+		assert.Nil(t, l.SetNetworkLayerForChecksum(ip))
+	}
+	buf := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		eth, ip, transport)
+	assert.Nil(t, err)
+	return &capture.PacketDescriptor{Name: pod, Packet: &capture.Packet{Data: buf.Bytes()}}
+}
+
+func TestDashboardWrite(t *testing.T) {
+	d := New(testPods)
+	tcp := testPacket(t, "pod1", &layers.TCP{SrcPort: 1234, DstPort: 8080})
+	udp := testPacket(t, "pod1", &layers.UDP{SrcPort: 1234, DstPort: 9999})
+	for _, p := range []*capture.PacketDescriptor{tcp, tcp, tcp, udp} {
+		assert.Nil(t, d.Write(p))
+	}
+	assert.Nil(t, d.Write(testPacket(t, "pod3", &layers.UDP{SrcPort: 1, DstPort: 2})))
+	assert.Nil(t, d.Close())
+
+	s := d.pods["pod1"]
+	assert.Equal(t, int64(4), s.packets)
+	assert.Equal(t, int64(3*len(tcp.Packet.Data)+len(udp.Packet.Data)), s.bytes)
+	assert.Equal(t, "TCP 75%, UDP 25%", s.top())
+	assert.Equal(t, "-", d.pods["pod2"].top())
+	assert.Equal(t, []string{"pod1", "pod2", "pod3"}, d.order)
+}
+
+func TestDashboardTick(t *testing.T) {
+	now := time.Unix(1678000000, 0)
+	d := New(testPods)
+	d.now = func() time.Time { return now }
+	d.last = now
+
+	p := testPacket(t, "pod1", &layers.TCP{SrcPort: 1234, DstPort: 8080})
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, d.Write(p))
+	}
+	now = now.Add(2 * time.Second)
+	d.tick()
+	assert.Equal(t, float64(5), d.pods["pod1"].pps)
+	assert.Equal(t, float64(5*len(p.Packet.Data)), d.pods["pod1"].bps)
+
+	now = now.Add(time.Second)
+	d.tick()
+	assert.Equal(t, float64(0), d.pods["pod1"].pps)
+}
+
+func TestDashboardRender(t *testing.T) {
+	d := New(testPods)
+	d.AgentStatus(k8s.AgentStatus{Pod: "pod1", State: k8s.AgentRunning})
+	d.AgentStatus(k8s.AgentStatus{Pod: "pod2", State: k8s.AgentFailed, Message: "no such device"})
+	d.SetDrops("pod1", 3)
+	_, err := d.Log().Write([]byte("kpture started\n"))
+	assert.Nil(t, err)
+	assert.Nil(t, d.Write(testPacket(t, "pod1", &layers.UDP{SrcPort: 1234, DstPort: 53})))
+
+	b := &bytes.Buffer{}
+	assert.Nil(t, d.Render(b))
+	lines := strings.Split(b.String(), "\n")
+	assert.Equal(t, []string{"POD", "AGENT", "PACKETS", "PKT/S", "BYTES", "BYTES/S", "DROPS", "PROTOCOLS"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"pod1", "running", "1", "0", "60B", "0B/s", "3", "UDP", "100%"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"pod2", "failed", "0", "0", "0B", "0B/s", "-", "-"}, strings.Fields(lines[2]))
+	assert.Contains(t, b.String(), "pod2: no such device")
+	assert.Contains(t, b.String(), "kpture started")
+}
+
+func TestDashboardRun(t *testing.T) {
+	d := New(testPods)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b := &bytes.Buffer{}
+	d.Run(ctx, b, time.Second)
+	assert.True(t, strings.HasPrefix(b.String(), clearScreen+"POD"))
+}
+
+func Test_humanBytes(t *testing.T) {
+	assert.Equal(t, "999B", humanBytes(999))
+	assert.Equal(t, "1.5kB", humanBytes(1500))
+	assert.Equal(t, "2.0MB", humanBytes(2000000))
+	assert.Equal(t, "3.0GB", humanBytes(3e9))
+}
+
+func TestDashboardAddPod(t *testing.T) {
+	d := New(testPods)
+	assert.Nil(t, d.AddPod(v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod3"}}))
+	assert.Nil(t, d.AddPod(testPods[0]))
+	assert.Equal(t, []string{"pod1", "pod2", "pod3"}, d.order)
+	assert.Equal(t, k8s.AgentState("pending"), d.pods["pod3"].state)
+
+	d.AgentStatus(k8s.AgentStatus{Pod: "pod3", State: k8s.AgentEnded})
+	assert.Equal(t, k8s.AgentEnded, d.pods["pod3"].state)
+}
+
+func Test_protocol(t *testing.T) {
+	p := testPacket(t, "pod1", &layers.UDP{SrcPort: 1234, DstPort: 9999})
+	assert.Equal(t, "UDP", protocol(p.Packet.Data, layers.LinkTypeEthernet))
+	// tun and ip-in-ip interfaces capture raw ip packets
+	assert.Equal(t, "UDP", protocol(p.Packet.Data[14:], layers.LinkTypeRaw))
+	assert.NotEqual(t, "UDP", protocol(p.Packet.Data[14:], layers.LinkTypeEthernet))
+}
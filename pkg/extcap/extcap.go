@@ -0,0 +1,136 @@
+// Package extcap writes the Wireshark extcap protocol sentences.
+// See https://www.wireshark.org/docs/wsdg_html_chunked/ChCaptureExtcap.html
+package extcap
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Version of the extcap protocol implemented.
+const Version = "1.0"
+
+// Interface is a capture interface shown in the Wireshark interface list
+type Interface struct {
+	Value   string
+	Display string
+}
+
+// DLT is the link layer type of an interface
+type DLT struct {
+	Number  int
+	Name    string
+	Display string
+}
+
+// ArgType is the widget used by Wireshark to configure an argument
+type ArgType string
+
+// Argument types.
+const (
+	ArgString     ArgType = "string"
+	ArgBoolFlag   ArgType = "boolflag"
+	ArgSelector   ArgType = "selector"
+	ArgMultiCheck ArgType = "multicheck"
+)
+
+// Value is a choice of a selector or multicheck argument
+type Value struct {
+	Value   string
+	Display string
+	Parent  string // parent value in a multicheck tree
+	Default bool
+	// Disabled values are shown but cannot be checked
+	Disabled bool
+}
+
+// Arg is an option of the capture configuration dialog
+type Arg struct {
+	Call    string // command line flag, e.g --namespace
+	Display string
+	Tooltip string
+	Type    ArgType
+	Default string
+	Values  []Value
+}
+
+// WriteInterfaces writes the answer to --extcap-interfaces
+func WriteInterfaces(w io.Writer, help string, ifaces []Interface) error {
+	s := sentence("extcap", field("version", Version), field("help", help))
+	for _, i := range ifaces {
+		s += sentence("interface", field("value", i.Value), field("display", i.Display))
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+// WriteDLTs writes the answer to --extcap-dlts
+func WriteDLTs(w io.Writer, dlts []DLT) error {
+	s := ""
+	for _, d := range dlts {
+		s += sentence("dlt", field("number", fmt.Sprint(d.Number)), field("name", d.Name), field("display", d.Display))
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+// WriteConfig writes the answer to --extcap-config, arguments are numbered in order
+func WriteConfig(w io.Writer, args []Arg) error {
+	s := ""
+	for n, a := range args {
+		fields := []string{
+			field("number", fmt.Sprint(n)),
+			field("call", a.Call),
+			field("display", a.Display),
+			field("type", string(a.Type)),
+		}
+		if a.Tooltip != "" {
+			fields = append(fields, field("tooltip", a.Tooltip))
+		}
+		if a.Default != "" {
+			fields = append(fields, field("default", a.Default))
+		}
+		s += sentence("arg", fields...)
+		for _, v := range a.Values {
+			fields = []string{
+				field("arg", fmt.Sprint(n)),
+				field("value", v.Value),
+				field("display", v.Display),
+			}
+			if v.Parent != "" {
+				fields = append(fields, field("parent", v.Parent))
+			}
+			if v.Default {
+				fields = append(fields, field("default", "true"))
+			}
+			if v.Disabled {
+				fields = append(fields, field("enabled", "false"))
+			}
+			s += sentence("value", fields...)
+		}
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+// SplitMultiCheck returns the values checked in a multicheck argument
+func SplitMultiCheck(s string) []string {
+	values := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func sentence(name string, fields ...string) string {
+	return name + " " + strings.Join(fields, "") + "\n"
+}
+
+// field escapes the braces that would end the field early
+func field(key, value string) string {
+	r := strings.NewReplacer("{", "(", "}", ")")
+	return "{" + key + "=" + r.Replace(value) + "}"
+}
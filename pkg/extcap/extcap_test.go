@@ -0,0 +1,55 @@
+package extcap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteInterfaces(t *testing.T) {
+	b := &bytes.Buffer{}
+	err := WriteInterfaces(b, "https://help", []Interface{{Value: "kpture", Display: "Kubernetes pods"}})
+	assert.Nil(t, err)
+	assert.Equal(t,
+		"extcap {version=1.0}{help=https://help}\n"+
+			"interface {value=kpture}{display=Kubernetes pods}\n",
+		b.String())
+}
+
+func TestWriteDLTs(t *testing.T) {
+	b := &bytes.Buffer{}
+	err := WriteDLTs(b, []DLT{{Number: 1, Name: "EN10MB", Display: "Ethernet"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "dlt {number=1}{name=EN10MB}{display=Ethernet}\n", b.String())
+}
+
+func TestWriteConfig(t *testing.T) {
+	b := &bytes.Buffer{}
+	err := WriteConfig(b, []Arg{
+		{Call: "--namespace", Display: "Namespace", Type: ArgSelector, Values: []Value{
+			{Value: "default", Display: "default", Default: true},
+			{Value: "kube-system", Display: "kube-system"},
+		}},
+		{Call: "--pods", Display: "Pods", Type: ArgMultiCheck, Values: []Value{
+			{Value: "default", Display: "default", Disabled: true},
+			{Value: "default/api", Display: "api", Parent: "default"},
+		}},
+		{Call: "--all", Display: "All pods", Tooltip: "capture {all} pods", Type: ArgBoolFlag, Default: "false"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t,
+		"arg {number=0}{call=--namespace}{display=Namespace}{type=selector}\n"+
+			"value {arg=0}{value=default}{display=default}{default=true}\n"+
+			"value {arg=0}{value=kube-system}{display=kube-system}\n"+
+			"arg {number=1}{call=--pods}{display=Pods}{type=multicheck}\n"+
+			"value {arg=1}{value=default}{display=default}{enabled=false}\n"+
+			"value {arg=1}{value=default/api}{display=api}{parent=default}\n"+
+			"arg {number=2}{call=--all}{display=All pods}{type=boolflag}{tooltip=capture (all) pods}{default=false}\n",
+		b.String())
+}
+
+func TestSplitMultiCheck(t *testing.T) {
+	assert.Equal(t, []string{"default/api", "default/db"}, SplitMultiCheck("default/api, default/db,"))
+	assert.Equal(t, []string{}, SplitMultiCheck(""))
+}
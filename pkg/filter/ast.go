@@ -0,0 +1,83 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Node is a node of a parsed filter expression
+type Node interface {
+	String() string
+}
+
+// And matches packets matching both nodes
+type And struct {
+	Left, Right Node
+}
+
+// Or matches packets matching one of the nodes
+type Or struct {
+	Left, Right Node
+}
+
+// Not matches packets not matching the node
+type Not struct {
+	Node Node
+}
+
+// Primitive is a qualified filter primitive, e.g tcp src port 80.
+// A primitive without type matches a protocol, e.g tcp.
+type Primitive struct {
+	Proto string // ether, ip, ip6, arp, tcp, udp, sctp, icmp, icmp6, or empty for any protocol
+	Dir   string // src, dst, src and dst, src or dst or empty for any direction
+	Type  string // host, net, port, portrange or proto
+	Value string // normalized value: address, cidr, port number, port range or protocol number
+}
+
+// Compare is a comparison of packet data, e.g tcp[13] & 2 != 0, or of the packet length
+type Compare struct {
+	Proto   string // ether, ip, ip6, tcp, udp, sctp, icmp, icmp6 or len for the packet length
+	Offset  uint32 // offset in the protocol header
+	Size    int    // 1, 2 or 4 bytes
+	Mask    uint32
+	HasMask bool
+	Op      string // =, !=, <, >, <= or >=
+	Value   uint32
+}
+
+func (a And) String() string {
+	return "(" + a.Left.String() + " and " + a.Right.String() + ")"
+}
+
+func (o Or) String() string {
+	return "(" + o.Left.String() + " or " + o.Right.String() + ")"
+}
+
+func (n Not) String() string {
+	return "not " + n.Node.String()
+}
+
+func (p Primitive) String() string {
+	s := ""
+	for _, q := range []string{p.Proto, p.Dir, p.Type, p.Value} {
+		if q == "" {
+			continue
+		}
+		if s != "" {
+			s += " "
+		}
+		s += q
+	}
+	return s
+}
+
+func (c Compare) String() string {
+	s := c.Proto
+	if c.Proto != protoLen {
+		s = fmt.Sprintf("%s[%d:%d]", c.Proto, c.Offset, c.Size)
+	}
+	if c.HasMask {
+		s += " & " + strconv.FormatUint(uint64(c.Mask), 10)
+	}
+	return s + " " + c.Op + " " + strconv.FormatUint(uint64(c.Value), 10)
+}
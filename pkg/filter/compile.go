@@ -0,0 +1,561 @@
+package filter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/bpf"
+)
+
+// MaxSnapLen is the snapshot length used for the non positive snapshot lengths, like libpcap
+const MaxSnapLen = 262144
+
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeARP  = 0x0806
+	etherTypeIPv6 = 0x86dd
+
+	ipv6HeaderLen = 40
+)
+
+// lookupIP resolves the host names of the filters, replaced in tests
+var lookupIP = net.LookupIP
+
+// Compile compiles a filter expression into a classic BPF program for the packets of an
+// Ethernet or raw IP link, the accepted packets are truncated to snapLen bytes.
+//
+// The program matches the same packets as the program compiled by libpcap, except for the
+// tcp, udp and icmp6 headers found after IPv6 extension headers.
+func Compile(expr string, link layers.LinkType, snapLen int) ([]bpf.Instruction, error) {
+	n, err := Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	if snapLen <= 0 {
+		snapLen = MaxSnapLen
+	}
+	c := &compiler{link: link}
+	switch link {
+	case layers.LinkTypeEthernet:
+		c.nh = 14
+	case layers.LinkTypeRaw:
+		c.nh = 0
+	default:
+		return nil, fmt.Errorf("unsupported link type %s", link)
+	}
+	if n == nil {
+		return []bpf.Instruction{bpf.RetConstant{Val: uint32(snapLen)}}, nil
+	}
+
+	match, err := c.node(n)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", expr, err)
+	}
+	accept, reject := c.label(), c.label()
+	match(accept, reject)
+	c.place(accept)
+	c.emit(bpf.RetConstant{Val: uint32(snapLen)})
+	c.place(reject)
+	c.emit(bpf.RetConstant{Val: 0})
+	return c.resolve(), nil
+}
+
+// label is a position of the program, placed once the code before it is generated
+type label int
+
+// pred generates the code jumping to t when the packet matches, to f otherwise
+type pred func(t, f label)
+
+// instruction is an instruction of the program, the conditional jumps target labels
+type instruction struct {
+	ins    bpf.Instruction
+	cond   bpf.JumpTest
+	val    uint32
+	jt, jf label
+	jump   bool // conditional jump to jt or jf
+	goTo   bool // jump to jt
+}
+
+type compiler struct {
+	link   layers.LinkType
+	nh     uint32 // offset of the network header
+	prog   []instruction
+	labels []int
+}
+
+func (c *compiler) label() label {
+	c.labels = append(c.labels, -1)
+	return label(len(c.labels) - 1)
+}
+
+func (c *compiler) place(l label) {
+	c.labels[l] = len(c.prog)
+}
+
+func (c *compiler) emit(ins bpf.Instruction) {
+	c.prog = append(c.prog, instruction{ins: ins})
+}
+
+// resolve converts the labels into jump offsets.
+//
+// The conditional jumps skip at most 255 instructions, like libpcap the farther targets are
+// reached through an unconditional jump inserted after the conditional jump.
+func (c *compiler) resolve() []bpf.Instruction {
+	longTrue, longFalse := map[int]bool{}, map[int]bool{}
+	for {
+		// pos is the position of the instructions once the unconditional jumps are inserted
+		pos := make([]int, len(c.prog)+1)
+		for i := range c.prog {
+			pos[i+1] = pos[i] + 1
+			if longTrue[i] {
+				pos[i+1]++
+			}
+			if longFalse[i] {
+				pos[i+1]++
+			}
+		}
+		skip := func(from int, l label) int {
+			return pos[c.labels[l]] - from - 1
+		}
+
+		grown := false
+		for i, ins := range c.prog {
+			if !ins.jump {
+				continue
+			}
+			if !longTrue[i] && skip(pos[i], ins.jt) > 255 {
+				longTrue[i], grown = true, true
+			}
+			if !longFalse[i] && skip(pos[i], ins.jf) > 255 {
+				longFalse[i], grown = true, true
+			}
+		}
+		if grown {
+			// the inserted jumps move the targets of the other jumps
+			continue
+		}
+
+		out := make([]bpf.Instruction, 0, pos[len(c.prog)])
+		for i, ins := range c.prog {
+			switch {
+			case ins.goTo:
+				out = append(out, bpf.Jump{Skip: uint32(skip(pos[i], ins.jt))})
+			case ins.jump:
+				st, sf := skip(pos[i], ins.jt), skip(pos[i], ins.jf)
+				var far []label
+				if longTrue[i] {
+					st = len(far)
+					far = append(far, ins.jt)
+				}
+				if longFalse[i] {
+					sf = len(far)
+					far = append(far, ins.jf)
+				}
+				out = append(out, bpf.JumpIf{Cond: ins.cond, Val: ins.val, SkipTrue: uint8(st), SkipFalse: uint8(sf)})
+				for j, l := range far {
+					out = append(out, bpf.Jump{Skip: uint32(skip(pos[i]+1+j, l))})
+				}
+			default:
+				out = append(out, ins.ins)
+			}
+		}
+		return out
+	}
+}
+
+// always matches or never matches
+func (c *compiler) always(match bool) pred {
+	return func(t, f label) {
+		target := f
+		if match {
+			target = t
+		}
+		c.prog = append(c.prog, instruction{goTo: true, jt: target})
+	}
+}
+
+func (c *compiler) and(preds ...pred) pred {
+	return func(t, f label) {
+		for _, p := range preds[:len(preds)-1] {
+			next := c.label()
+			p(next, f)
+			c.place(next)
+		}
+		preds[len(preds)-1](t, f)
+	}
+}
+
+func (c *compiler) or(preds ...pred) pred {
+	return func(t, f label) {
+		for _, p := range preds[:len(preds)-1] {
+			next := c.label()
+			p(t, next)
+			c.place(next)
+		}
+		preds[len(preds)-1](t, f)
+	}
+}
+
+// load is a load of the packet data
+type load struct {
+	off       uint32
+	size      int
+	transport bool // off is relative to the ipv4 payload
+	length    bool // load the packet length
+}
+
+// test compares the masked data loaded from the packet with a value
+func (c *compiler) test(l load, mask uint32, op string, val uint32) pred {
+	return func(t, f label) {
+		switch {
+		case l.length:
+			c.emit(bpf.LoadExtension{Num: bpf.ExtLen})
+		case l.transport:
+			c.emit(bpf.LoadMemShift{Off: c.nh})
+			c.emit(bpf.LoadIndirect{Off: c.nh + l.off, Size: l.size})
+		default:
+			c.emit(bpf.LoadAbsolute{Off: l.off, Size: l.size})
+		}
+		if mask != 0 {
+			c.emit(bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: mask})
+		}
+		cond := bpf.JumpEqual
+		switch op {
+		case "!=":
+			t, f = f, t
+		case ">":
+			cond = bpf.JumpGreaterThan
+		case ">=":
+			cond = bpf.JumpGreaterOrEqual
+		case "<":
+			cond, t, f = bpf.JumpGreaterOrEqual, f, t
+		case "<=":
+			cond, t, f = bpf.JumpGreaterThan, f, t
+		}
+		c.prog = append(c.prog, instruction{jump: true, cond: cond, val: val, jt: t, jf: f})
+	}
+}
+
+// network loads data of the network header
+func (c *compiler) network(off uint32, size int) load {
+	return load{off: c.nh + off, size: size}
+}
+
+// etherType matches the protocol of the network header
+func (c *compiler) etherType(etherType uint32) pred {
+	if c.link == layers.LinkTypeEthernet {
+		return c.test(load{off: 12, size: 2}, 0, "=", etherType)
+	}
+	// raw links only carry ip packets, identified by their version
+	switch etherType {
+	case etherTypeIPv4:
+		return c.test(load{size: 1}, 0xf0, "=", 0x40)
+	case etherTypeIPv6:
+		return c.test(load{size: 1}, 0xf0, "=", 0x60)
+	default:
+		return c.always(false)
+	}
+}
+
+// ipProto matches the ipv4 packets of a protocol
+func (c *compiler) ipProto(proto uint32) pred {
+	return c.and(c.etherType(etherTypeIPv4), c.test(c.network(9, 1), 0, "=", proto))
+}
+
+// ip6Proto matches the ipv6 packets of a protocol
+func (c *compiler) ip6Proto(proto uint32) pred {
+	return c.and(c.etherType(etherTypeIPv6), c.test(c.network(6, 1), 0, "=", proto))
+}
+
+// firstFragment matches the ipv4 packets holding the transport header
+func (c *compiler) firstFragment() pred {
+	return c.test(c.network(6, 2), 0x1fff, "=", 0)
+}
+
+// direction matches the src field, the dst field or any of them
+func (c *compiler) direction(dir string, src, dst pred) pred {
+	switch dir {
+	case "src":
+		return src
+	case "dst":
+		return dst
+	case "src and dst":
+		return c.and(src, dst)
+	default:
+		return c.or(src, dst)
+	}
+}
+
+func (c *compiler) node(n Node) (pred, error) {
+	switch n := n.(type) {
+	case And:
+		l, r, err := c.pair(n.Left, n.Right)
+		if err != nil {
+			return nil, err
+		}
+		return c.and(l, r), nil
+	case Or:
+		l, r, err := c.pair(n.Left, n.Right)
+		if err != nil {
+			return nil, err
+		}
+		return c.or(l, r), nil
+	case Not:
+		p, err := c.node(n.Node)
+		if err != nil {
+			return nil, err
+		}
+		return func(t, f label) { p(f, t) }, nil
+	case Compare:
+		return c.compare(n), nil
+	case Primitive:
+		return c.primitive(n)
+	}
+	return nil, fmt.Errorf("unexpected %s", n)
+}
+
+func (c *compiler) pair(left, right Node) (pred, pred, error) {
+	l, err := c.node(left)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := c.node(right)
+	return l, r, err
+}
+
+func (c *compiler) compare(cmp Compare) pred {
+	mask := uint32(0)
+	if cmp.HasMask {
+		mask = cmp.Mask
+		if mask == 0 {
+			// the masked value is always 0
+			return c.always(compareValues(0, cmp.Op, cmp.Value))
+		}
+	}
+	test := func(l load) pred {
+		return c.test(l, mask, cmp.Op, cmp.Value)
+	}
+	switch cmp.Proto {
+	case protoLen:
+		return test(load{length: true})
+	case "ether":
+		return test(load{off: cmp.Offset, size: cmp.Size})
+	case "ip":
+		return c.and(c.etherType(etherTypeIPv4), test(c.network(cmp.Offset, cmp.Size)))
+	case "ip6":
+		return c.and(c.etherType(etherTypeIPv6), test(c.network(cmp.Offset, cmp.Size)))
+	case "arp":
+		return c.and(c.etherType(etherTypeARP), test(c.network(cmp.Offset, cmp.Size)))
+	case "icmp6":
+		return c.and(c.ip6Proto(uint32(ipProtocols["icmp6"])), test(c.network(ipv6HeaderLen+cmp.Offset, cmp.Size)))
+	default:
+		// like libpcap, the transport headers are read from ipv4 packets
+		return c.and(
+			c.ipProto(uint32(ipProtocols[cmp.Proto])),
+			c.firstFragment(),
+			test(load{off: cmp.Offset, size: cmp.Size, transport: true}),
+		)
+	}
+}
+
+// compareValues evaluates a comparison of constants
+func compareValues(a uint32, op string, b uint32) bool {
+	switch op {
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return a == b
+}
+
+func (c *compiler) primitive(p Primitive) (pred, error) {
+	switch p.Type {
+	case "":
+		return c.protocol(p.Proto), nil
+	case "proto":
+		n, _ := strconv.ParseUint(p.Value, 10, 32)
+		switch p.Proto {
+		case "ether":
+			return c.etherType(uint32(n)), nil
+		case "ip6":
+			return c.ip6Proto(uint32(n)), nil
+		case "ip":
+			return c.ipProto(uint32(n)), nil
+		default:
+			return c.or(c.ipProto(uint32(n)), c.ip6Proto(uint32(n))), nil
+		}
+	case "port", "portrange":
+		return c.port(p), nil
+	case "host":
+		if p.Proto == "ether" {
+			return c.etherHost(p)
+		}
+		return c.host(p)
+	case "net":
+		_, network, _ := net.ParseCIDR(p.Value)
+		return c.address(p, network.IP, network.Mask)
+	}
+	return nil, fmt.Errorf("unexpected %s", p)
+}
+
+// protocol matches a protocol alone, e.g tcp
+func (c *compiler) protocol(proto string) pred {
+	switch proto {
+	case "ip":
+		return c.etherType(etherTypeIPv4)
+	case "ip6":
+		return c.etherType(etherTypeIPv6)
+	case "arp":
+		return c.etherType(etherTypeARP)
+	case "icmp":
+		return c.ipProto(uint32(ipProtocols["icmp"]))
+	case "icmp6":
+		return c.ip6Proto(uint32(ipProtocols["icmp6"]))
+	case "tcp", "udp", "sctp":
+		n := uint32(ipProtocols[proto])
+		return c.or(c.ipProto(n), c.ip6Proto(n))
+	default:
+		return c.always(true)
+	}
+}
+
+// port matches the tcp, udp and sctp ports of the ipv4 and ipv6 packets
+func (c *compiler) port(p Primitive) pred {
+	protos := []string{"tcp", "udp", "sctp"}
+	if p.Proto != "" {
+		protos = []string{p.Proto}
+	}
+	start, end := p.Value, p.Value
+	if p.Type == "portrange" {
+		start, end, _ = strings.Cut(p.Value, "-")
+	}
+	from, _ := strconv.ParseUint(start, 10, 16)
+	to, _ := strconv.ParseUint(end, 10, 16)
+	match := func(l load) pred {
+		if from == to {
+			return c.test(l, 0, "=", uint32(from))
+		}
+		return c.and(c.test(l, 0, ">=", uint32(from)), c.test(l, 0, "<=", uint32(to)))
+	}
+
+	var v4, v6 []pred
+	for _, proto := range protos {
+		n := uint32(ipProtocols[proto])
+		v4 = append(v4, c.test(c.network(9, 1), 0, "=", n))
+		v6 = append(v6, c.test(c.network(6, 1), 0, "=", n))
+	}
+	ports4 := c.direction(p.Dir,
+		match(load{off: 0, size: 2, transport: true}),
+		match(load{off: 2, size: 2, transport: true}))
+	ports6 := c.direction(p.Dir,
+		match(c.network(ipv6HeaderLen, 2)),
+		match(c.network(ipv6HeaderLen+2, 2)))
+	return c.or(
+		c.and(c.etherType(etherTypeIPv4), c.or(v4...), c.firstFragment(), ports4),
+		c.and(c.etherType(etherTypeIPv6), c.or(v6...), ports6),
+	)
+}
+
+// etherHost matches the source or destination mac address
+func (c *compiler) etherHost(p Primitive) (pred, error) {
+	if c.link != layers.LinkTypeEthernet {
+		return nil, fmt.Errorf("%q needs an ethernet link", p.String())
+	}
+	mac, _ := net.ParseMAC(p.Value)
+	match := func(off uint32) pred {
+		return c.and(
+			c.test(load{off: off + 2, size: 4}, 0, "=", binary.BigEndian.Uint32(mac[2:])),
+			c.test(load{off: off, size: 2}, 0, "=", uint32(binary.BigEndian.Uint16(mac))),
+		)
+	}
+	return c.direction(p.Dir, match(6), match(0)), nil
+}
+
+// host matches an address or the addresses of a host name
+func (c *compiler) host(p Primitive) (pred, error) {
+	ips := []net.IP{net.ParseIP(p.Value)}
+	if ips[0] == nil {
+		resolved, err := lookupIP(p.Value)
+		if err != nil {
+			return nil, fmt.Errorf("unknown host %q", p.Value)
+		}
+		ips = ips[:0]
+		for _, ip := range resolved {
+			// ip and arp hosts only match the ipv4 addresses, ip6 hosts the ipv6 addresses
+			if (ip.To4() != nil) == (p.Proto != "ip6") || p.Proto == "" {
+				ips = append(ips, ip)
+			}
+		}
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("unknown host %q", p.Value)
+		}
+	}
+	preds := make([]pred, 0, len(ips))
+	for _, ip := range ips {
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			bits = 8 * net.IPv4len
+		}
+		match, err := c.address(p, ip, net.CIDRMask(bits, bits))
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, match)
+	}
+	return c.or(preds...), nil
+}
+
+// address matches the masked source or destination address of the ipv4, arp or ipv6 packets
+func (c *compiler) address(p Primitive, ip net.IP, mask net.IPMask) (pred, error) {
+	match := func(off uint32, ip net.IP, mask net.IPMask) pred {
+		var words []pred
+		for i := 0; i < len(ip); i += 4 {
+			m := binary.BigEndian.Uint32(mask[i:])
+			if m == 0 {
+				continue
+			}
+			if m == 0xffffffff {
+				m = 0
+			}
+			words = append(words, c.test(c.network(off+uint32(i), 4), m, "=", binary.BigEndian.Uint32(ip[i:])))
+		}
+		if len(words) == 0 {
+			return c.always(true)
+		}
+		return c.and(words...)
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		if len(mask) == net.IPv6len {
+			mask = mask[12:]
+		}
+		if p.Proto == "ip6" {
+			return nil, fmt.Errorf("%q: ip6 needs an ipv6 address", p.String())
+		}
+		ipv4 := c.and(c.etherType(etherTypeIPv4), c.direction(p.Dir, match(12, ip4, mask), match(16, ip4, mask)))
+		arp := c.and(c.etherType(etherTypeARP), c.direction(p.Dir, match(14, ip4, mask), match(24, ip4, mask)))
+		switch p.Proto {
+		case "ip":
+			return ipv4, nil
+		case "arp":
+			return arp, nil
+		default:
+			return c.or(ipv4, arp), nil
+		}
+	}
+	if p.Proto != "" && p.Proto != "ip6" {
+		return nil, fmt.Errorf("%q: %s needs an ipv4 address", p.String(), p.Proto)
+	}
+	return c.and(c.etherType(etherTypeIPv6), c.direction(p.Dir, match(8, ip, mask), match(24, ip, mask))), nil
+}
@@ -0,0 +1,65 @@
+//go:build cgo
+// +build cgo
+
+package filter
+
+import (
+	"testing"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/bpf"
+)
+
+// libpcapMatches runs the program compiled by libpcap on the packet
+func libpcapMatches(t *testing.T, expr string, packet []byte) bool {
+	t.Helper()
+	compiled, err := pcap.CompileBPFFilter(layers.LinkTypeEthernet, MaxSnapLen, expr)
+	require.NoError(t, err, expr)
+	raw := make([]bpf.RawInstruction, len(compiled))
+	for i, ins := range compiled {
+		raw[i] = bpf.RawInstruction{Op: ins.Code, Jt: ins.Jt, Jf: ins.Jf, K: ins.K}
+	}
+	program, _ := bpf.Disassemble(raw)
+	vm, err := bpf.NewVM(program)
+	require.NoError(t, err, expr)
+	n, err := vm.Run(packet)
+	require.NoError(t, err, expr)
+	return n > 0
+}
+
+func TestCompileLibpcap(t *testing.T) {
+	fragmented := tcp4("10.0.0.1", "10.0.1.5", 43210, 8080)
+	fragmented[0].(*layers.IPv4).FragOffset = 100
+	packets := map[string][]byte{
+		"web":        testPacket(t, layers.LinkTypeEthernet, tcp4("10.0.0.1", "10.0.1.5", 43210, 8080)...),
+		"webSyn":     testPacket(t, layers.LinkTypeEthernet, tcp4("10.0.0.1", "10.0.1.5", 43210, 8080, syn)...),
+		"dns6":       testPacket(t, layers.LinkTypeEthernet, udp6("fd00::1", "fd00::53", 5353, 53)...),
+		"arp":        testPacket(t, layers.LinkTypeEthernet, arp("10.0.0.1", "10.0.0.254")...),
+		"sctp":       testPacket(t, layers.LinkTypeEthernet, sctp4("10.0.0.1", "10.0.1.5", 3868, 3868)...),
+		"fragmented": testPacket(t, layers.LinkTypeEthernet, fragmented...),
+	}
+	// the programs compiled without libpcap match the same packets as libpcap
+	for _, expr := range []string{
+		"tcp", "udp", "sctp", "ip", "ip6", "arp", "icmp",
+		"port 8080", "port 53", "port 3868", "tcp port 3868", "sctp port 3868", "src port 8080",
+		"src or dst port 8080", "src and dst port 3868", "dst port 8080 or 443",
+		"portrange 8000-8100", "udp dst portrange 50-60",
+		"host 10.0.1.5", "host 10.0.0.1", "ip host 10.0.0.1", "src host 10.0.1.5", "src and dst host 10.0.0.1",
+		"host fd00::53", "ip6 src host fd00::1",
+		"net 10.0.1.0/24", "dst net 10.0", "net 10.0.0.0 mask 255.255.255.0", "net fd00::/16",
+		"ether src host 02:42:ac:11:00:02", "ether dst host 02:42:ac:11:00:02",
+		"ether proto \\arp", "ip proto \\tcp", "ip6 proto \\udp", "proto 6", "proto 17",
+		"tcp[tcpflags] & tcp-syn != 0", "tcp[13] & 2 = 0", "ip[9] = 6", "tcp[2:2] > 8000 and tcp[2:2] <= 8080",
+		"greater 64", "less 64", "len = 60",
+		"not port 8080", "tcp and not (port 22 or port 8080)", "udp or arp",
+		"port 1 or port 2 or port 3 or port 4 or port 5 or port 6 or port 7 or port 8 or port 9 or port 10 or " +
+			"port 11 or port 12 or port 13 or port 14 or port 15 or port 16 or port 17 or port 18 or port 8080",
+	} {
+		for name, packet := range packets {
+			assert.Equal(t, libpcapMatches(t, expr, packet), matches(t, expr, layers.LinkTypeEthernet, packet), "%q on %s", expr, name)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/bpf"
+)
+
+var (
+	clientMAC = net.HardwareAddr{0x02, 0x42, 0xac, 0x11, 0x00, 0x02}
+	serverMAC = net.HardwareAddr{0x02, 0x42, 0xac, 0x11, 0x00, 0x03}
+)
+
+// testPacket serializes a packet of the link type
+func testPacket(t *testing.T, link layers.LinkType, l ...gopacket.SerializableLayer) []byte {
+	t.Helper()
+	var ether layers.EthernetType
+	for _, layer := range l {
+		switch layer := layer.(type) {
+		case *layers.IPv4:
+			ether = layers.EthernetTypeIPv4
+		case *layers.IPv6:
+			ether = layers.EthernetTypeIPv6
+		case *layers.ARP:
+			ether = layers.EthernetTypeARP
+		case *layers.TCP:
+			_ = layer.SetNetworkLayerForChecksum(l[0].(gopacket.NetworkLayer))
+		case *layers.UDP:
+			_ = layer.SetNetworkLayerForChecksum(l[0].(gopacket.NetworkLayer))
+		}
+	}
+	if link == layers.LinkTypeEthernet {
+		l = append([]gopacket.SerializableLayer{&layers.Ethernet{SrcMAC: clientMAC, DstMAC: serverMAC, EthernetType: ether}}, l...)
+	}
+	buf := gopacket.NewSerializeBuffer()
+	require.NoError(t, gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, l...))
+	return buf.Bytes()
+}
+
+func tcp4(src, dst string, sport, dport layers.TCPPort, flags ...func(*layers.TCP)) []gopacket.SerializableLayer {
+	tcp := &layers.TCP{SrcPort: sport, DstPort: dport, Window: 1024}
+	for _, f := range flags {
+		f(tcp)
+	}
+	return []gopacket.SerializableLayer{
+		&layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: net.ParseIP(src), DstIP: net.ParseIP(dst)},
+		tcp,
+		gopacket.Payload("hello"),
+	}
+}
+
+func udp6(src, dst string, sport, dport layers.UDPPort) []gopacket.SerializableLayer {
+	return []gopacket.SerializableLayer{
+		&layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolUDP, SrcIP: net.ParseIP(src), DstIP: net.ParseIP(dst)},
+		&layers.UDP{SrcPort: sport, DstPort: dport},
+		gopacket.Payload("hello"),
+	}
+}
+
+func arp(src, dst string) []gopacket.SerializableLayer {
+	return []gopacket.SerializableLayer{&layers.ARP{
+		AddrType: layers.LinkTypeEthernet, Protocol: layers.EthernetTypeIPv4, HwAddressSize: 6, ProtAddressSize: 4,
+		Operation: layers.ARPRequest, SourceHwAddress: clientMAC, SourceProtAddress: net.ParseIP(src).To4(),
+		DstHwAddress: make([]byte, 6), DstProtAddress: net.ParseIP(dst).To4(),
+	}}
+}
+
+func sctp4(src, dst string, sport, dport uint16) []gopacket.SerializableLayer {
+	return []gopacket.SerializableLayer{
+		&layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolSCTP, SrcIP: net.ParseIP(src), DstIP: net.ParseIP(dst)},
+		&layers.SCTP{SrcPort: layers.SCTPPort(sport), DstPort: layers.SCTPPort(dport)},
+	}
+}
+
+func syn(tcp *layers.TCP) {
+	tcp.SYN = true
+}
+
+// matches runs the compiled filter on the packet
+func matches(t *testing.T, expr string, link layers.LinkType, packet []byte) bool {
+	t.Helper()
+	program, err := Compile(expr, link, 0)
+	require.NoError(t, err)
+	vm, err := bpf.NewVM(program)
+	require.NoError(t, err)
+	n, err := vm.Run(packet)
+	require.NoError(t, err)
+	return n > 0
+}
+
+func TestCompile(t *testing.T) {
+	web := tcp4("10.0.0.1", "10.0.1.5", 43210, 8080)
+	webSyn := tcp4("10.0.0.1", "10.0.1.5", 43210, 8080, syn)
+	dns6 := udp6("fd00::1", "fd00::53", 5353, 53)
+	who := arp("10.0.0.1", "10.0.0.254")
+	diameter := sctp4("10.0.0.1", "10.0.1.5", 3868, 3868)
+
+	tests := []struct {
+		expr    string
+		packets map[string]bool
+	}{
+		{"", map[string]bool{"web": true, "dns6": true, "arp": true}},
+		{"tcp", map[string]bool{"web": true, "dns6": false, "arp": false}},
+		{"udp", map[string]bool{"web": false, "dns6": true}},
+		{"ip", map[string]bool{"web": true, "dns6": false, "arp": false}},
+		{"ip6", map[string]bool{"web": false, "dns6": true}},
+		{"arp", map[string]bool{"web": false, "arp": true}},
+		{"port 8080", map[string]bool{"web": true, "dns6": false}},
+		{"port http-alt", map[string]bool{"web": true}},
+		{"port 53", map[string]bool{"web": false, "dns6": true}},
+		{"port 3868", map[string]bool{"web": false, "sctp": true}},
+		{"sctp port 3868", map[string]bool{"sctp": true}},
+		{"tcp port 3868", map[string]bool{"sctp": false}},
+		{"sctp", map[string]bool{"sctp": true, "web": false}},
+		{"src or dst port 8080", map[string]bool{"web": true, "dns6": false}},
+		{"src and dst port 3868", map[string]bool{"sctp": true, "web": false}},
+		{"src and dst host 10.0.0.1", map[string]bool{"web": false}},
+		{"tcp port 53", map[string]bool{"dns6": false}},
+		{"src port 8080", map[string]bool{"web": false}},
+		{"dst port 8080 or 443", map[string]bool{"web": true}},
+		{"portrange 8000-8100", map[string]bool{"web": true, "dns6": false}},
+		{"udp dst portrange 50-60", map[string]bool{"dns6": true, "web": false}},
+		{"host 10.0.1.5", map[string]bool{"web": true, "arp": false}},
+		{"host 10.0.0.1", map[string]bool{"web": true, "arp": true}},
+		{"ip host 10.0.0.1", map[string]bool{"web": true, "arp": false}},
+		{"src host 10.0.1.5", map[string]bool{"web": false}},
+		{"host fd00::53", map[string]bool{"dns6": true, "web": false}},
+		{"ip6 src host fd00::1", map[string]bool{"dns6": true}},
+		{"net 10.0.1.0/24", map[string]bool{"web": true, "arp": false}},
+		{"dst net 10.0", map[string]bool{"web": true, "arp": true}},
+		{"net 10.0.0.0 mask 255.255.255.0", map[string]bool{"web": true}},
+		{"net fd00::/16", map[string]bool{"dns6": true, "web": false}},
+		{"ether src host 02:42:ac:11:00:02", map[string]bool{"web": true, "dns6": true}},
+		{"ether dst host 02:42:ac:11:00:02", map[string]bool{"web": false}},
+		{"ether proto arp", map[string]bool{"arp": true, "web": false}},
+		{"ip proto tcp", map[string]bool{"web": true, "dns6": false}},
+		{"ip6 proto udp", map[string]bool{"dns6": true, "web": false}},
+		{"proto 17", map[string]bool{"dns6": true, "web": false}},
+		{"proto \\tcp", map[string]bool{"web": true, "dns6": false}},
+		{"tcp[tcpflags] & tcp-syn != 0", map[string]bool{"web": false, "webSyn": true, "dns6": false}},
+		{"tcp[13] & 2 = 0", map[string]bool{"web": true, "webSyn": false}},
+		{"ip[9] = 6", map[string]bool{"web": true}},
+		{"tcp[2:2] > 8000 and tcp[2:2] <= 8080", map[string]bool{"web": true}},
+		{"greater 64", map[string]bool{"dns6": true, "arp": false}},
+		{"less 64", map[string]bool{"dns6": false, "arp": true}},
+		{"not port 8080", map[string]bool{"web": false, "dns6": true, "arp": true}},
+		{"tcp and not (port 22 or port 8080)", map[string]bool{"web": false}},
+		{"udp or arp", map[string]bool{"web": false, "dns6": true, "arp": true}},
+	}
+	packets := map[string][]byte{
+		"web":    testPacket(t, layers.LinkTypeEthernet, web...),
+		"webSyn": testPacket(t, layers.LinkTypeEthernet, webSyn...),
+		"dns6":   testPacket(t, layers.LinkTypeEthernet, dns6...),
+		"arp":    testPacket(t, layers.LinkTypeEthernet, who...),
+		"sctp":   testPacket(t, layers.LinkTypeEthernet, diameter...),
+	}
+	for _, tt := range tests {
+		for name, expected := range tt.packets {
+			assert.Equal(t, expected, matches(t, tt.expr, layers.LinkTypeEthernet, packets[name]), "%q on %s", tt.expr, name)
+		}
+	}
+}
+
+func TestCompileRaw(t *testing.T) {
+	web := testPacket(t, layers.LinkTypeRaw, tcp4("10.0.0.1", "10.0.1.5", 43210, 8080)...)
+	dns6 := testPacket(t, layers.LinkTypeRaw, udp6("fd00::1", "fd00::53", 5353, 53)...)
+
+	assert.True(t, matches(t, "tcp dst port 8080", layers.LinkTypeRaw, web))
+	assert.True(t, matches(t, "host 10.0.1.5", layers.LinkTypeRaw, web))
+	assert.False(t, matches(t, "ip6", layers.LinkTypeRaw, web))
+	assert.True(t, matches(t, "udp port 53", layers.LinkTypeRaw, dns6))
+	assert.False(t, matches(t, "arp", layers.LinkTypeRaw, web))
+
+	_, err := Compile("ether host 02:42:ac:11:00:02", layers.LinkTypeRaw, 0)
+	assert.Error(t, err)
+}
+
+func TestCompileLongJumps(t *testing.T) {
+	// the jumps of the first primitives skip more than 255 instructions
+	expr := "port 1"
+	for port := 2; port <= 40; port++ {
+		expr += fmt.Sprintf(" or port %d", port)
+	}
+	first := testPacket(t, layers.LinkTypeEthernet, tcp4("10.0.0.1", "10.0.1.5", 43210, 1)...)
+	last := testPacket(t, layers.LinkTypeEthernet, tcp4("10.0.0.1", "10.0.1.5", 43210, 40)...)
+	none := testPacket(t, layers.LinkTypeEthernet, tcp4("10.0.0.1", "10.0.1.5", 43210, 8080)...)
+	assert.True(t, matches(t, expr, layers.LinkTypeEthernet, first))
+	assert.True(t, matches(t, expr, layers.LinkTypeEthernet, last))
+	assert.False(t, matches(t, expr, layers.LinkTypeEthernet, none))
+	assert.True(t, matches(t, "not ("+expr+")", layers.LinkTypeEthernet, none))
+}
+
+func TestCompileFragments(t *testing.T) {
+	l := tcp4("10.0.0.1", "10.0.1.5", 43210, 8080)
+	l[0].(*layers.IPv4).FragOffset = 100
+	fragment := testPacket(t, layers.LinkTypeEthernet, l...)
+	assert.False(t, matches(t, "port 8080", layers.LinkTypeEthernet, fragment))
+	assert.True(t, matches(t, "host 10.0.1.5", layers.LinkTypeEthernet, fragment))
+}
+
+func TestCompileSnapLen(t *testing.T) {
+	packet := testPacket(t, layers.LinkTypeEthernet, tcp4("10.0.0.1", "10.0.1.5", 43210, 8080)...)
+	program, err := Compile("tcp", layers.LinkTypeEthernet, 64)
+	require.NoError(t, err)
+	vm, err := bpf.NewVM(program)
+	require.NoError(t, err)
+	n, err := vm.Run(packet)
+	require.NoError(t, err)
+	assert.Equal(t, 64, n)
+
+	program, err = Compile("", layers.LinkTypeEthernet, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []bpf.Instruction{bpf.RetConstant{Val: MaxSnapLen}}, program)
+}
+
+func TestCompileHostName(t *testing.T) {
+	defer func(f func(string) ([]net.IP, error)) { lookupIP = f }(lookupIP)
+	lookupIP = func(host string) ([]net.IP, error) {
+		if host == "api.shop.svc" {
+			return []net.IP{net.ParseIP("10.0.1.5"), net.ParseIP("fd00::53")}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	web := testPacket(t, layers.LinkTypeEthernet, tcp4("10.0.0.1", "10.0.1.5", 43210, 8080)...)
+	dns6 := testPacket(t, layers.LinkTypeEthernet, udp6("fd00::1", "fd00::53", 5353, 53)...)
+	assert.True(t, matches(t, "host api.shop.svc", layers.LinkTypeEthernet, web))
+	assert.True(t, matches(t, "host api.shop.svc", layers.LinkTypeEthernet, dns6))
+	assert.False(t, matches(t, "ip host api.shop.svc", layers.LinkTypeEthernet, dns6))
+
+	_, err := Compile("host db.shop.svc", layers.LinkTypeEthernet, 0)
+	assert.EqualError(t, err, `invalid filter "host db.shop.svc": unknown host "db.shop.svc"`)
+}
+
+func TestCompileErrors(t *testing.T) {
+	_, err := Compile("port", layers.LinkTypeEthernet, 0)
+	assert.Error(t, err)
+	_, err = Compile("tcp", layers.LinkTypeLinuxSLL, 0)
+	assert.Error(t, err)
+	_, err = Compile("ip6 net 10.0.0.0/8", layers.LinkTypeEthernet, 0)
+	assert.Error(t, err)
+}
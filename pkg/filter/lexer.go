@@ -0,0 +1,114 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+	tokNot
+	tokAnd
+	tokOr
+	tokMask
+	tokCompare
+)
+
+// token is a lexical element of a filter, pos is its byte offset in the expression
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of filter"
+	}
+	return fmt.Sprintf("%q at position %d", t.text, t.pos+1)
+}
+
+// isWordChar returns true for the characters of names, numbers, addresses and ranges
+func isWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		strings.IndexByte("_.:-/\\", c) >= 0
+}
+
+// lex splits a filter expression into tokens
+func lex(s string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(s); {
+		c := s[i]
+		two := ""
+		if i+1 < len(s) {
+			two = s[i : i+2]
+		}
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case two == "&&":
+			tokens = append(tokens, token{tokAnd, two, i})
+			i += 2
+		case two == "||":
+			tokens = append(tokens, token{tokOr, two, i})
+			i += 2
+		case two == "<<" || two == ">>":
+			return nil, fmt.Errorf("operator %q at position %d: %w", two, i+1, ErrUnsupported)
+		case strings.IndexByte("|+*%^", c) >= 0:
+			return nil, fmt.Errorf("operator %q at position %d: %w", c, i+1, ErrUnsupported)
+		case two == "!=" || two == "<=" || two == ">=" || two == "==":
+			tokens = append(tokens, token{tokCompare, two, i})
+			i += 2
+		case c == '=' || c == '<' || c == '>':
+			tokens = append(tokens, token{tokCompare, string(c), i})
+			i++
+		case c == '!':
+			tokens = append(tokens, token{tokNot, "!", i})
+			i++
+		case c == '&':
+			tokens = append(tokens, token{tokMask, "&", i})
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{tokLBracket, "[", i})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{tokRBracket, "]", i})
+			i++
+		case isWordChar(c):
+			start := i
+			for i < len(s) && isWordChar(s[i]) {
+				i++
+			}
+			tokens = append(tokens, keyword(token{tokWord, s[start:i], start}))
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", c, i+1)
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(s)}), nil
+}
+
+// keyword converts the and, or and not words to operators
+func keyword(t token) token {
+	switch t.text {
+	case "and":
+		t.kind = tokAnd
+	case "or":
+		t.kind = tokOr
+	case "not":
+		t.kind = tokNot
+	}
+	return t
+}
@@ -0,0 +1,486 @@
+// Package filter parses the tcpdump capture filter syntax (pcap-filter) without libpcap,
+// and compiles it into classic BPF programs.
+//
+// The supported subset covers the host, net, port, portrange and proto primitives with their
+// protocol and direction qualifiers (src, dst, src or dst, src and dst), the packet length (len, less, greater) and the
+// proto[offset:size] & mask comparisons, combined with and, or, not and parentheses.
+// The other pcap-filter primitives and the arithmetic operators fail with ErrUnsupported.
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const protoLen = "len"
+
+// ErrUnsupported is returned for the pcap-filter syntax outside of the supported subset
+var ErrUnsupported = errors.New("not supported without libpcap")
+
+var (
+	protocols = map[string]bool{
+		"ether": true, "ip": true, "ip6": true, "arp": true,
+		"tcp": true, "udp": true, "sctp": true, "icmp": true, "icmp6": true,
+	}
+	directions = map[string]bool{"src": true, "dst": true}
+	types      = map[string]bool{"host": true, "net": true, "port": true, "portrange": true, "proto": true}
+
+	// services are the port names resolved by libpcap from /etc/services
+	services = map[string]int{
+		"ftp-data": 20, "ftp": 21, "ssh": 22, "telnet": 23, "smtp": 25, "domain": 53,
+		"bootps": 67, "bootpc": 68, "tftp": 69, "http": 80, "pop3": 110, "ntp": 123,
+		"imap": 143, "snmp": 161, "ldap": 389, "https": 443, "syslog": 514, "ldaps": 636,
+		"mysql": 3306, "postgresql": 5432, "redis": 6379, "http-alt": 8080,
+	}
+
+	// ipProtocols are the names of the ip proto values
+	ipProtocols = map[string]int{"icmp": 1, "igmp": 2, "tcp": 6, "udp": 17, "gre": 47, "esp": 50, "icmp6": 58, "sctp": 132}
+	// etherProtocols are the names of the ether proto values
+	etherProtocols = map[string]int{"ip": 0x0800, "arp": 0x0806, "ip6": 0x86dd, "vlan": 0x8100}
+
+	// constants are the names usable in comparisons
+	constants = map[string]uint32{
+		"tcpflags": 13, "tcp-fin": 0x01, "tcp-syn": 0x02, "tcp-rst": 0x04, "tcp-push": 0x08,
+		"tcp-ack": 0x10, "tcp-urg": 0x20, "tcp-ece": 0x40, "tcp-cwr": 0x80,
+		"icmptype": 0, "icmpcode": 1, "icmp-echoreply": 0, "icmp-unreach": 3, "icmp-redirect": 5,
+		"icmp-echo": 8, "icmp-timxceed": 11,
+	}
+
+	hostname = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)*$`)
+)
+
+// Parse parses a filter expression, an empty expression returns a nil node.
+func Parse(expr string) (Node, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", expr, err)
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, nil
+	}
+	n, err := p.expr()
+	if err == nil && p.peek().kind != tokEOF {
+		err = fmt.Errorf("unexpected %s", p.peek())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", expr, err)
+	}
+	return n, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	// last is the previous primitive, its qualifiers apply to the values written alone
+	last *Primitive
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// expr parses unary expressions joined by and / or, evaluated left to right like pcap
+func (p *parser) expr() (Node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op.kind != tokAnd && op.kind != tokOr {
+			return left, nil
+		}
+		p.next()
+		right, errRight := p.unary()
+		if errRight != nil {
+			return nil, errRight
+		}
+		if op.kind == tokAnd {
+			left = And{Left: left, Right: right}
+		} else {
+			left = Or{Left: left, Right: right}
+		}
+	}
+}
+
+func (p *parser) unary() (Node, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokNot:
+		p.next()
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Node: n}, nil
+	case tokLParen:
+		p.next()
+		n, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, fmt.Errorf("expected \")\" instead of %s", closing)
+		}
+		return n, nil
+	case tokWord:
+		return p.primitive()
+	default:
+		return nil, fmt.Errorf("unexpected %s", t)
+	}
+}
+
+func (p *parser) primitive() (Node, error) {
+	t := p.next()
+	word := strings.ToLower(t.text)
+
+	switch {
+	case word == "less" || word == "greater":
+		n, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		op := "<="
+		if word == "greater" {
+			op = ">="
+		}
+		return Compare{Proto: protoLen, Op: op, Value: n}, nil
+	case word == protoLen:
+		return p.compare(Compare{Proto: protoLen})
+	case protocols[word] && p.peek().kind == tokLBracket:
+		return p.accessor(word)
+	}
+
+	prim := Primitive{}
+	qualified := false
+	if protocols[word] {
+		prim.Proto, qualified = word, true
+		t = p.nextQualifier()
+		word = strings.ToLower(t.text)
+	}
+	if directions[word] {
+		prim.Dir, qualified = p.direction(word), true
+		t = p.nextQualifier()
+		word = strings.ToLower(t.text)
+	}
+	if types[word] {
+		prim.Type, qualified = word, true
+		t = p.next()
+		word = t.text
+	}
+
+	lower := strings.ToLower(word)
+	switch {
+	case t.kind == tokWord && prim.Type != "proto" && (protocols[lower] || directions[lower] || types[lower]):
+		return nil, fmt.Errorf("unexpected %s", t)
+	case t.kind != tokWord && prim.Type == "" && prim.Dir == "" && prim.Proto != "":
+		// a protocol alone
+		return p.keep(prim)
+	case t.kind != tokWord:
+		return nil, fmt.Errorf("missing value before %s", t)
+	case prim.Type != "proto" && isKeyword(lower):
+		return nil, fmt.Errorf("primitive %s: %w", t, ErrUnsupported)
+	case !qualified && p.last != nil:
+		// the value reuses the qualifiers of the previous primitive, e.g port 80 or 443
+		prim = *p.last
+	}
+	if prim.Type == "" {
+		prim.Type = "host"
+	}
+	value, err := normalize(prim, strings.TrimPrefix(word, "\\"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", t, err)
+	}
+	prim.Value = value
+	if prim.Type == "net" && p.peek().kind == tokWord && strings.ToLower(p.peek().text) == "mask" {
+		p.next()
+		if prim.Value, err = netMask(prim.Value, p.next()); err != nil {
+			return nil, err
+		}
+	}
+	return p.keep(prim)
+}
+
+// direction consumes the second direction of the src or dst, src and dst qualifiers
+func (p *parser) direction(dir string) string {
+	op := p.peek()
+	if op.kind != tokAnd && op.kind != tokOr {
+		return dir
+	}
+	other := p.tokens[p.pos+1]
+	if other.kind != tokWord || !directions[strings.ToLower(other.text)] || strings.ToLower(other.text) == dir {
+		return dir
+	}
+	p.next()
+	p.next()
+	if op.kind == tokAnd {
+		return "src and dst"
+	}
+	return "src or dst"
+}
+
+// nextQualifier consumes the token after a qualifier if it is a word
+func (p *parser) nextQualifier() token {
+	if p.peek().kind != tokWord {
+		return token{kind: tokEOF, pos: p.peek().pos}
+	}
+	return p.next()
+}
+
+// keep checks the qualifiers and records the primitive for the next values
+func (p *parser) keep(prim Primitive) (Node, error) {
+	if err := checkQualifiers(prim); err != nil {
+		return nil, err
+	}
+	if prim.Value != "" {
+		p.last = &prim
+	}
+	return prim, nil
+}
+
+// accessor parses proto[offset], proto[offset:size] comparisons
+func (p *parser) accessor(proto string) (Node, error) {
+	p.next()
+	t := p.next()
+	if t.kind != tokWord {
+		return nil, fmt.Errorf("expected an offset instead of %s", t)
+	}
+	c := Compare{Proto: proto, Size: 1}
+	offset, size, found := strings.Cut(t.text, ":")
+	o, err := constant(offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", t, err)
+	}
+	c.Offset = o
+	if found {
+		switch size {
+		case "1", "2", "4":
+			c.Size, _ = strconv.Atoi(size)
+		default:
+			return nil, fmt.Errorf("%s: size must be 1, 2 or 4", t)
+		}
+	}
+	if closing := p.next(); closing.kind != tokRBracket {
+		return nil, fmt.Errorf("expected \"]\" instead of %s", closing)
+	}
+	return p.compare(c)
+}
+
+// compare parses the optional mask, the operator and the value of a comparison
+func (p *parser) compare(c Compare) (Node, error) {
+	var err error
+	if p.peek().kind == tokMask {
+		p.next()
+		if c.Mask, err = p.number(); err != nil {
+			return nil, err
+		}
+		c.HasMask = true
+	}
+	op := p.next()
+	if op.kind != tokCompare {
+		return nil, fmt.Errorf("expected a comparison operator instead of %s", op)
+	}
+	c.Op = op.text
+	if c.Op == "==" {
+		c.Op = "="
+	}
+	if c.Value, err = p.number(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// number parses a decimal, hexadecimal or named constant
+func (p *parser) number() (uint32, error) {
+	t := p.next()
+	if t.kind != tokWord {
+		return 0, fmt.Errorf("expected a number instead of %s", t)
+	}
+	n, err := constant(t.text)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", t, err)
+	}
+	return n, nil
+}
+
+func constant(s string) (uint32, error) {
+	if n, ok := constants[strings.ToLower(s)]; ok {
+		return n, nil
+	}
+	n, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number")
+	}
+	return uint32(n), nil
+}
+
+// isKeyword returns true for the pcap keywords this package does not support
+func isKeyword(s string) bool {
+	switch s {
+	case "gateway", "broadcast", "multicast", "vlan", "mpls", "pppoed", "pppoes", "geneve",
+		"inbound", "outbound", "ifname", "on", "rnr", "rulenum", "reason", "rset", "srnr", "subrulenum", "action",
+		"wlan", "type", "subtype", "dir", "atalk", "aarp", "decnet", "iso", "stp", "ipx", "netbeui", "rarp",
+		"link", "ppp", "slip", "fddi", "tr", "radio", "llc", "protochain", "igmp", "igrp", "pim", "vrrp", "carp",
+		"ah", "esp", "lat", "sca", "moprc", "mopdl", "esis", "isis", "clnp", "hdlc":
+		return true
+	}
+	return false
+}
+
+// checkQualifiers checks that the protocol, direction and type can be combined
+func checkQualifiers(p Primitive) error {
+	allowed := map[string][]string{
+		"":          {"ip", "ip6", "arp", "ether", "tcp", "udp", "sctp", "icmp", "icmp6"},
+		"host":      {"", "ether", "ip", "ip6", "arp"},
+		"net":       {"", "ip", "ip6", "arp"},
+		"port":      {"", "tcp", "udp", "sctp"},
+		"portrange": {"", "tcp", "udp", "sctp"},
+		"proto":     {"", "ether", "ip", "ip6"},
+	}
+	for _, proto := range allowed[p.Type] {
+		if proto == p.Proto {
+			if p.Type == "" && p.Dir != "" {
+				return fmt.Errorf("%q needs a host, net or port", p.String())
+			}
+			if p.Type == "proto" && p.Dir != "" {
+				return fmt.Errorf("%q cannot have a direction", p.String())
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not a valid combination of qualifiers", p.String())
+}
+
+// normalize checks the value of a primitive and converts names to numbers
+func normalize(p Primitive, v string) (string, error) {
+	switch p.Type {
+	case "host":
+		return hostValue(p.Proto, v)
+	case "net":
+		return netValue(v)
+	case "port":
+		port, err := portValue(v)
+		return strconv.Itoa(port), err
+	case "portrange":
+		from, to, found := strings.Cut(v, "-")
+		if !found {
+			return "", fmt.Errorf("port range must be written start-end")
+		}
+		start, err := portValue(from)
+		if err != nil {
+			return "", err
+		}
+		end, err := portValue(to)
+		if err != nil {
+			return "", err
+		}
+		if start > end {
+			start, end = end, start
+		}
+		return fmt.Sprintf("%d-%d", start, end), nil
+	case "proto":
+		return protoValue(p.Proto, v)
+	}
+	return "", fmt.Errorf("unexpected value")
+}
+
+func hostValue(proto string, v string) (string, error) {
+	if proto == "ether" {
+		mac, err := net.ParseMAC(v)
+		if err != nil {
+			return "", fmt.Errorf("invalid mac address")
+		}
+		return mac.String(), nil
+	}
+	if ip := net.ParseIP(v); ip != nil {
+		if proto == "ip" && ip.To4() == nil {
+			return "", fmt.Errorf("ip host must be an ipv4 address")
+		}
+		if proto == "ip6" && ip.To4() != nil {
+			return "", fmt.Errorf("ip6 host must be an ipv6 address")
+		}
+		return ip.String(), nil
+	}
+	if !hostname.MatchString(v) || strings.Trim(v, "0123456789.") == "" {
+		return "", fmt.Errorf("invalid host")
+	}
+	return v, nil
+}
+
+func netValue(v string) (string, error) {
+	if _, n, err := net.ParseCIDR(v); err == nil {
+		return n.String(), nil
+	}
+	if ip := net.ParseIP(v); ip != nil {
+		bits := 128
+		if ip.To4() != nil {
+			bits = 32
+		}
+		return fmt.Sprintf("%s/%d", ip, bits), nil
+	}
+	// abbreviated ipv4 networks, e.g net 10.1 is 10.1.0.0/16
+	parts := strings.Split(v, ".")
+	if len(parts) < 4 {
+		full := append(parts, make([]string, 4-len(parts))...)
+		for i := len(parts); i < 4; i++ {
+			full[i] = "0"
+		}
+		if ip := net.ParseIP(strings.Join(full, ".")); ip != nil && ip.To4() != nil {
+			return fmt.Sprintf("%s/%d", ip, 8*len(parts)), nil
+		}
+	}
+	return "", fmt.Errorf("invalid network")
+}
+
+// netMask applies a net mask to a network, e.g net 10.0.0.0 mask 255.0.0.0
+func netMask(network string, t token) (string, error) {
+	mask := net.ParseIP(t.text).To4()
+	ip, _, err := net.ParseCIDR(network)
+	if mask == nil || err != nil || ip.To4() == nil {
+		return "", fmt.Errorf("%s: invalid ipv4 mask", t)
+	}
+	ones, bits := net.IPMask(mask).Size()
+	if bits == 0 {
+		return "", fmt.Errorf("%s: non contiguous mask", t)
+	}
+	return fmt.Sprintf("%s/%d", ip.Mask(net.IPMask(mask)), ones), nil
+}
+
+func portValue(v string) (int, error) {
+	if port, ok := services[strings.ToLower(v)]; ok {
+		return port, nil
+	}
+	port, err := strconv.Atoi(v)
+	if err != nil || port < 0 || port > 65535 {
+		return 0, fmt.Errorf("invalid port")
+	}
+	return port, nil
+}
+
+func protoValue(proto string, v string) (string, error) {
+	names, max := ipProtocols, 255
+	if proto == "ether" {
+		names, max = etherProtocols, 65535
+	}
+	if n, ok := names[strings.ToLower(v)]; ok {
+		return strconv.Itoa(n), nil
+	}
+	n, err := strconv.ParseUint(v, 0, 32)
+	if err != nil || int(n) > max {
+		return "", fmt.Errorf("invalid protocol")
+	}
+	return strconv.Itoa(int(n)), nil
+}
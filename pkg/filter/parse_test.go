@@ -0,0 +1,80 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]string{
+		"tcp":                               "tcp",
+		"port 80":                           "port 80",
+		"tcp dst port http":                 "tcp dst port 80",
+		"host 10.0.0.1 and not port 22":     "(host 10.0.0.1 and not port 22)",
+		"port 80 or 443":                    "(port 80 or port 443)",
+		"src 10.0.0.1 && (udp || icmp)":     "(src host 10.0.0.1 and (udp or icmp))",
+		"net 10.1":                          "net 10.1.0.0/16",
+		"src net 10.0.0.0 mask 255.255.0.0": "src net 10.0.0.0/16",
+		"ip6 host fe80::1":                  "ip6 host fe80::1",
+		"ether src AA:BB:CC:DD:EE:FF":       "ether src host aa:bb:cc:dd:ee:ff",
+		"portrange 9000-8000":               "portrange 8000-9000",
+		"ip proto \\tcp":                    "ip proto 6",
+		"ether proto arp":                   "ether proto 2054",
+		"host api.default.svc":              "host api.default.svc",
+		"tcp[tcpflags] & tcp-syn != 0":      "tcp[13:1] & 2 != 0",
+		"ip[2:2] > 0x100 and greater 60":    "(ip[2:2] > 256 and len >= 60)",
+		"len == 42":                         "len = 42",
+		"not tcp and not udp or arp":        "((not tcp and not udp) or arp)",
+		"src or dst port 80":                "src or dst port 80",
+		"ip dst and src host 10.0.0.1":      "ip src and dst host 10.0.0.1",
+		"proto 6":                           "proto 6",
+		"proto \\udp":                       "proto 17",
+		"sctp port 3868":                    "sctp port 3868",
+	}
+	for expr, expected := range tests {
+		n, err := Parse(expr)
+		if assert.Nil(t, err, expr) {
+			assert.Equal(t, expected, n.String(), expr)
+		}
+	}
+
+	n, err := Parse("  ")
+	assert.Nil(t, err)
+	assert.Nil(t, n)
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"port":              "missing value before end of filter",
+		"port 80 and":       "unexpected end of filter",
+		"(tcp":              "expected \")\" instead of end of filter",
+		"tcp)":              "unexpected \")\" at position 4",
+		"port 70000":        "\"70000\" at position 6: invalid port",
+		"host 10.0.0":       "\"10.0.0\" at position 6: invalid host",
+		"ip host ::1":       "ip host must be an ipv4 address",
+		"udp host 10.0.0.1": "\"udp host 10.0.0.1\" is not a valid combination of qualifiers",
+		"src tcp":           "unexpected \"tcp\" at position 5",
+		"tcp[13:3] = 2":     "size must be 1, 2 or 4",
+		"tcp[13] 2":         "expected a comparison operator instead of \"2\" at position 9",
+		"vlan 100":          "primitive \"vlan\" at position 1: not supported without libpcap",
+		"port 80 $":         "unexpected character '$' at position 9",
+	}
+	for expr, expected := range tests {
+		_, err := Parse(expr)
+		if assert.NotNil(t, err, expr) {
+			assert.Contains(t, err.Error(), expected, expr)
+		}
+	}
+}
+
+func TestParseUnsupported(t *testing.T) {
+	// the libpcap filters outside of the subset fail clearly
+	for _, expr := range []string{
+		"vlan", "igmp", "ether broadcast", "ip6 multicast", "rarp", "inbound", "port 80 and vlan 100",
+		"tcp[tcpflags] & (tcp-syn|tcp-fin) != 0", "ip[2:2] > 1500 + 20", "tcp[12] >> 4 > 5",
+	} {
+		_, err := Parse(expr)
+		assert.ErrorIs(t, err, ErrUnsupported, expr)
+	}
+}
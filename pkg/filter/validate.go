@@ -0,0 +1,20 @@
+//go:build !cgo
+// +build !cgo
+
+package filter
+
+import (
+	"errors"
+	"log"
+)
+
+// Validate checks a filter expression without libpcap. The expressions outside of the subset
+// parsed by this package only log a warning, libpcap compiles them in the agents.
+func Validate(expr string) error {
+	_, err := Parse(expr)
+	if errors.Is(err, ErrUnsupported) {
+		log.Println("warning: " + err.Error() + ", the filter is checked by the agents")
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,23 @@
+//go:build cgo
+// +build cgo
+
+package filter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// Validate checks a filter expression with libpcap, like the agents compiling it
+func Validate(expr string) error {
+	if strings.TrimSpace(expr) == "" {
+		return nil
+	}
+	if _, err := pcap.CompileBPFFilter(layers.LinkTypeEthernet, MaxSnapLen, expr); err != nil {
+		return fmt.Errorf("invalid filter %q: %w", expr, err)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	// the filters accepted by libpcap are never rejected, even outside of the parsed subset
+	for _, expr := range []string{
+		"", "tcp port 80", "src or dst port 80", "proto 6", "sctp", "vlan", "ether broadcast", "multicast", "rarp", "inbound",
+		"tcp[tcpflags] & (tcp-syn|tcp-fin) != 0",
+	} {
+		assert.NoError(t, Validate(expr), expr)
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	// the syntax errors are rejected before any agent is injected
+	for _, expr := range []string{"port 8o", "port", "tcp)", "host 10.0.0"} {
+		assert.Error(t, Validate(expr), expr)
+	}
+}
@@ -3,6 +3,8 @@ package k8s
 import (
 	"context"
 	"os"
+	"path"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -95,24 +97,175 @@ type PodLister interface {
 	List(ctx context.Context, opts metav1.ListOptions) (*v1.PodList, error)
 }
 
-// SelectPods select pods from a list of pods or all pods
-func SelectPods(pods []string, all bool, h PodLister) ([]v1.Pod, error) {
-	podList, err := h.List(context.Background(), metav1.ListOptions{})
+// SelectOpts are the pod selection options
+type SelectOpts struct {
+	LabelSelector string          // kubernetes label selector, e.g app=nginx,tier!=db
+	FieldSelector string          // kubernetes field selector, e.g spec.nodeName=node1
+	Workloads     WorkloadHandler // resolves the deployment and service arguments
+}
+
+type SelectOpt func(o SelectOpts) SelectOpts
+
+// WithLabelSelector selects the pods matching the label selector
+func WithLabelSelector(s string) SelectOpt {
+	return func(o SelectOpts) SelectOpts {
+		o.LabelSelector = s
+		return o
+	}
+}
+
+// WithFieldSelector selects the pods matching the field selector
+func WithFieldSelector(s string) SelectOpt {
+	return func(o SelectOpts) SelectOpts {
+		o.FieldSelector = s
+		return o
+	}
+}
+
+// WithWorkloadHandler sets the handler used to resolve workloads to pods
+func WithWorkloadHandler(h WorkloadHandler) SelectOpt {
+	return func(o SelectOpts) SelectOpts {
+		o.Workloads = h
+		return o
+	}
+}
+
+// selectors returns true when the pods are filtered by the api server
+func (o SelectOpts) selectors() bool {
+	return o.LabelSelector != "" || o.FieldSelector != ""
+}
+
+// SelectPods select pods from a list of pods or all pods.
+// Pods can be selected by name, glob (api-*), regular expression (/^api-[0-9]+$/)
+// or workload (deployment/api, svc/redis), and filtered by label and field selectors.
+// Without names all the pods matching the selectors are selected.
+func SelectPods(pods []string, all bool, h PodLister, opts ...SelectOpt) ([]v1.Pod, error) {
+	o := SelectOpts{}
+	for _, opt := range opts {
+		o = opt(o)
+	}
+	podList, err := h.List(context.Background(), metav1.ListOptions{
+		LabelSelector: o.LabelSelector,
+		FieldSelector: o.FieldSelector,
+	})
 	if err != nil {
 		return nil, err
 	}
-	if all {
+
+	if o.selectors() && len(podList.Items) == 0 {
+		return nil, errors.New("no pod matches the selectors " + o.describe())
+	}
+	if all || (o.selectors() && len(pods) == 0) {
 		return podList.Items, nil
 	}
+
 	resp := []v1.Pod{}
-	for _, pod := range podList.Items {
-		if isInArray(pod.Name, pods) {
-			resp = append(resp, pod)
+	for _, arg := range pods {
+		match, errMatch := podMatcher(arg, o.Workloads)
+		if errMatch != nil {
+			return nil, errMatch
+		}
+		found := false
+		for _, pod := range podList.Items {
+			if match(pod) {
+				found = true
+				if !isPodInArray(pod.Name, resp) {
+					resp = append(resp, pod)
+				}
+			}
+		}
+		if !found {
+			if o.selectors() {
+				return nil, errors.New("no pod matches " + arg + " with the selectors " + o.describe())
+			}
+			return nil, errors.New("no pod matches " + arg)
 		}
 	}
 	return resp, nil
 }
 
+// MatchPod returns true when the pod is selected by the arguments of SelectPods.
+// The label and field selectors are not checked, they are expected to be applied by the pod lister or watcher.
+func MatchPod(pod v1.Pod, pods []string, all bool, opts ...SelectOpt) (bool, error) {
+	o := SelectOpts{}
+	for _, opt := range opts {
+		o = opt(o)
+	}
+	if all || (o.selectors() && len(pods) == 0) {
+		return true, nil
+	}
+	for _, arg := range pods {
+		match, err := podMatcher(arg, o.Workloads)
+		if err != nil {
+			return false, err
+		}
+		if match(pod) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// describe returns the selectors for error messages
+func (o SelectOpts) describe() string {
+	d := []string{}
+	if o.LabelSelector != "" {
+		d = append(d, "-l "+o.LabelSelector)
+	}
+	if o.FieldSelector != "" {
+		d = append(d, "--field-selector "+o.FieldSelector)
+	}
+	return strings.Join(d, " ")
+}
+
+// podMatcher returns a function matching the pods of a workload or matching a name pattern
+func podMatcher(arg string, h WorkloadHandler) (func(v1.Pod) bool, error) {
+	w, isWorkload, err := ParseWorkload(arg)
+	if err != nil {
+		return nil, err
+	}
+	if isWorkload {
+		return workloadMatcher(w, h)
+	}
+	match, err := nameMatcher(arg)
+	if err != nil {
+		return nil, err
+	}
+	return func(p v1.Pod) bool { return match(p.Name) }, nil
+}
+
+// ValidateSelection checks the syntax of a pod name, glob, /regexp/ or kind/name argument
+func ValidateSelection(arg string) error {
+	_, isWorkload, err := ParseWorkload(arg)
+	if err != nil || isWorkload {
+		return err
+	}
+	_, err = nameMatcher(arg)
+	return err
+}
+
+// nameMatcher returns a function matching pod names against an exact name,
+// a glob pattern or a regular expression between slashes.
+func nameMatcher(pattern string) (func(string) bool, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, errors.New("invalid pod regexp " + pattern + ": " + err.Error())
+		}
+		return re.MatchString, nil
+	}
+	if strings.ContainsAny(pattern, "*?[") {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.New("invalid pod pattern " + pattern + ": " + err.Error())
+		}
+		return func(name string) bool {
+			ok, _ := path.Match(pattern, name)
+			return ok
+		}, nil
+	}
+	return func(name string) bool { return name == pattern }, nil
+}
+
 // CheckPodsContext check if all pods are in running state
 func CheckPodsContext(pods []v1.Pod) error {
 	// Check if all pod are in running state
@@ -65,6 +65,7 @@ func TestCheckEphemeralContainerSupport(t *testing.T) {
 
 type podListerMock struct {
 	kubeProxyHandlerMockLISTState
+	opts metav1.ListOptions
 }
 
 var podlist []v1.Pod = []v1.Pod{
@@ -83,9 +84,13 @@ var podlist []v1.Pod = []v1.Pod{
 }
 
 func (p *podListerMock) List(ctx context.Context, opts metav1.ListOptions) (*v1.PodList, error) {
+	p.opts = opts
 	if p.kubeProxyHandlerMockLISTState == listError {
 		return nil, errors.New("could not list pods")
 	}
+	if p.kubeProxyHandlerMockLISTState == listEmpty {
+		return &v1.PodList{}, nil
+	}
 	if p.kubeProxyHandlerMockLISTState == listOK {
 		podlist := v1.PodList{
 			Items: podlist,
@@ -143,6 +148,58 @@ func TestSelectPods(t *testing.T) {
 	assert.Equal(t, pods, podlist)
 }
 
+func TestSelectPodsPatterns(t *testing.T) {
+	mock := podListerMock{kubeProxyHandlerMockLISTState: listOK}
+
+	pods, err := SelectPods([]string{"pod*"}, false, &mock)
+	assert.NoError(t, err)
+	assert.Equal(t, podlist, pods)
+
+	pods, err = SelectPods([]string{"/^pod[2-9]$/", "pod?"}, false, &mock)
+	assert.NoError(t, err)
+	assert.Equal(t, []v1.Pod{podlist[1], podlist[0]}, pods)
+
+	_, err = SelectPods([]string{"pod1", "api-*"}, false, &mock)
+	assert.EqualError(t, err, "no pod matches api-*")
+
+	_, err = SelectPods([]string{"/pod(/"}, false, &mock)
+	assert.Error(t, err)
+
+	_, err = SelectPods([]string{"pod["}, false, &mock)
+	assert.Error(t, err)
+}
+
+func TestValidateSelection(t *testing.T) {
+	for _, arg := range []string{"pod1", "api-*", "/^db-[0-9]+$/", "deployment/api", "svc/redis"} {
+		assert.NoError(t, ValidateSelection(arg), arg)
+	}
+	for _, arg := range []string{"pod[", "/db(/", "cronjob/backup", "sts/"} {
+		assert.Error(t, ValidateSelection(arg), arg)
+	}
+}
+
+func TestSelectPodsSelectors(t *testing.T) {
+	mock := podListerMock{kubeProxyHandlerMockLISTState: listOK}
+
+	// selectors are sent to the api server, and select all the pods without names
+	pods, err := SelectPods(nil, false, &mock, WithLabelSelector("app=nginx"), WithFieldSelector("spec.nodeName=node1"))
+	assert.NoError(t, err)
+	assert.Equal(t, podlist, pods)
+	assert.Equal(t, "app=nginx", mock.opts.LabelSelector)
+	assert.Equal(t, "spec.nodeName=node1", mock.opts.FieldSelector)
+
+	pods, err = SelectPods([]string{"pod2"}, false, &mock, WithLabelSelector("app=nginx"))
+	assert.NoError(t, err)
+	assert.Equal(t, []v1.Pod{podlist[1]}, pods)
+
+	_, err = SelectPods([]string{"pod3"}, false, &mock, WithLabelSelector("app=nginx"))
+	assert.EqualError(t, err, "no pod matches pod3 with the selectors -l app=nginx")
+
+	mock.kubeProxyHandlerMockLISTState = listEmpty
+	_, err = SelectPods(nil, true, &mock, WithLabelSelector("app=nginx"), WithFieldSelector("status.phase=Running"))
+	assert.EqualError(t, err, "no pod matches the selectors -l app=nginx --field-selector status.phase=Running")
+}
+
 func Test_isInArray(t *testing.T) {
 	type args struct {
 		s     string
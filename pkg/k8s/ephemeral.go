@@ -58,53 +58,72 @@ func SetupEphemeralContainers(pods []v1.Pod, h KubeEphemeralHandler, opts AgentO
 	return nil
 }
 
-// watcher checks all the pods until they are all in a running state
-// or until one of them is in a terminated state for an error.
+// watcher checks all the pods until their agents are all running or failed.
+// Agent state changes are reported to the status handler.
 func watcher(h KubeEphemeralHandler, pods []v1.Pod, opts AgentOpts) {
+	states := map[string]AgentState{}
 	for {
 		list, err := h.List(context.Background(), metav1.ListOptions{})
 		if err != nil {
 			log.Println(err)
 			return
 		}
-		countPod := 0
 		for _, pod := range list.Items {
-			if isPodInArray(pod.Name, pods) {
-				var errStatus error
-				if countPod, errStatus = checkpodStatus(pod, opts, countPod); errStatus != nil {
-					log.Println(errStatus)
-					return
-				}
+			if !isPodInArray(pod.Name, pods) || states[pod.Name] == AgentFailed {
+				continue
+			}
+			status := agentStatus(pod, opts)
+			if status.State == states[pod.Name] {
+				continue
+			}
+			states[pod.Name] = status.State
+			opts.report(status)
+			if status.State == AgentFailed {
+				log.Println(errors.New("error setting pod " + status.Message))
 			}
 		}
-		if countPod == len(pods) {
+		if settled(states, len(pods)) {
 			return
 		}
 		time.Sleep(defaultPolling)
 	}
 }
 
-// checkpodStatus checks the status of an ephemeral container agent
-func checkpodStatus(pod v1.Pod, opts AgentOpts, countPod int) (int, error) {
+// agentStatus returns the status of the ephemeral container agent of a pod
+func agentStatus(pod v1.Pod, opts AgentOpts) AgentStatus {
+	status := AgentStatus{Pod: pod.Name, State: AgentInjecting}
 	for _, eph := range pod.Status.EphemeralContainerStatuses {
 		if eph.Name == "kpture-"+opts.UUID {
 			if eph.State.Running != nil {
-				countPod++
-				break
+				status.State = AgentRunning
 			}
 			if eph.State.Terminated != nil {
-				return 0, errors.New("error setting pod " + eph.State.Terminated.Message)
+				status.State = AgentFailed
+				status.Message = eph.State.Terminated.Message
 			}
 		}
 	}
-	return countPod, nil
+	return status
+}
+
+// settled returns true when all the agents are running or failed
+func settled(states map[string]AgentState, count int) bool {
+	done := 0
+	for _, s := range states {
+		if s == AgentRunning || s == AgentFailed {
+			done++
+		}
+	}
+	return done == count
 }
 
 // createDebugContainer creates the debug container in a pod
 func createDebugContainer(pod v1.Pod, errchan chan error, wg *sync.WaitGroup, h KubeEphemeralHandler, opts AgentOpts) {
 	defer wg.Done()
+	opts.report(AgentStatus{Pod: pod.Name, State: AgentInjecting})
 	err := injectContainer(pod, h, opts, opts.UUID)
 	if err != nil {
+		opts.report(AgentStatus{Pod: pod.Name, State: AgentFailed, Message: err.Error()})
 		errchan <- err
 		return
 	}
@@ -134,14 +153,26 @@ func injectContainer(pod v1.Pod, h KubeEphemeralHandler, opts AgentOpts, id stri
 func debugPod(pod *v1.Pod, name string, opts AgentOpts) *v1.Pod {
 	args := []string{
 		"agent",
-		fmt.Sprintf("-d%s", opts.Device),
+		fmt.Sprintf("-d%s", opts.device(*pod)),
 		fmt.Sprintf("-t%s", opts.TargetIP),
 		fmt.Sprintf("-l%d", opts.SnapshotLen),
 		fmt.Sprintf("-p%d", opts.TargetPort),
+		"--pod=" + pod.Name,
+		"--namespace=" + pod.Namespace,
+	}
+	if pod.Spec.NodeName != "" {
+		args = append(args, "--node="+pod.Spec.NodeName)
+	}
+	if filter := opts.filter(*pod); filter != "" {
+		args = append(args, fmt.Sprintf("-f%s", filter))
+	}
+	if opts.UUID != "" {
+		args = append(args, "--session="+opts.UUID)
 	}
-	if opts.Filter != "" {
-		args = append(args, fmt.Sprintf("-f%s", opts.Filter))
+	if opts.SyncStart {
+		args = append(args, "--wait-start")
 	}
+	args = append(args, opts.engineArgs()...)
 
 	p := true
 	f := false
@@ -159,8 +190,8 @@ func debugPod(pod *v1.Pod, name string, opts AgentOpts) *v1.Pod {
 				AllowPrivilegeEscalation: &f,
 			},
 			Args:            args,
-			Image:           "ghcr.io/gmtstephane/kpture:latest",
-			ImagePullPolicy: v1.PullIfNotPresent,
+			Image:           opts.Image,
+			ImagePullPolicy: pullPolicy(opts.Image),
 		},
 		TargetContainerName: pod.Spec.Containers[0].Name,
 	}
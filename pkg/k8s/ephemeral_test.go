@@ -177,3 +177,88 @@ func Test_injectContainer(t *testing.T) {
 	err = injectContainer(pod, mock, opts, "1234")
 	assert.NoError(t, err)
 }
+
+func Test_agentStatus(t *testing.T) {
+	opts := LoadAgentOpts(WithAgentUUID("1234"))
+	pod := v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "testpod"}}
+
+	assert.Equal(t, AgentStatus{Pod: "testpod", State: AgentInjecting}, agentStatus(pod, opts))
+
+	pod.Status.EphemeralContainerStatuses = []v1.ContainerStatus{{
+		Name:  "kpture-1234",
+		State: v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+	}}
+	assert.Equal(t, AgentStatus{Pod: "testpod", State: AgentRunning}, agentStatus(pod, opts))
+
+	pod.Status.EphemeralContainerStatuses = []v1.ContainerStatus{{
+		Name:  "kpture-1234",
+		State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Message: "no such device"}},
+	}}
+	assert.Equal(t, AgentStatus{Pod: "testpod", State: AgentFailed, Message: "no such device"}, agentStatus(pod, opts))
+}
+
+func Test_settled(t *testing.T) {
+	assert.False(t, settled(map[string]AgentState{"a": AgentRunning}, 2))
+	assert.False(t, settled(map[string]AgentState{"a": AgentRunning, "b": AgentInjecting}, 2))
+	assert.True(t, settled(map[string]AgentState{"a": AgentRunning, "b": AgentFailed}, 2))
+}
+
+func Test_createDebugContainerStatus(t *testing.T) {
+	statuses := []AgentStatus{}
+	opts := LoadAgentOpts(WithAgentStatusHandler(func(s AgentStatus) {
+		statuses = append(statuses, s)
+	}))
+	errchan := make(chan error, 1)
+	wg := sync.WaitGroup{}
+	mock := &kubeEphemeralMock{kubeProxyHandlerMockGETState: getError}
+	pod := v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "testpod"}}
+
+	wg.Add(1)
+	createDebugContainer(pod, errchan, &wg, mock, opts)
+	assert.Equal(t, []AgentStatus{
+		{Pod: "testpod", State: AgentInjecting},
+		{Pod: "testpod", State: AgentFailed, Message: "Error getting pod"},
+	}, statuses)
+}
+
+func Test_debugPodIdentity(t *testing.T) {
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "shop"},
+		Spec:       v1.PodSpec{NodeName: "node1", Containers: []v1.Container{{Name: "api"}}},
+	}
+	args := debugPod(&pod, "kpture-1", LoadAgentOpts(WithAgentUUID("1234"))).Spec.EphemeralContainers[0].Args
+	assert.Contains(t, args, "--pod=api")
+	assert.Contains(t, args, "--namespace=shop")
+	assert.Contains(t, args, "--node=node1")
+	assert.Contains(t, args, "--session=1234")
+	assert.NotContains(t, args, "--wait-start")
+
+	args = debugPod(&pod, "kpture-1", LoadAgentOpts(WithAgentSyncStart(true))).Spec.EphemeralContainers[0].Args
+	assert.Contains(t, args, "--wait-start")
+}
+
+func Test_debugPodImage(t *testing.T) {
+	pod := v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "api"}}}}
+	eph := debugPod(&pod, "kpture-1", LoadAgentOpts()).Spec.EphemeralContainers[0]
+	assert.Equal(t, "ghcr.io/gmtstephane/kpture:latest", eph.Image)
+	assert.Equal(t, v1.PullAlways, eph.ImagePullPolicy)
+	eph = debugPod(&pod, "kpture-1", LoadAgentOpts(WithAgentImage("ghcr.io/gmtstephane/kpture:latest-nocgo"))).Spec.EphemeralContainers[0]
+	assert.Equal(t, "ghcr.io/gmtstephane/kpture:latest-nocgo", eph.Image)
+	assert.Equal(t, v1.PullAlways, eph.ImagePullPolicy)
+	eph = debugPod(&pod, "kpture-1", LoadAgentOpts(WithAgentImage("registry:5000/kpture:v1.2.0"))).Spec.EphemeralContainers[0]
+	assert.Equal(t, v1.PullIfNotPresent, eph.ImagePullPolicy)
+}
+
+func Test_pullPolicy(t *testing.T) {
+	tests := map[string]v1.PullPolicy{
+		"ghcr.io/gmtstephane/kpture":              v1.PullAlways,
+		"ghcr.io/gmtstephane/kpture:latest":       v1.PullAlways,
+		"ghcr.io/gmtstephane/kpture:latest-nocgo": v1.PullAlways,
+		"registry:5000/kpture":                    v1.PullAlways,
+		"registry:5000/kpture:v1.2.0":             v1.PullIfNotPresent,
+		"ghcr.io/gmtstephane/kpture@sha256:0123":  v1.PullIfNotPresent,
+	}
+	for image, expected := range tests {
+		assert.Equal(t, expected, pullPolicy(image), image)
+	}
+}
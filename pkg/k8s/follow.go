@@ -0,0 +1,80 @@
+package k8s
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// PodEvents are the callbacks of a pod watcher, they are called from a single goroutine.
+type PodEvents struct {
+	Running func(pod v1.Pod) // the pod is running, it may be a new pod with the name of a deleted one
+	Deleted func(pod v1.Pod) // the pod was deleted
+}
+
+// FollowPods watches the pods of the namespace matching the label and field selectors until ctx is done.
+// The pods already running are sent to events.Running when the watch starts.
+func FollowPods(ctx context.Context, client kubernetes.Interface, namespace string, events PodEvents, opts ...SelectOpt) error {
+	o := SelectOpts{}
+	for _, opt := range opts {
+		o = opt(o)
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(l *metav1.ListOptions) {
+			l.LabelSelector = o.LabelSelector
+			l.FieldSelector = o.FieldSelector
+		}),
+	)
+	informer := factory.Core().V1().Pods().Informer()
+	_, err := informer.AddEventHandler(podEventHandler(events))
+	if err != nil {
+		return err
+	}
+
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return errors.New("could not watch pods in namespace " + namespace)
+	}
+	return nil
+}
+
+// podEventHandler converts the informer notifications to pod events
+func podEventHandler(events PodEvents) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if pod, ok := obj.(*v1.Pod); ok && isRunning(pod) && events.Running != nil {
+				events.Running(*pod)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			old, okOld := oldObj.(*v1.Pod)
+			pod, ok := newObj.(*v1.Pod)
+			if !okOld || !ok || events.Running == nil {
+				return
+			}
+			if isRunning(pod) && (!isRunning(old) || old.UID != pod.UID) {
+				events.Running(*pod)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*v1.Pod); ok && events.Deleted != nil {
+				events.Deleted(*pod)
+			}
+		},
+	}
+}
+
+// isRunning returns true for running pods that are not being deleted
+func isRunning(pod *v1.Pod) bool {
+	return pod.Status.Phase == v1.PodRunning && pod.DeletionTimestamp == nil
+}
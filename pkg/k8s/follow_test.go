@@ -0,0 +1,116 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func followPod(name, uid string, phase v1.PodPhase) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns-test", UID: types.UID(uid)},
+		Status:     v1.PodStatus{Phase: phase},
+	}
+}
+
+// waitPod returns the next pod name sent on c
+func waitPod(t *testing.T, c chan string) string {
+	select {
+	case name := <-c:
+		return name
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for pod event")
+		return ""
+	}
+}
+
+func TestFollowPods(t *testing.T) {
+	client := fake.NewSimpleClientset(followPod("pod1", "1", v1.PodRunning), followPod("pod2", "2", v1.PodPending))
+	running, deleted := make(chan string, 10), make(chan string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := FollowPods(ctx, client, "ns-test", PodEvents{
+		Running: func(pod v1.Pod) { running <- pod.Name },
+		Deleted: func(pod v1.Pod) { deleted <- pod.Name },
+	})
+	assert.NoError(t, err)
+	// pods running when the watch starts
+	assert.Equal(t, "pod1", waitPod(t, running))
+
+	pods := client.CoreV1().Pods("ns-test")
+	_, err = pods.UpdateStatus(ctx, followPod("pod2", "2", v1.PodRunning), metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "pod2", waitPod(t, running))
+
+	_, err = pods.Create(ctx, followPod("pod3", "3", v1.PodRunning), metav1.CreateOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "pod3", waitPod(t, running))
+
+	assert.NoError(t, pods.Delete(ctx, "pod1", metav1.DeleteOptions{}))
+	assert.Equal(t, "pod1", waitPod(t, deleted))
+	assert.Len(t, running, 0)
+}
+
+func TestFollowPodsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := FollowPods(ctx, fake.NewSimpleClientset(), "ns-test", PodEvents{})
+	assert.Error(t, err)
+}
+
+func Test_podEventHandler(t *testing.T) {
+	running, deleted := []string{}, []string{}
+	h := podEventHandler(PodEvents{
+		Running: func(pod v1.Pod) { running = append(running, pod.Name) },
+		Deleted: func(pod v1.Pod) { deleted = append(deleted, pod.Name) },
+	})
+
+	h.OnAdd(followPod("pending", "1", v1.PodPending))
+	h.OnUpdate(followPod("pod1", "1", v1.PodRunning), followPod("pod1", "1", v1.PodRunning))
+	// the pod was recreated with the same name
+	h.OnUpdate(followPod("pod1", "1", v1.PodRunning), followPod("pod1", "2", v1.PodRunning))
+	h.OnUpdate(followPod("pod2", "3", v1.PodPending), followPod("pod2", "3", v1.PodRunning))
+	h.OnDelete(cache.DeletedFinalStateUnknown{Key: "ns-test/pod2", Obj: followPod("pod2", "3", v1.PodRunning)})
+
+	assert.Equal(t, []string{"pod1", "pod2"}, running)
+	assert.Equal(t, []string{"pod2"}, deleted)
+
+	// nil callbacks are ignored
+	h = podEventHandler(PodEvents{})
+	h.OnAdd(followPod("pod1", "1", v1.PodRunning))
+	h.OnDelete(followPod("pod1", "1", v1.PodRunning))
+}
+
+func TestMatchPod(t *testing.T) {
+	pod := workloadPods[0]
+	h := &workloadHandlerMock{}
+
+	for _, tc := range []struct {
+		args []string
+		all  bool
+		opts []SelectOpt
+		want bool
+	}{
+		{nil, true, nil, true},
+		{nil, false, nil, false},
+		{nil, false, []SelectOpt{WithLabelSelector("app=api")}, true},
+		{[]string{"api-*"}, false, nil, true},
+		{[]string{"web-*", "deployment/api"}, false, []SelectOpt{WithWorkloadHandler(h)}, true},
+		{[]string{"deployment/web"}, false, []SelectOpt{WithWorkloadHandler(h)}, false},
+	} {
+		ok, err := MatchPod(pod, tc.args, tc.all, tc.opts...)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.want, ok, tc.args)
+	}
+
+	_, err := MatchPod(pod, []string{"/api(/"}, false)
+	assert.Error(t, err)
+}
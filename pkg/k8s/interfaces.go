@@ -0,0 +1,61 @@
+package k8s
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Interface selections of the agents, besides comma separated interface names.
+const (
+	AgentAllInterfaces    = "all"    // every non-loopback interface, discovered by the agent
+	AgentMultusInterfaces = "multus" // the interfaces of the multus network status of each pod
+)
+
+// NetworkStatusAnnotation lists the networks attached to a pod by multus
+const NetworkStatusAnnotation = "k8s.v1.cni.cncf.io/network-status"
+
+// networkStatus is an entry of the multus network status annotation
+type networkStatus struct {
+	Name      string   `json:"name"`
+	Interface string   `json:"interface"`
+	IPs       []string `json:"ips"`
+	Default   bool     `json:"default"`
+}
+
+// PodInterfaces returns the interfaces of the multus network status annotation of the pod,
+// the pods without annotation have no secondary network and return nil.
+func PodInterfaces(pod v1.Pod) ([]string, error) {
+	annotation, ok := pod.Annotations[NetworkStatusAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	networks := []networkStatus{}
+	if err := json.Unmarshal([]byte(annotation), &networks); err != nil {
+		return nil, errors.New("invalid " + NetworkStatusAnnotation + " annotation of pod " + pod.Name + ": " + err.Error())
+	}
+	interfaces := []string{}
+	for _, n := range networks {
+		if n.Interface != "" && !isInArray(n.Interface, interfaces) {
+			interfaces = append(interfaces, n.Interface)
+		}
+	}
+	return interfaces, nil
+}
+
+// CheckInterfaces checks a selection of interfaces: names, AgentAllInterfaces or AgentMultusInterfaces
+func CheckInterfaces(interfaces []string) error {
+	for _, i := range interfaces {
+		switch {
+		case i == "":
+			return errors.New("empty interface name")
+		case strings.ContainsAny(i, ", "):
+			return errors.New("invalid interface name " + i)
+		case (i == AgentAllInterfaces || i == AgentMultusInterfaces) && len(interfaces) > 1:
+			return errors.New(i + " cannot be combined with other interfaces")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testNetworkStatus = `[
+  {"name": "cbr0", "interface": "eth0", "ips": ["10.244.1.4"], "default": true},
+  {"name": "default/macvlan", "interface": "net1", "ips": ["192.168.1.10"]},
+  {"name": "default/sriov", "interface": "net2"}
+]`
+
+func multusPod(annotation string) v1.Pod {
+	return v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod1", Annotations: map[string]string{NetworkStatusAnnotation: annotation}},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "pod1"}}},
+	}
+}
+
+func TestPodInterfaces(t *testing.T) {
+	interfaces, err := PodInterfaces(multusPod(testNetworkStatus))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"eth0", "net1", "net2"}, interfaces)
+
+	interfaces, err = PodInterfaces(v1.Pod{})
+	assert.NoError(t, err)
+	assert.Nil(t, interfaces)
+
+	_, err = PodInterfaces(multusPod("{"))
+	assert.Error(t, err)
+}
+
+func TestAgentDevice(t *testing.T) {
+	pod := multusPod(testNetworkStatus)
+	assert.Equal(t, "eth0", LoadAgentOpts().device(pod))
+	assert.Equal(t, "all", LoadAgentOpts(WithAgentDevice(AgentAllInterfaces)).device(pod))
+
+	opts := LoadAgentOpts(WithAgentDevice(AgentMultusInterfaces))
+	assert.Equal(t, "eth0,net1,net2", opts.device(pod))
+	assert.Equal(t, "eth0", opts.device(v1.Pod{}))
+	assert.Contains(t, debugPod(&pod, "kpture-1", opts).Spec.EphemeralContainers[0].Args, "-deth0,net1,net2")
+}
+
+func TestCheckInterfaces(t *testing.T) {
+	assert.NoError(t, CheckInterfaces([]string{"eth0", "net1"}))
+	assert.NoError(t, CheckInterfaces([]string{AgentMultusInterfaces}))
+	assert.Error(t, CheckInterfaces([]string{"eth0", AgentAllInterfaces}))
+	assert.Error(t, CheckInterfaces([]string{""}))
+	assert.Error(t, CheckInterfaces([]string{"eth0,net1"}))
+}
@@ -1,7 +1,12 @@
 package k8s
 
 import (
+	"fmt"
+	"log"
+	"strings"
 	"time"
+
+	v1 "k8s.io/api/core/v1"
 )
 
 type (
@@ -20,6 +25,7 @@ type ProxyOpts struct {
 	ServerPort   int32
 	UUID         string
 	SetupTimeout time.Duration // timeout for pod creation
+	Shared       bool          // the proxy hosts the sessions of several captures and is kept after them
 }
 
 func defaultProxyOpts() ProxyOpts {
@@ -62,6 +68,14 @@ func WithProxyServerPort(u int32) ProxyOpt {
 	}
 }
 
+// WithProxyShared creates a proxy shared by the captures of the namespace
+func WithProxyShared(shared bool) ProxyOpt {
+	return func(o ProxyOpts) ProxyOpts {
+		o.Shared = shared
+		return o
+	}
+}
+
 // Agent Options.
 const (
 	agentDdefaultSnapLen     int32         = 1500
@@ -69,19 +83,60 @@ const (
 	agentDefaultDevice       string        = "eth0"
 	agentDefaultTimeout      time.Duration = -1 * time.Second
 	agentDefaultSetupTimeout time.Duration = 20 * time.Second
+	agentDefaultImage        string        = "ghcr.io/gmtstephane/kpture:latest"
 )
 
 // AgentOpts are the options for the capture agent
 type AgentOpts struct {
 	SnapshotLen  int32         // https://www.tcpdump.org/manpages/pcap_set_snaplen.3pcap.html
 	Promiscuous  bool          // https://www.tcpdump.org/manpages/pcap_set_promisc.3pcap.html
-	Device       string        // https://www.tcpdump.org/manpages/pcap_create.3pcap.html
+	Device       string        // comma separated interfaces, AgentAllInterfaces or AgentMultusInterfaces
 	Timeout      time.Duration // https://www.tcpdump.org/manpages/pcap_set_timeout.3pcap.html
 	TargetIP     string        // proxy endpoint address to send packet via gRPC
 	TargetPort   int           // proxy endpoint port to send packet via gRPC
-	UUID         string        // kpture uuid used in  ephemeral container name
+	UUID         string        // kpture uuid used in  ephemeral container name and proxy session
 	Filter       string        // https://www.tcpdump.org/manpages/pcap_compile.3pcap.html
 	SetupTimeout time.Duration // timeout for ephemeral container injection
+	Image        string        // agent image, e.g. the latest-nocgo image without libpcap
+
+	// OnStatus is called when the state of an agent changes
+	OnStatus func(AgentStatus)
+	// PodFilter returns the capture filter of a pod, an empty filter falls back to Filter
+	PodFilter func(pod v1.Pod) string
+
+	// Engine is the agent capture engine, AgentEnginePcap or AgentEngineAFPacket, empty for the agent default
+	Engine string
+	// RingSize is the size in megabytes of the afpacket ring, 0 for the agent default
+	RingSize int
+	// BlockTimeout is the timeout of the afpacket ring blocks, 0 for the agent default
+	BlockTimeout time.Duration
+
+	// SyncStart holds the agents until the client starts the capture of all of them
+	SyncStart bool
+}
+
+// Agent capture engines.
+const (
+	AgentEnginePcap     = "pcap"
+	AgentEngineAFPacket = "afpacket"
+)
+
+// AgentState is the state of an ephemeral container agent
+type AgentState string
+
+// Agent states.
+const (
+	AgentInjecting AgentState = "injecting"
+	AgentRunning   AgentState = "running"
+	AgentFailed    AgentState = "failed"
+	AgentEnded     AgentState = "ended" // the pod was deleted during the capture
+)
+
+// AgentStatus is the state of the agent of a pod
+type AgentStatus struct {
+	Pod     string
+	State   AgentState
+	Message string // termination message of a failed agent
 }
 
 func defaultAgentOpts() AgentOpts {
@@ -91,6 +146,7 @@ func defaultAgentOpts() AgentOpts {
 		Device:       agentDefaultDevice,
 		Timeout:      agentDefaultTimeout,
 		SetupTimeout: agentDefaultSetupTimeout,
+		Image:        agentDefaultImage,
 	}
 }
 
@@ -114,7 +170,79 @@ func (a AgentOpts) WithTargetPort(p int) AgentOpts {
 	return a
 }
 
-// WithAgentDevice sets the device to capture on
+// report sends the agent status to the status handler
+func (a AgentOpts) report(s AgentStatus) {
+	if a.OnStatus != nil {
+		a.OnStatus(s)
+	}
+}
+
+// device returns the interfaces captured in the pod
+func (a AgentOpts) device(pod v1.Pod) string {
+	if a.Device != AgentMultusInterfaces {
+		return a.Device
+	}
+	// pods without secondary network only have the default interface
+	interfaces, err := PodInterfaces(pod)
+	if err != nil {
+		log.Println(err)
+	}
+	if len(interfaces) == 0 {
+		return agentDefaultDevice
+	}
+	return strings.Join(interfaces, ",")
+}
+
+// pullPolicy pulls the latest images on each start, a cached latest image could be older than
+// the cli and fail on its flags. The images with a version tag or a digest are pulled once.
+func pullPolicy(image string) v1.PullPolicy {
+	if strings.Contains(image, "@") {
+		return v1.PullIfNotPresent
+	}
+	name := image[strings.LastIndex(image, "/")+1:]
+	_, tag, found := strings.Cut(name, ":")
+	if !found || strings.HasPrefix(tag, "latest") {
+		return v1.PullAlways
+	}
+	return v1.PullIfNotPresent
+}
+
+// filter returns the capture filter of the pod
+func (a AgentOpts) filter(pod v1.Pod) string {
+	if a.PodFilter != nil {
+		if f := a.PodFilter(pod); f != "" {
+			return f
+		}
+	}
+	return a.Filter
+}
+
+// engineArgs returns the agent arguments of the capture engine
+func (a AgentOpts) engineArgs() []string {
+	var args []string
+	if a.Engine != "" {
+		args = append(args, "--engine="+a.Engine)
+	}
+	if a.RingSize > 0 {
+		args = append(args, fmt.Sprintf("--ring-size=%d", a.RingSize))
+	}
+	if a.BlockTimeout > 0 {
+		args = append(args, "--block-timeout="+a.BlockTimeout.String())
+	}
+	return args
+}
+
+// CheckEngine returns an error if the capture engine is unknown
+func CheckEngine(engine string) error {
+	switch engine {
+	case "", AgentEnginePcap, AgentEngineAFPacket:
+		return nil
+	default:
+		return fmt.Errorf("unknown capture engine %q, expected %s or %s", engine, AgentEnginePcap, AgentEngineAFPacket)
+	}
+}
+
+// WithAgentDevice sets the devices to capture on, see AgentOpts.Device
 func WithAgentDevice(n string) AgentOpt {
 	return func(o AgentOpts) AgentOpts {
 		o.Device = n
@@ -138,6 +266,14 @@ func WithAgentCaptureFilter(n string) AgentOpt {
 	}
 }
 
+// WithAgentPodFilter sets the function returning the capture filter of each pod
+func WithAgentPodFilter(f func(pod v1.Pod) string) AgentOpt {
+	return func(o AgentOpts) AgentOpts {
+		o.PodFilter = f
+		return o
+	}
+}
+
 // WithAgentSnapLen sets the snapshot length
 func WithAgentSnapLen(n int32) AgentOpt {
 	return func(o AgentOpts) AgentOpts {
@@ -162,6 +298,46 @@ func WithAgentSetupTimeOut(n time.Duration) AgentOpt {
 	}
 }
 
+// WithAgentImage sets the agent container image
+func WithAgentImage(image string) AgentOpt {
+	return func(o AgentOpts) AgentOpts {
+		o.Image = image
+		return o
+	}
+}
+
+// WithAgentEngine sets the agent capture engine
+func WithAgentEngine(e string) AgentOpt {
+	return func(o AgentOpts) AgentOpts {
+		o.Engine = e
+		return o
+	}
+}
+
+// WithAgentRingSize sets the size in megabytes of the afpacket ring
+func WithAgentRingSize(n int) AgentOpt {
+	return func(o AgentOpts) AgentOpts {
+		o.RingSize = n
+		return o
+	}
+}
+
+// WithAgentBlockTimeout sets the timeout of the afpacket ring blocks
+func WithAgentBlockTimeout(n time.Duration) AgentOpt {
+	return func(o AgentOpts) AgentOpts {
+		o.BlockTimeout = n
+		return o
+	}
+}
+
+// WithAgentSyncStart holds the agents until the client starts the capture
+func WithAgentSyncStart(sync bool) AgentOpt {
+	return func(o AgentOpts) AgentOpts {
+		o.SyncStart = sync
+		return o
+	}
+}
+
 // WithAgentUUID sets the agent uuid
 func WithAgentUUID(u string) AgentOpt {
 	return func(o AgentOpts) AgentOpts {
@@ -169,3 +345,11 @@ func WithAgentUUID(u string) AgentOpt {
 		return o
 	}
 }
+
+// WithAgentStatusHandler sets the function called when the state of an agent changes
+func WithAgentStatusHandler(f func(AgentStatus)) AgentOpt {
+	return func(o AgentOpts) AgentOpts {
+		o.OnStatus = f
+		return o
+	}
+}
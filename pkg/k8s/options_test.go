@@ -1,10 +1,13 @@
 package k8s
 
 import (
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func Test_defaultProxyOpts(t *testing.T) {
@@ -59,3 +62,43 @@ func TestLoadAgentOpts(t *testing.T) {
 	assert.Equal(t, opts.TargetIP, "localhost")
 	assert.Equal(t, opts.TargetPort, 8080)
 }
+
+func TestAgentPodFilter(t *testing.T) {
+	opts := LoadAgentOpts(WithAgentCaptureFilter("tcp"))
+	api := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "api"},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "api"}}},
+	}
+	db := v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "db"}}
+	assert.Equal(t, "tcp", opts.filter(api))
+
+	opts = LoadAgentOpts(WithAgentCaptureFilter("tcp"), WithAgentPodFilter(func(pod v1.Pod) string {
+		if pod.Name == "api" {
+			return "port 8080"
+		}
+		return ""
+	}))
+	assert.Equal(t, "port 8080", opts.filter(api))
+	assert.Equal(t, "tcp", opts.filter(db))
+	assert.Contains(t, debugPod(&api, "kpture-1", opts).Spec.EphemeralContainers[0].Args, "-fport 8080")
+}
+
+func TestAgentEngine(t *testing.T) {
+	pod := v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "api"}}}}
+	args := debugPod(&pod, "kpture-1", LoadAgentOpts()).Spec.EphemeralContainers[0].Args
+	assert.NotContains(t, strings.Join(args, " "), "--engine")
+
+	opts := LoadAgentOpts(
+		WithAgentEngine(AgentEngineAFPacket),
+		WithAgentRingSize(64),
+		WithAgentBlockTimeout(10*time.Millisecond),
+	)
+	args = debugPod(&pod, "kpture-1", opts).Spec.EphemeralContainers[0].Args
+	assert.Contains(t, args, "--engine=afpacket")
+	assert.Contains(t, args, "--ring-size=64")
+	assert.Contains(t, args, "--block-timeout=10ms")
+
+	assert.NoError(t, CheckEngine(""))
+	assert.NoError(t, CheckEngine(AgentEngineAFPacket))
+	assert.Error(t, CheckEngine("dpdk"))
+}
@@ -2,6 +2,7 @@ package k8s
 
 import (
 	"context"
+	"fmt"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -11,6 +12,14 @@ import (
 const (
 	readinessProbeInitialDelay = int32(5)
 	livenessProbeInitialDelay  = int32(10)
+	proxyImage                 = "ghcr.io/gmtstephane/kpture_proxy:latest"
+)
+
+// Labels of the proxy pods, the shared proxies are reused by the captures of their namespace.
+const (
+	ProxyNameLabel   = "app.kubernetes.io/name"
+	ProxyName        = "kpture-proxy"
+	ProxySharedLabel = "kpture.io/shared"
 )
 
 type KubeProxyHandler interface {
@@ -19,17 +28,31 @@ type KubeProxyHandler interface {
 	Create(ctx context.Context, pod *v1.Pod, opts metav1.CreateOptions) (*v1.Pod, error)
 }
 
+// ProxyPodName returns the name of the proxy pod created by the kpture id
+func ProxyPodName(id string) string {
+	return "kpture-proxy-" + id
+}
+
 // SetupProxy create the debug container in all the pods
 func SetupProxy(h KubeProxyHandler, opts ProxyOpts) (string, error) {
-	name := "kpture-proxy-" + opts.UUID
+	name := ProxyPodName(opts.UUID)
+	labels := map[string]string{ProxyNameLabel: ProxyName}
+	// a proxy which is not shared exits when its session ends
+	restart := v1.RestartPolicyOnFailure
+	if opts.Shared {
+		labels[ProxySharedLabel] = "true"
+		restart = v1.RestartPolicyAlways
+	}
 	pod := v1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: name,
+			Name:   name,
+			Labels: labels,
 		},
 		Spec: v1.PodSpec{
 			Containers: []v1.Container{
 				container(opts),
 			},
+			RestartPolicy: restart,
 		},
 	}
 	_, err := h.Create(context.TODO(), &pod, metav1.CreateOptions{})
@@ -57,20 +80,53 @@ func SetupProxy(h KubeProxyHandler, opts ProxyOpts) (string, error) {
 
 // TearDownProxy delete the debug container
 func TearDownProxy(id string, h KubeProxyHandler) error {
-	err := h.Delete(context.Background(), "kpture-proxy-"+id, metav1.DeleteOptions{})
+	err := h.Delete(context.Background(), ProxyPodName(id), metav1.DeleteOptions{})
 	if err != nil && !errors.IsNotFound(err) {
 		return err
 	}
 	return nil
 }
 
+// FindSharedProxy returns a running shared proxy pod, nil if there is none
+func FindSharedProxy(h PodLister) (*v1.Pod, error) {
+	pods, err := h.List(context.Background(), metav1.ListOptions{
+		LabelSelector: ProxyNameLabel + "=" + ProxyName + "," + ProxySharedLabel + "=true",
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp == nil && pod.Status.Phase == v1.PodRunning && pod.Status.PodIP != "" {
+			return pod, nil
+		}
+	}
+	return nil, nil
+}
+
+// ProxyPort returns the grpc port of a proxy pod
+func ProxyPort(pod v1.Pod) int32 {
+	for _, c := range pod.Spec.Containers {
+		for _, p := range c.Ports {
+			if p.Name == "grpc" {
+				return p.ContainerPort
+			}
+		}
+	}
+	return proxyDefaultServerPort
+}
+
 // container create the container
 func container(opts ProxyOpts) v1.Container {
+	args := []string{"proxy", fmt.Sprintf("--port=%d", opts.ServerPort)}
+	if opts.Shared {
+		args = append(args, "--shared")
+	}
 	return v1.Container{
 		Name:            "kpture-proxy",
-		ImagePullPolicy: v1.PullIfNotPresent,
-		Image:           "ghcr.io/gmtstephane/kpture_proxy:latest",
-		Args:            []string{"proxy"},
+		ImagePullPolicy: pullPolicy(proxyImage),
+		Image:           proxyImage,
+		Args:            args,
 		Ports: []v1.ContainerPort{
 			{
 				Name:          "grpc",
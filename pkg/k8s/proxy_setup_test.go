@@ -9,6 +9,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 type kubeProxyHandlerMock struct {
@@ -88,3 +89,51 @@ func TestTearDownProxy(t *testing.T) {
 	err = TearDownProxy("1234", mock)
 	assert.NoError(t, err)
 }
+
+func TestSetupSharedProxy(t *testing.T) {
+	mock := &kubeProxyHandlerMock{}
+	mock.kubeProxyHandlerMockGETState = getOK
+	_, err := SetupProxy(mock, LoadProxyOpts(WithProxyUUID("1234")))
+	assert.NoError(t, err)
+	assert.Equal(t, "kpture-proxy-1234", mock.createdPod.Name)
+	assert.Equal(t, map[string]string{ProxyNameLabel: ProxyName}, mock.createdPod.Labels)
+	assert.Equal(t, []string{"proxy", "--port=10000"}, mock.createdPod.Spec.Containers[0].Args)
+	assert.Equal(t, v1.RestartPolicyOnFailure, mock.createdPod.Spec.RestartPolicy)
+
+	_, err = SetupProxy(mock, LoadProxyOpts(WithProxyUUID("1234"), WithProxyShared(true)))
+	assert.NoError(t, err)
+	assert.Equal(t, "true", mock.createdPod.Labels[ProxySharedLabel])
+	assert.Equal(t, []string{"proxy", "--port=10000", "--shared"}, mock.createdPod.Spec.Containers[0].Args)
+	assert.Equal(t, v1.RestartPolicyAlways, mock.createdPod.Spec.RestartPolicy)
+	assert.Equal(t, proxyDefaultServerPort, ProxyPort(*mock.createdPod))
+
+	// the proxy listens on the configured port
+	_, err = SetupProxy(mock, LoadProxyOpts(WithProxyUUID("1234"), WithProxyServerPort(11000)))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"proxy", "--port=11000"}, mock.createdPod.Spec.Containers[0].Args)
+	assert.Equal(t, int32(11000), ProxyPort(*mock.createdPod))
+}
+
+func TestFindSharedProxy(t *testing.T) {
+	proxy := func(name string, shared bool, phase v1.PodPhase) *v1.Pod {
+		pod := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{ProxyNameLabel: ProxyName}},
+			Spec:       v1.PodSpec{Containers: []v1.Container{container(LoadProxyOpts(WithProxyServerPort(11000)))}},
+			Status:     v1.PodStatus{Phase: phase, PodIP: "10.0.0.1"},
+		}
+		if shared {
+			pod.Labels[ProxySharedLabel] = "true"
+		}
+		return pod
+	}
+	pods := fake.NewSimpleClientset(proxy("kpture-proxy-1", false, v1.PodRunning), proxy("kpture-proxy-2", true, v1.PodPending)).CoreV1().Pods("default")
+	pod, err := FindSharedProxy(pods)
+	assert.NoError(t, err)
+	assert.Nil(t, pod)
+
+	pods = fake.NewSimpleClientset(proxy("kpture-proxy-1", false, v1.PodRunning), proxy("kpture-proxy-3", true, v1.PodRunning)).CoreV1().Pods("default")
+	pod, err = FindSharedProxy(pods)
+	assert.NoError(t, err)
+	assert.Equal(t, "kpture-proxy-3", pod.Name)
+	assert.Equal(t, int32(11000), ProxyPort(*pod))
+}
@@ -0,0 +1,242 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// maxAgentRestarts stops re-attaching an agent that keeps terminating
+const maxAgentRestarts = 5
+
+// AgentRestart describes an agent injected again in a pod
+type AgentRestart struct {
+	Pod       v1.Pod    // the pod, recreated pods have a new uid
+	Agent     string    // name of the new ephemeral container
+	Lost      time.Time // the previous agent stopped capturing
+	Restarted time.Time // the new agent was injected
+	Reason    string
+}
+
+// supervised is the agent of a captured pod
+type supervised struct {
+	uid        types.UID
+	generation int
+	name       string
+	running    bool
+	failed     bool
+	ended      bool
+}
+
+// Supervisor re-attaches agents when they terminate or when their pod is recreated.
+// New agents are named kpture-<uuid>-<n>, n being the number of restarts of the pod agent.
+type Supervisor struct {
+	mu        sync.Mutex
+	h         KubeEphemeralHandler
+	opts      AgentOpts
+	agents    map[string]*supervised
+	onRestart func(AgentRestart)
+	onEnd     func(pod string)
+	now       func() time.Time
+}
+
+// NewSupervisor creates a supervisor, onRestart is called after each new agent injection
+// and onEnd when a pod is deleted or completed.
+func NewSupervisor(h KubeEphemeralHandler, opts AgentOpts, onRestart func(AgentRestart), onEnd func(pod string)) *Supervisor {
+	return &Supervisor{
+		h:         h,
+		opts:      opts,
+		agents:    map[string]*supervised{},
+		onRestart: onRestart,
+		onEnd:     onEnd,
+		now:       time.Now,
+	}
+}
+
+// Track supervises pods whose first agent is already injected.
+func (s *Supervisor) Track(pods []v1.Pod) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, pod := range pods {
+		s.agents[pod.Name] = &supervised{uid: pod.UID, name: agentName(s.opts.UUID, 0)}
+	}
+}
+
+// Supervised returns true when the pod, or a previous pod with the same name, is supervised.
+func (s *Supervisor) Supervised(pod v1.Pod) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.agents[pod.Name]
+	return ok
+}
+
+// Run checks the agents every second until ctx is done.
+func (s *Supervisor) Run(ctx context.Context) {
+	ticker := time.NewTicker(defaultPolling)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		list, err := s.h.List(ctx, metav1.ListOptions{})
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Println(err)
+			}
+			continue
+		}
+		s.check(ctx, list.Items)
+	}
+}
+
+// restart is an agent injection planned by check
+type restart struct {
+	pod        v1.Pod
+	generation int
+	name       string
+	lost       time.Time
+	reason     string
+}
+
+// plan are the changes found by check, applied once the lock is released
+type plan struct {
+	ended    []string
+	statuses []AgentStatus
+	restarts []restart
+}
+
+// check re-attaches the terminated agents and the agents of recreated pods,
+// the pods deleted or completed are ended until they run again.
+// The agents state is updated under the lock, the agents are injected and the pod ends reported after.
+func (s *Supervisor) check(ctx context.Context, pods []v1.Pod) {
+	p := s.update(pods)
+	for _, status := range p.statuses {
+		s.opts.report(status)
+	}
+	for _, name := range p.ended {
+		if s.onEnd != nil {
+			s.onEnd(name)
+		}
+	}
+	for _, r := range p.restarts {
+		if ctx.Err() != nil {
+			return
+		}
+		s.restart(r)
+	}
+}
+
+// update updates the agents state from the pods, it returns the ended pods,
+// the status changes and the agents to inject
+func (s *Supervisor) update(pods []v1.Pod) *plan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := &plan{}
+
+	listed := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		listed[pod.Name] = pod.Status.Phase != v1.PodSucceeded && pod.Status.Phase != v1.PodFailed
+	}
+	for name, a := range s.agents {
+		if !listed[name] && !a.ended {
+			a.ended = true
+			p.statuses = append(p.statuses, AgentStatus{Pod: name, State: AgentEnded})
+			p.ended = append(p.ended, name)
+		}
+	}
+
+	for _, pod := range pods {
+		a, ok := s.agents[pod.Name]
+		if !ok || a.failed || pod.Status.Phase != v1.PodRunning || pod.DeletionTimestamp != nil {
+			continue
+		}
+		a.ended = false
+
+		if pod.UID != a.uid {
+			s.next(p, pod, a, s.now(), "pod recreated")
+			continue
+		}
+		status := containerStatus(pod, a.name)
+		switch {
+		case status == nil:
+		case status.State.Terminated != nil:
+			t := status.State.Terminated
+			reason := fmt.Sprintf("agent %s terminated with exit code %d", a.name, t.ExitCode)
+			if t.Message != "" {
+				reason += ": " + t.Message
+			}
+			s.next(p, pod, a, t.FinishedAt.Time, reason)
+		case status.State.Running != nil && !a.running:
+			a.running = true
+			p.statuses = append(p.statuses, AgentStatus{Pod: pod.Name, State: AgentRunning})
+		}
+	}
+	return p
+}
+
+// next moves the agent of a pod to its next generation, the agent fails after maxAgentRestarts. mu must be held
+func (s *Supervisor) next(p *plan, pod v1.Pod, a *supervised, lost time.Time, reason string) {
+	if a.generation >= maxAgentRestarts {
+		a.failed = true
+		p.statuses = append(p.statuses, AgentStatus{Pod: pod.Name, State: AgentFailed, Message: reason})
+		log.Println("giving up capture of pod " + pod.Name + " after " + fmt.Sprint(maxAgentRestarts) + " restarts: " + reason)
+		return
+	}
+
+	a.generation++
+	a.uid = pod.UID
+	a.name = agentName(s.opts.UUID, a.generation)
+	a.running = false
+	p.restarts = append(p.restarts, restart{pod: pod, generation: a.generation, name: a.name, lost: lost, reason: reason})
+}
+
+// restart injects the next agent of a pod
+func (s *Supervisor) restart(r restart) {
+	log.Println("re-attaching agent " + r.name + " to pod " + r.pod.Name + ", " + r.reason)
+	s.opts.report(AgentStatus{Pod: r.pod.Name, State: AgentInjecting, Message: r.reason})
+
+	if err := injectContainer(r.pod, s.h, s.opts, agentID(s.opts.UUID, r.generation)); err != nil {
+		s.mu.Lock()
+		if a, ok := s.agents[r.pod.Name]; ok && a.generation == r.generation {
+			a.failed = true
+		}
+		s.mu.Unlock()
+		s.opts.report(AgentStatus{Pod: r.pod.Name, State: AgentFailed, Message: err.Error()})
+		log.Println(err)
+		return
+	}
+	if s.onRestart != nil {
+		s.onRestart(AgentRestart{Pod: r.pod, Agent: r.name, Lost: r.lost, Restarted: s.now(), Reason: r.reason})
+	}
+}
+
+// agentID returns the id of the agent container after n restarts
+func agentID(uuid string, n int) string {
+	if n == 0 {
+		return uuid
+	}
+	return fmt.Sprintf("%s-%d", uuid, n)
+}
+
+// agentName returns the name of the agent container after n restarts
+func agentName(uuid string, n int) string {
+	return "kpture-" + agentID(uuid, n)
+}
+
+// containerStatus returns the status of an ephemeral container
+func containerStatus(pod v1.Pod, name string) *v1.ContainerStatus {
+	for i, eph := range pod.Status.EphemeralContainerStatuses {
+		if eph.Name == name {
+			return &pod.Status.EphemeralContainerStatuses[i]
+		}
+	}
+	return nil
+}
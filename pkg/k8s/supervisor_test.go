@@ -0,0 +1,127 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// supervisedPod returns a running pod with the state of its agent container
+func supervisedPod(uid string, agent string, state v1.ContainerState) v1.Pod {
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "testpod", UID: types.UID(uid)},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "container-test"}}},
+		Status:     v1.PodStatus{Phase: v1.PodRunning},
+	}
+	if agent != "" {
+		pod.Status.EphemeralContainerStatuses = []v1.ContainerStatus{{Name: agent, State: state}}
+	}
+	return pod
+}
+
+func TestSupervisor(t *testing.T) {
+	finished := time.Unix(1678000000, 0)
+	now := finished.Add(3 * time.Second)
+	running := v1.ContainerState{Running: &v1.ContainerStateRunning{}}
+	terminated := v1.ContainerState{Terminated: &v1.ContainerStateTerminated{
+		ExitCode:   1,
+		Message:    "proxy unreachable",
+		FinishedAt: metav1.NewTime(finished),
+	}}
+
+	statuses := []AgentStatus{}
+	restarts := []AgentRestart{}
+	mock := &kubeEphemeralMock{kubeProxyHandlerMockGETState: getOKNoEph, kubeProxyHandlerMockUpdateEphState: updateEphOK}
+	opts := LoadAgentOpts(WithAgentUUID("1234"), WithAgentStatusHandler(func(s AgentStatus) {
+		statuses = append(statuses, s)
+	}))
+	s := NewSupervisor(mock, opts, func(r AgentRestart) { restarts = append(restarts, r) }, nil)
+	s.now = func() time.Time { return now }
+	s.Track([]v1.Pod{supervisedPod("1", "", v1.ContainerState{})})
+	assert.True(t, s.Supervised(supervisedPod("2", "", v1.ContainerState{})))
+
+	ctx := context.Background()
+	s.check(ctx, []v1.Pod{supervisedPod("1", "kpture-1234", running)})
+	assert.Equal(t, []AgentStatus{{Pod: "testpod", State: AgentRunning}}, statuses)
+	assert.Empty(t, restarts)
+
+	// the agent terminated
+	s.check(ctx, []v1.Pod{supervisedPod("1", "kpture-1234", terminated)})
+	assert.Len(t, restarts, 1)
+	assert.Equal(t, "kpture-1234-1", restarts[0].Agent)
+	assert.Equal(t, finished, restarts[0].Lost)
+	assert.Equal(t, now, restarts[0].Restarted)
+	assert.Equal(t, "agent kpture-1234 terminated with exit code 1: proxy unreachable", restarts[0].Reason)
+	eph := mock.updatedpod.Spec.EphemeralContainers
+	assert.Equal(t, "kpture-1234-1", eph[len(eph)-1].Name)
+
+	// the pod was recreated
+	s.check(ctx, []v1.Pod{supervisedPod("2", "", v1.ContainerState{})})
+	assert.Len(t, restarts, 2)
+	assert.Equal(t, "kpture-1234-2", restarts[1].Agent)
+	assert.Equal(t, "pod recreated", restarts[1].Reason)
+
+	// unknown and pending pods are ignored
+	other := supervisedPod("3", "", v1.ContainerState{})
+	other.Name = "other"
+	pending := supervisedPod("4", "", v1.ContainerState{})
+	pending.Status.Phase = v1.PodPending
+	s.check(ctx, []v1.Pod{other, pending})
+	assert.Len(t, restarts, 2)
+
+	// agents terminating again and again are given up
+	for i := 0; i < maxAgentRestarts+2; i++ {
+		s.check(ctx, []v1.Pod{supervisedPod("2", agentName("1234", s.agents["testpod"].generation), terminated)})
+	}
+	assert.Len(t, restarts, maxAgentRestarts)
+	assert.Equal(t, AgentFailed, statuses[len(statuses)-1].State)
+}
+
+func TestSupervisorEnded(t *testing.T) {
+	ended := []string{}
+	mock := &kubeEphemeralMock{kubeProxyHandlerMockGETState: getOKNoEph, kubeProxyHandlerMockUpdateEphState: updateEphOK}
+	var s *Supervisor
+	// the callbacks are called without the supervisor lock
+	s = NewSupervisor(mock, LoadAgentOpts(WithAgentUUID("1234")), nil, func(pod string) {
+		assert.True(t, s.Supervised(supervisedPod("1", "", v1.ContainerState{})))
+		ended = append(ended, pod)
+	})
+	s.Track([]v1.Pod{supervisedPod("1", "", v1.ContainerState{})})
+
+	// deleted and completed pods are ended once
+	ctx := context.Background()
+	s.check(ctx, nil)
+	s.check(ctx, nil)
+	assert.Equal(t, []string{"testpod"}, ended)
+	s.check(ctx, []v1.Pod{supervisedPod("1", "", v1.ContainerState{})})
+	completed := supervisedPod("1", "", v1.ContainerState{})
+	completed.Status.Phase = v1.PodSucceeded
+	s.check(ctx, []v1.Pod{completed})
+	assert.Equal(t, []string{"testpod", "testpod"}, ended)
+}
+
+func TestSupervisorInjectError(t *testing.T) {
+	mock := &kubeEphemeralMock{kubeProxyHandlerMockGETState: getError}
+	s := NewSupervisor(mock, LoadAgentOpts(WithAgentUUID("1234")), nil, nil)
+	s.Track([]v1.Pod{supervisedPod("1", "", v1.ContainerState{})})
+	s.check(context.Background(), []v1.Pod{supervisedPod("2", "", v1.ContainerState{})})
+	assert.True(t, s.agents["testpod"].failed)
+}
+
+func TestSupervisorRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s := NewSupervisor(&kubeEphemeralMock{}, LoadAgentOpts(), nil, nil)
+	// returns when the context is done
+	s.Run(ctx)
+}
+
+func Test_agentName(t *testing.T) {
+	assert.Equal(t, "kpture-1234", agentName("1234", 0))
+	assert.Equal(t, "kpture-1234-2", agentName("1234", 2))
+}
@@ -33,6 +33,7 @@ const (
 	listUnkown kubeProxyHandlerMockLISTState = 0
 	listOK     kubeProxyHandlerMockLISTState = 1
 	listError  kubeProxyHandlerMockLISTState = 2
+	listEmpty  kubeProxyHandlerMockLISTState = 3
 )
 
 const (
@@ -0,0 +1,160 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Workload kinds, as found in the owner references of pods.
+const (
+	KindPod         = "Pod"
+	KindDeployment  = "Deployment"
+	KindReplicaSet  = "ReplicaSet"
+	KindStatefulSet = "StatefulSet"
+	KindDaemonSet   = "DaemonSet"
+	KindJob         = "Job"
+	KindService     = "Service"
+)
+
+// kindAliases maps the kubectl names of the workloads to their kind
+var kindAliases = map[string]string{
+	"po": KindPod, "pod": KindPod, "pods": KindPod,
+	"deploy": KindDeployment, "deployment": KindDeployment, "deployments": KindDeployment,
+	"rs": KindReplicaSet, "replicaset": KindReplicaSet, "replicasets": KindReplicaSet,
+	"sts": KindStatefulSet, "statefulset": KindStatefulSet, "statefulsets": KindStatefulSet,
+	"ds": KindDaemonSet, "daemonset": KindDaemonSet, "daemonsets": KindDaemonSet,
+	"job": KindJob, "jobs": KindJob,
+	"svc": KindService, "service": KindService, "services": KindService,
+}
+
+// Workload is a kind/name capture target
+type Workload struct {
+	Kind string
+	Name string
+}
+
+func (w Workload) String() string {
+	return strings.ToLower(w.Kind) + "/" + w.Name
+}
+
+// ParseWorkload parses a kind/name argument, ok is false for pod names and patterns.
+func ParseWorkload(s string) (w Workload, ok bool, err error) {
+	kind, name, found := strings.Cut(s, "/")
+	// regexps are written between slashes
+	if !found || kind == "" {
+		return Workload{}, false, nil
+	}
+	k, known := kindAliases[strings.ToLower(kind)]
+	if !known {
+		return Workload{}, false, errors.New("unsupported kind " + kind + " in " + s +
+			", must be pod, deployment, replicaset, statefulset, daemonset, job or service")
+	}
+	if name == "" {
+		return Workload{}, false, errors.New("missing name in " + s)
+	}
+	return Workload{Kind: k, Name: name}, true, nil
+}
+
+// WorkloadHandler lists the objects linking workloads to their pods
+type WorkloadHandler interface {
+	ReplicaSets(ctx context.Context) ([]appsv1.ReplicaSet, error)
+	EndpointSlices(ctx context.Context, service string) ([]discoveryv1.EndpointSlice, error)
+}
+
+// kubeWorkloadHandler is the WorkloadHandler of a namespace
+type kubeWorkloadHandler struct {
+	client    kubernetes.Interface
+	namespace string
+}
+
+// NewWorkloadHandler returns a WorkloadHandler querying the namespace
+func NewWorkloadHandler(client kubernetes.Interface, namespace string) WorkloadHandler {
+	return &kubeWorkloadHandler{client: client, namespace: namespace}
+}
+
+func (k *kubeWorkloadHandler) ReplicaSets(ctx context.Context) ([]appsv1.ReplicaSet, error) {
+	list, err := k.client.AppsV1().ReplicaSets(k.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func (k *kubeWorkloadHandler) EndpointSlices(ctx context.Context, service string) ([]discoveryv1.EndpointSlice, error) {
+	list, err := k.client.DiscoveryV1().EndpointSlices(k.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: discoveryv1.LabelServiceName + "=" + service,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// workloadMatcher returns a function matching the pods of a workload
+func workloadMatcher(w Workload, h WorkloadHandler) (func(v1.Pod) bool, error) {
+	switch w.Kind {
+	case KindPod:
+		return func(p v1.Pod) bool { return p.Name == w.Name }, nil
+	case KindReplicaSet, KindStatefulSet, KindDaemonSet, KindJob:
+		return func(p v1.Pod) bool { return isOwnedBy(p.OwnerReferences, w.Kind, w.Name) }, nil
+	}
+
+	if h == nil {
+		return nil, errors.New("cannot resolve " + w.String() + " without a workload handler")
+	}
+	switch w.Kind {
+	case KindDeployment:
+		// deployment pods are owned by its replicasets
+		rs, err := h.ReplicaSets(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		owned := []string{}
+		for _, r := range rs {
+			if isOwnedBy(r.OwnerReferences, KindDeployment, w.Name) {
+				owned = append(owned, r.Name)
+			}
+		}
+		return func(p v1.Pod) bool {
+			for _, r := range owned {
+				if isOwnedBy(p.OwnerReferences, KindReplicaSet, r) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case KindService:
+		slices, err := h.EndpointSlices(context.Background(), w.Name)
+		if err != nil {
+			return nil, err
+		}
+		endpoints := []string{}
+		for _, s := range slices {
+			for _, e := range s.Endpoints {
+				if e.TargetRef != nil && e.TargetRef.Kind == KindPod {
+					endpoints = append(endpoints, e.TargetRef.Name)
+				}
+			}
+		}
+		return func(p v1.Pod) bool { return isInArray(p.Name, endpoints) }, nil
+	default:
+		return nil, errors.New("unsupported kind " + w.Kind)
+	}
+}
+
+// isOwnedBy checks if the owner references contain the kind/name owner
+func isOwnedBy(refs []metav1.OwnerReference, kind, name string) bool {
+	for _, r := range refs {
+		if r.Kind == kind && r.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type workloadHandlerMock struct {
+	err error
+}
+
+func (w *workloadHandlerMock) ReplicaSets(ctx context.Context) ([]appsv1.ReplicaSet, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	return []appsv1.ReplicaSet{
+		{ObjectMeta: metav1.ObjectMeta{Name: "api-5d4f", OwnerReferences: owner(KindDeployment, "api")}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "web-7b8c", OwnerReferences: owner(KindDeployment, "web")}},
+	}, nil
+}
+
+func (w *workloadHandlerMock) EndpointSlices(ctx context.Context, service string) ([]discoveryv1.EndpointSlice, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	if service != "redis" {
+		return nil, nil
+	}
+	return []discoveryv1.EndpointSlice{{
+		Endpoints: []discoveryv1.Endpoint{
+			{TargetRef: &v1.ObjectReference{Kind: KindPod, Name: "redis-0"}},
+			{TargetRef: &v1.ObjectReference{Kind: "Node", Name: "node1"}},
+			{},
+		},
+	}}, nil
+}
+
+func owner(kind, name string) []metav1.OwnerReference {
+	return []metav1.OwnerReference{{Kind: kind, Name: name}}
+}
+
+var workloadPods = []v1.Pod{
+	{ObjectMeta: metav1.ObjectMeta{Name: "api-5d4f-x1", OwnerReferences: owner(KindReplicaSet, "api-5d4f")}},
+	{ObjectMeta: metav1.ObjectMeta{Name: "api-5d4f-x2", OwnerReferences: owner(KindReplicaSet, "api-5d4f")}},
+	{ObjectMeta: metav1.ObjectMeta{Name: "web-7b8c-y1", OwnerReferences: owner(KindReplicaSet, "web-7b8c")}},
+	{ObjectMeta: metav1.ObjectMeta{Name: "redis-0", OwnerReferences: owner(KindStatefulSet, "redis")}},
+	{ObjectMeta: metav1.ObjectMeta{Name: "agent-z", OwnerReferences: owner(KindDaemonSet, "agent")}},
+	{ObjectMeta: metav1.ObjectMeta{Name: "migrate-q", OwnerReferences: owner(KindJob, "migrate")}},
+}
+
+type workloadPodLister struct{}
+
+func (workloadPodLister) List(ctx context.Context, opts metav1.ListOptions) (*v1.PodList, error) {
+	return &v1.PodList{Items: workloadPods}, nil
+}
+
+func TestParseWorkload(t *testing.T) {
+	w, ok, err := ParseWorkload("deploy/api")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Workload{Kind: KindDeployment, Name: "api"}, w)
+	assert.Equal(t, "deployment/api", w.String())
+
+	w, ok, err = ParseWorkload("SVC/redis")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Workload{Kind: KindService, Name: "redis"}, w)
+
+	for _, s := range []string{"api-5d4f-x1", "api-*", "/^api/"} {
+		_, ok, err = ParseWorkload(s)
+		assert.NoError(t, err)
+		assert.False(t, ok, s)
+	}
+
+	_, _, err = ParseWorkload("cronjob/nightly")
+	assert.Error(t, err)
+	_, _, err = ParseWorkload("deployment/")
+	assert.Error(t, err)
+}
+
+func TestSelectPodsWorkloads(t *testing.T) {
+	h := &workloadHandlerMock{}
+	names := func(pods []v1.Pod) []string {
+		n := []string{}
+		for _, p := range pods {
+			n = append(n, p.Name)
+		}
+		return n
+	}
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"deployment/api"}, []string{"api-5d4f-x1", "api-5d4f-x2"}},
+		{[]string{"svc/redis"}, []string{"redis-0"}},
+		{[]string{"sts/redis", "ds/agent"}, []string{"redis-0", "agent-z"}},
+		{[]string{"job/migrate", "web-*"}, []string{"migrate-q", "web-7b8c-y1"}},
+		{[]string{"rs/web-7b8c", "pod/redis-0", "svc/redis"}, []string{"web-7b8c-y1", "redis-0"}},
+	}
+	for _, tt := range tests {
+		pods, err := SelectPods(tt.args, false, workloadPodLister{}, WithWorkloadHandler(h))
+		assert.NoError(t, err, tt.args)
+		assert.Equal(t, tt.want, names(pods), tt.args)
+	}
+
+	_, err := SelectPods([]string{"deployment/db"}, false, workloadPodLister{}, WithWorkloadHandler(h))
+	assert.EqualError(t, err, "no pod matches deployment/db")
+
+	_, err = SelectPods([]string{"svc/redis"}, false, workloadPodLister{})
+	assert.Error(t, err)
+
+	h.err = errors.New("forbidden")
+	_, err = SelectPods([]string{"deployment/api"}, false, workloadPodLister{}, WithWorkloadHandler(h))
+	assert.EqualError(t, err, "forbidden")
+}
@@ -0,0 +1,363 @@
+// Package profile loads the yaml capture profiles.
+//
+// A profile describes the pods to capture, their filters, the agent and proxy settings,
+// the output files and the stop conditions of a capture:
+//
+//	version: kpture/v1
+//	namespace: default
+//	targets:
+//	  - pods: [deployment/api]
+//	    filter: port 8080
+//	  - pods: ["redis-*"]
+//	filter: not port 22
+//	agent:
+//	  snaplen: 1500
+//	  interfaces: [eth0, net1]
+//	output:
+//	  dir: capture
+//	  format: pcapng
+//	rotation:
+//	  maxSize: 100
+//	  count: 10
+//	stop:
+//	  duration: 5m
+package profile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gmtstephane/kpture/pkg/filter"
+	"github.com/gmtstephane/kpture/pkg/k8s"
+	"github.com/gmtstephane/kpture/pkg/sink"
+	"gopkg.in/yaml.v3"
+)
+
+// Version is the supported profile schema version
+const Version = "kpture/v1"
+
+// Profile is a capture profile
+type Profile struct {
+	Version       string   `yaml:"version"`
+	Namespace     string   `yaml:"namespace"`
+	All           bool     `yaml:"all"`           // capture all the pods of the namespace
+	Selector      string   `yaml:"selector"`      // label selector
+	FieldSelector string   `yaml:"fieldSelector"` // field selector
+	Follow        bool     `yaml:"follow"`        // capture the matching pods starting during the capture
+	Targets       []Target `yaml:"targets"`
+	Filter        string   `yaml:"filter"` // capture filter of the pods without target filter
+	Agent         Agent    `yaml:"agent"`
+	Proxy         Proxy    `yaml:"proxy"`
+	Output        Output   `yaml:"output"`
+	Rotation      Rotation `yaml:"rotation"`
+	Stop          Stop     `yaml:"stop"`
+}
+
+// Target selects pods by name, glob, /regexp/ or kind/name, with an optional filter
+type Target struct {
+	Pods   []string `yaml:"pods"`
+	Filter string   `yaml:"filter"`
+}
+
+// Agent are the settings of the ephemeral container agents
+type Agent struct {
+	SnapLen      int32         `yaml:"snaplen"`
+	Interfaces   []string      `yaml:"interfaces"`
+	SetupTimeout time.Duration `yaml:"setupTimeout"`
+	SyncStart    bool          `yaml:"syncStart"` // start the capture of every pod at the same time
+	Image        string        `yaml:"image"`
+
+	// capture engine, pcap or afpacket, with the afpacket ring settings
+	Engine       string        `yaml:"engine"`
+	RingSize     int           `yaml:"ringSize"` // megabytes
+	BlockTimeout time.Duration `yaml:"blockTimeout"`
+}
+
+// Proxy are the settings of the proxy pod
+type Proxy struct {
+	Port         int32         `yaml:"port"`
+	SetupTimeout time.Duration `yaml:"setupTimeout"`
+	Reuse        bool          `yaml:"reuse"` // reuse the shared proxy of the namespace
+}
+
+// Output are the settings of the written files
+type Output struct {
+	Dir      string `yaml:"dir"`
+	Format   string `yaml:"format"`   // pcap or pcapng
+	Split    *bool  `yaml:"split"`    // one file per pod
+	Raw      bool   `yaml:"raw"`      // write the packets to stdout
+	Compress string `yaml:"compress"` // gzip or zstd
+}
+
+// Rotation is the ring buffer of output files
+type Rotation struct {
+	MaxSize  int           `yaml:"maxSize"` // megabytes
+	Interval time.Duration `yaml:"interval"`
+	Count    int           `yaml:"count"`
+}
+
+// Stop are the conditions ending the capture
+type Stop struct {
+	Count    int64         `yaml:"count"`
+	Bytes    int64         `yaml:"bytes"`
+	Duration time.Duration `yaml:"duration"`
+	PerPod   bool          `yaml:"perPod"`
+}
+
+// Error is an error at a line of a profile
+type Error struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e Error) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// Errors are the errors of a profile
+type Errors []Error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+var (
+	// yamlError matches the line of the yaml decoder errors
+	yamlError = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	// goType matches the go types in the yaml decoder errors, they are not part of the schema
+	goType = regexp.MustCompile(` in type \S+`)
+)
+
+// Load reads and validates the profile file
+func Load(path string) (Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Profile{}, err
+	}
+	p, err := Parse(data)
+	var errs Errors
+	if errors.As(err, &errs) {
+		for i := range errs {
+			errs[i].File = path
+		}
+		return p, errs
+	}
+	return p, err
+}
+
+// Parse decodes and validates a profile, the errors are reported as Errors.
+func Parse(data []byte) (Profile, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return Profile{}, decodeErrors(err)
+	}
+	if len(root.Content) == 0 {
+		return Profile{}, Errors{{Line: 1, Msg: "empty profile"}}
+	}
+
+	p := Profile{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil {
+		return Profile{}, decodeErrors(err)
+	}
+	if errs := p.validate(&root); len(errs) > 0 {
+		return p, errs
+	}
+	return p, nil
+}
+
+// decodeErrors converts the yaml errors to Errors
+func decodeErrors(err error) Errors {
+	msgs := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		msgs = typeErr.Errors
+	}
+	errs := Errors{}
+	for _, msg := range msgs {
+		m := yamlError.FindStringSubmatch(msg)
+		if m == nil {
+			errs = append(errs, Error{Line: 1, Msg: strings.TrimPrefix(msg, "yaml: ")})
+			continue
+		}
+		line, _ := strconv.Atoi(m[1])
+		errs = append(errs, Error{Line: line, Msg: goType.ReplaceAllString(m[2], "")})
+	}
+	return errs
+}
+
+// validate checks the values of the profile, errors are located with the yaml nodes
+func (p Profile) validate(root *yaml.Node) Errors {
+	errs := Errors{}
+	check := func(err error, path ...string) {
+		if err != nil {
+			errs = append(errs, Error{Line: line(root, path...), Msg: strings.Join(path, ".") + ": " + err.Error()})
+		}
+	}
+
+	switch p.Version {
+	case Version:
+	case "":
+		check(errors.New("missing, must be "+Version), "version")
+	default:
+		check(errors.New("unsupported version "+p.Version+", must be "+Version), "version")
+	}
+
+	for i, t := range p.Targets {
+		target := []string{"targets", strconv.Itoa(i)}
+		if len(t.Pods) == 0 {
+			check(errors.New("at least one pod name, glob, /regexp/ or kind/name is required"), append(target, "pods")...)
+		}
+		for j, pod := range t.Pods {
+			check(k8s.ValidateSelection(pod), append(target, "pods", strconv.Itoa(j))...)
+		}
+		check(filter.Validate(t.Filter), append(target, "filter")...)
+	}
+	check(filter.Validate(p.Filter), "filter")
+
+	if p.Agent.SnapLen < 0 {
+		check(errors.New("must be positive"), "agent", "snaplen")
+	}
+	check(k8s.CheckInterfaces(p.Agent.Interfaces), "agent", "interfaces")
+	if p.Agent.SetupTimeout < 0 {
+		check(errors.New("must be positive"), "agent", "setupTimeout")
+	}
+	check(k8s.CheckEngine(p.Agent.Engine), "agent", "engine")
+	if p.Agent.RingSize < 0 {
+		check(errors.New("must be positive"), "agent", "ringSize")
+	}
+	if p.Agent.BlockTimeout < 0 {
+		check(errors.New("must be positive"), "agent", "blockTimeout")
+	}
+	if p.Proxy.Port < 0 || p.Proxy.Port > 65535 {
+		check(errors.New("invalid port"), "proxy", "port")
+	}
+	if p.Proxy.SetupTimeout < 0 {
+		check(errors.New("must be positive"), "proxy", "setupTimeout")
+	}
+
+	if p.Output.Format != "" {
+		_, err := sink.ParseFormat(p.Output.Format)
+		check(err, "output", "format")
+	}
+	_, err := sink.ParseCompression(p.Output.Compress)
+	check(err, "output", "compress")
+
+	if p.Rotation.MaxSize < 0 {
+		check(errors.New("must be positive"), "rotation", "maxSize")
+	}
+	if p.Rotation.Interval < 0 {
+		check(errors.New("must be positive"), "rotation", "interval")
+	} else if p.Rotation.Interval%time.Second != 0 {
+		// the files are rotated every N seconds
+		check(errors.New("must be a whole number of seconds"), "rotation", "interval")
+	}
+	if p.Rotation.Count < 0 {
+		check(errors.New("must be positive"), "rotation", "count")
+	}
+
+	if p.Stop.Count < 0 {
+		check(errors.New("must be positive"), "stop", "count")
+	}
+	if p.Stop.Bytes < 0 {
+		check(errors.New("must be positive"), "stop", "bytes")
+	}
+	if p.Stop.Duration < 0 {
+		check(errors.New("must be positive"), "stop", "duration")
+	}
+	return errs
+}
+
+// line returns the line of the value at path, or of its closest parent
+func line(root *yaml.Node, path ...string) int {
+	n := root
+	if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	l := n.Line
+	for _, key := range path {
+		next := child(n, key)
+		if next == nil {
+			break
+		}
+		n, l = next, next.Line
+	}
+	return l
+}
+
+// child returns the value of a mapping key or the item of a sequence
+func child(n *yaml.Node, key string) *yaml.Node {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				return n.Content[i+1]
+			}
+		}
+	case yaml.SequenceNode:
+		if i, err := strconv.Atoi(key); err == nil && i < len(n.Content) {
+			return n.Content[i]
+		}
+	}
+	return nil
+}
+
+// AgentOpts returns the agent options set by the profile
+func (p Profile) AgentOpts() []k8s.AgentOpt {
+	opts := []k8s.AgentOpt{}
+	if p.Agent.SnapLen > 0 {
+		opts = append(opts, k8s.WithAgentSnapLen(p.Agent.SnapLen))
+	}
+	if len(p.Agent.Interfaces) > 0 {
+		opts = append(opts, k8s.WithAgentDevice(strings.Join(p.Agent.Interfaces, ",")))
+	}
+	if p.Agent.SetupTimeout > 0 {
+		opts = append(opts, k8s.WithAgentSetupTimeOut(p.Agent.SetupTimeout))
+	}
+	if p.Agent.Image != "" {
+		opts = append(opts, k8s.WithAgentImage(p.Agent.Image))
+	}
+	if p.Agent.Engine != "" {
+		opts = append(opts, k8s.WithAgentEngine(p.Agent.Engine))
+	}
+	if p.Agent.RingSize > 0 {
+		opts = append(opts, k8s.WithAgentRingSize(p.Agent.RingSize))
+	}
+	if p.Agent.BlockTimeout > 0 {
+		opts = append(opts, k8s.WithAgentBlockTimeout(p.Agent.BlockTimeout))
+	}
+	if p.Agent.SyncStart {
+		opts = append(opts, k8s.WithAgentSyncStart(true))
+	}
+	return opts
+}
+
+// ProxyOpts returns the proxy options set by the profile
+func (p Profile) ProxyOpts() []k8s.ProxyOpt {
+	opts := []k8s.ProxyOpt{}
+	if p.Proxy.Port > 0 {
+		opts = append(opts, k8s.WithProxyServerPort(p.Proxy.Port))
+	}
+	if p.Proxy.SetupTimeout > 0 {
+		opts = append(opts, k8s.WithProxySetupTimeout(p.Proxy.SetupTimeout))
+	}
+	if p.Proxy.Reuse {
+		opts = append(opts, k8s.WithProxyShared(true))
+	}
+	return opts
+}
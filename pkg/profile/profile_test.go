@@ -0,0 +1,106 @@
+package profile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gmtstephane/kpture/pkg/filter"
+	"github.com/gmtstephane/kpture/pkg/k8s"
+	"github.com/stretchr/testify/assert"
+)
+
+const testProfile = `version: kpture/v1
+namespace: shop
+follow: true
+targets:
+  - pods: [deployment/api, "api-*"]
+    filter: port 8080
+  - pods: ["/^redis-[0-9]+$/"]
+filter: not port 22
+agent:
+  snaplen: 1500
+  interfaces: [eth0, net1]
+  setupTimeout: 1m
+  engine: afpacket
+  ringSize: 32
+  syncStart: true
+  image: ghcr.io/gmtstephane/kpture:latest-nocgo
+proxy:
+  port: 11000
+  reuse: true
+output:
+  dir: capture
+  format: pcapng
+  split: false
+  compress: zstd
+rotation:
+  maxSize: 100
+  interval: 10m
+  count: 5
+stop:
+  count: 1000
+  duration: 5m
+  perPod: true
+`
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte(testProfile))
+	assert.NoError(t, err)
+	assert.Equal(t, "shop", p.Namespace)
+	assert.True(t, p.Follow)
+	assert.Equal(t, []Target{
+		{Pods: []string{"deployment/api", "api-*"}, Filter: "port 8080"},
+		{Pods: []string{"/^redis-[0-9]+$/"}},
+	}, p.Targets)
+	assert.Equal(t, Rotation{MaxSize: 100, Interval: 10 * time.Minute, Count: 5}, p.Rotation)
+	assert.Equal(t, Stop{Count: 1000, Duration: 5 * time.Minute, PerPod: true}, p.Stop)
+	assert.False(t, *p.Output.Split)
+
+	agent := k8s.LoadAgentOpts(p.AgentOpts()...)
+	assert.Equal(t, int32(1500), agent.SnapshotLen)
+	assert.Equal(t, "eth0,net1", agent.Device)
+	assert.Equal(t, time.Minute, agent.SetupTimeout)
+	assert.Equal(t, k8s.AgentEngineAFPacket, agent.Engine)
+	assert.Equal(t, 32, agent.RingSize)
+	assert.True(t, agent.SyncStart)
+	assert.Equal(t, "ghcr.io/gmtstephane/kpture:latest-nocgo", agent.Image)
+
+	proxy := k8s.LoadProxyOpts(p.ProxyOpts()...)
+	assert.Equal(t, int32(11000), proxy.ServerPort)
+	assert.True(t, proxy.Shared)
+	assert.Equal(t, k8s.LoadProxyOpts().SetupTimeout, proxy.SetupTimeout)
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"":                               "line 1: empty profile",
+		"version: [":                     "line 1: did not find expected node content",
+		"version: kpture/v1\nfoo: bar":   "line 2: field foo not found",
+		"version: kpture/v1\nall: maybe": "line 2: cannot unmarshal !!str `maybe` into bool",
+		"namespace: default":             "line 1: version: missing, must be kpture/v1",
+		"version: kpture/v2":             "line 1: version: unsupported version kpture/v2, must be kpture/v1",
+		"version: kpture/v1\noutput:\n  format: mp4":       "line 3: output.format: unsupported output format mp4, must be pcap or pcapng",
+		"version: kpture/v1\nstop:\n  duration: -1s":       "line 3: stop.duration: must be positive",
+		"version: kpture/v1\nrotation:\n  interval: 500ms": "line 3: rotation.interval: must be a whole number of seconds",
+		"version: kpture/v1\ntargets:\n  - filter: tcp":    "line 3: targets.0.pods: at least one pod name, glob, /regexp/ or kind/name is required",
+		"version: kpture/v1\ntargets:\n  - pods:\n      - api\n      - cronjob/backup\n    filter: port 8o": "line 5: targets.0.pods.1: unsupported kind cronjob in cronjob/backup, must be pod, deployment, replicaset, statefulset, daemonset, job or service\n" +
+			// the message of libpcap in cgo builds, of the filter package otherwise
+			"line 6: targets.0.filter: " + filter.Validate("port 8o").Error(),
+	}
+	for profile, expected := range tests {
+		_, err := Parse([]byte(profile))
+		assert.EqualError(t, err, expected, profile)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("version: kpture/v1\nagent:\n  snaplen: -1\n"), 0o600))
+	_, err := Load(path)
+	assert.EqualError(t, err, path+":3: agent.snaplen: must be positive")
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
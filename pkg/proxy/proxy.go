@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io"
 	"sync"
+	"time"
 
 	capture "github.com/gmtstephane/kpture/api/kpture"
 	"github.com/sirupsen/logrus"
@@ -13,52 +14,200 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// Proxy hosts the capture sessions, the agents and clients calls are routed
+// to the session carried in their grpc metadata.
 type Proxy struct {
-	packets   chan *capture.PacketDescriptor
-	started   bool
-	mu        sync.Mutex
-	cleanup   func(wg *sync.WaitGroup, cancel context.CancelFunc)
-	readypods []*capture.Pod
-	wg        *sync.WaitGroup
-	ctx       context.Context
-	cancel    context.CancelFunc
+	bufferSize   int
+	agentTimeout time.Duration
+	mu           sync.Mutex
+	sessions     map[string]*session
+	// ended are the ids of the ended sessions, their late calls are rejected
+	ended map[string]bool
+	// created is closed and replaced when a session is created
+	created chan struct{}
+	// awaited counts the calls waiting for the creation of each session
+	awaited map[string]int
+	cleanup func(wg *sync.WaitGroup, cancel context.CancelFunc)
+
 	capture.UnimplementedAgentServiceServer
 	capture.UnimplementedClientServiceServer
 }
 
-func NewProxyServer(bufferSize int, cleanup func(wg *sync.WaitGroup, cancel context.CancelFunc)) *Proxy {
-	s := Proxy{
-		packets:   make(chan *capture.PacketDescriptor, bufferSize),
-		readypods: make([]*capture.Pod, 0),
-		started:   false,
-		cleanup:   cleanup,
-		mu:        sync.Mutex{},
-		wg:        &sync.WaitGroup{},
+// Option configures a proxy
+type Option func(*Proxy)
+
+// WithAgentTimeout sets the time after which the agents without packet or heartbeat are expired,
+// 0 keeps them. It defaults to DefaultAgentTimeout.
+func WithAgentTimeout(timeout time.Duration) Option {
+	return func(p *Proxy) {
+		p.agentTimeout = timeout
+	}
+}
+
+// NewProxyServer creates a proxy buffering bufferSize packets of each agent for each client,
+// cleanup is called when a session ends to stop its agents.
+func NewProxyServer(bufferSize int, cleanup func(wg *sync.WaitGroup, cancel context.CancelFunc), opts ...Option) *Proxy {
+	p := &Proxy{
+		bufferSize:   bufferSize,
+		agentTimeout: DefaultAgentTimeout,
+		sessions:     map[string]*session{},
+		ended:        map[string]bool{},
+		created:      make(chan struct{}),
+		awaited:      map[string]int{},
+		cleanup:      cleanup,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// errEnded is returned to the calls of an ended session
+func errEnded(id string) error {
+	return status.Errorf(codes.NotFound, "session %q ended", id)
+}
+
+// route returns the session id of an agent call, mu must be held. The agents older than the
+// sessions call without id, they are routed to the only session open or awaited by a client.
+func (s *Proxy) route(ctx context.Context) string {
+	id := capture.SessionOf(ctx)
+	if id != "" {
+		return id
+	}
+	open := map[string]bool{}
+	for id := range s.sessions {
+		open[id] = true
+	}
+	for id := range s.awaited {
+		open[id] = true
+	}
+	if len(open) != 1 {
+		return ""
+	}
+	for id = range open {
 	}
-	s.ctx, s.cancel = context.WithCancel(context.Background())
-	return &s
+	return id
 }
 
-func (s *Proxy) hasStarted() bool {
+// agentSessionID returns the session id of an agent call
+func (s *Proxy) agentSessionID(ctx context.Context) string {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.started
+	return s.route(ctx)
+}
+
+// session returns the session of an agent call, it is created by the first agent
+func (s *Proxy) session(ctx context.Context) (*session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.route(ctx)
+	if s.ended[id] {
+		return nil, errEnded(id)
+	}
+	sess, ok := s.sessions[id]
+	if !ok {
+		logrus.Info("starting session ", id)
+		sess = newSession(id, s.bufferSize, s.agentTimeout)
+		s.sessions[id] = sess
+		close(s.created)
+		s.created = make(chan struct{})
+	}
+	return sess, nil
 }
 
-func (s *Proxy) setStarted() {
+// lookup returns the session, nil if no agent created it yet
+func (s *Proxy) lookup(id string) (*session, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.started = true
+	if s.ended[id] {
+		return nil, errEnded(id)
+	}
+	return s.sessions[id], nil
+}
+
+// await returns the session once an agent created it
+func (s *Proxy) await(ctx context.Context, id string) (*session, error) {
+	s.mu.Lock()
+	s.awaited[id]++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		if s.awaited[id]--; s.awaited[id] == 0 {
+			delete(s.awaited, id)
+		}
+		s.mu.Unlock()
+	}()
+	for {
+		s.mu.Lock()
+		sess, ended, created := s.sessions[id], s.ended[id], s.created
+		s.mu.Unlock()
+		switch {
+		case ended:
+			return nil, errEnded(id)
+		case sess != nil:
+			return sess, nil
+		}
+		select {
+		case <-created:
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// endSession removes the session and stops its agents and clients
+func (s *Proxy) endSession(sess *session) {
+	sess.cleanupOnce.Do(func() {
+		logrus.Info("session ", sess.id, " ended, cleaning up...")
+		s.mu.Lock()
+		if s.sessions[sess.id] == sess {
+			delete(s.sessions, sess.id)
+		}
+		s.ended[sess.id] = true
+		s.mu.Unlock()
+		s.cleanup(sess.wg, sess.cancel)
+	})
+}
+
+// ExpireSessions ends the sessions without client for longer than timeout until ctx is done,
+// the agents of a client which did not end its session are stopped.
+func (s *Proxy) ExpireSessions(ctx context.Context, timeout time.Duration) {
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		deadline := time.Now().Add(-timeout)
+		s.mu.Lock()
+		expired := []*session{}
+		for _, sess := range s.sessions {
+			if sess.idle(deadline) {
+				expired = append(expired, sess)
+			}
+		}
+		s.mu.Unlock()
+		for _, sess := range expired {
+			logrus.Info("session ", sess.id, " has no client since ", timeout)
+			s.endSession(sess)
+		}
+	}
 }
 
 func (s *Proxy) AddPacket(packetStream capture.AgentService_AddPacketServer) error {
 	logrus.Info("AddPacket")
+	sess, err := s.session(packetStream.Context())
+	if err != nil {
+		return err
+	}
 
-	s.wg.Add(1)
-	defer s.wg.Done()
+	sess.wg.Add(1)
+	defer sess.wg.Done()
 
 	go func() {
-		<-s.ctx.Done()
+		<-sess.ctx.Done()
 		logrus.Info("Context is Done")
 		if err := packetStream.Send(&capture.Empty{}); err != nil {
 			logrus.Error(err)
@@ -74,31 +223,130 @@ func (s *Proxy) AddPacket(packetStream capture.AgentService_AddPacketServer) err
 			return status.Error(codes.Internal, err.Error())
 		}
 
-		if s.hasStarted() {
-			select {
-			case s.packets <- packet:
-			default:
-				logrus.Error("buffer full")
-			}
+		// the packets and the statistics are the agent heartbeats
+		sess.agents.seen(packet.GetName())
+		if packet.GetStats() != nil {
+			sess.setAgentStats(packet.GetName(), packet.GetStats())
+			continue
 		}
+
+		sess.publish(packet)
 	}
 }
 
+// Ready registers the agent of a pod in its session, older agents without pod name are not registered
 func (s *Proxy) Ready(ctx context.Context, pod *capture.Pod) (*capture.Empty, error) {
-	s.readypods = append(s.readypods, pod)
+	sess, err := s.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if pod.GetName() != "" {
+		logrus.Info("agent of ", pod.GetName(), " ready")
+		sess.agents.register(pod)
+	}
 	return &capture.Empty{}, nil
 }
 
+// WaitStart blocks the agent until the client starts the capture, the agents of a started
+// session are released immediately with the start time. The waiting agents are not expired.
+func (s *Proxy) WaitStart(ctx context.Context, pod *capture.Pod) (*capture.StartRsp, error) {
+	sess, err := s.await(ctx, s.agentSessionID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer sess.agents.wait(pod.GetName())()
+	select {
+	case <-sess.started:
+		return &capture.StartRsp{StartTime: sess.startTime.UnixNano()}, nil
+	case <-sess.ctx.Done():
+		return nil, status.Error(codes.Canceled, "session ended")
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// Start releases the agents of the session waiting for the capture start,
+// it waits for the first agent creating the session.
+func (s *Proxy) Start(ctx context.Context, in *capture.Empty) (*capture.StartRsp, error) {
+	sess, err := s.await(ctx, capture.SessionOf(ctx))
+	if err != nil {
+		return nil, err
+	}
+	start := sess.start()
+	logrus.Info("session ", sess.id, " started")
+	return &capture.StartRsp{StartTime: start.UnixNano()}, nil
+}
+
+// ListAgents returns the live agents of the session, sorted by pod name
+func (s *Proxy) ListAgents(ctx context.Context, in *capture.Empty) (*capture.AgentsRsp, error) {
+	sess, err := s.lookup(capture.SessionOf(ctx))
+	if sess == nil {
+		return &capture.AgentsRsp{}, err
+	}
+	return &capture.AgentsRsp{Agents: sess.agents.list()}, nil
+}
+
+// WaitReady waits until the agents of every pod registered in the session,
+// the pods still not ready are returned after the timeout.
+func (s *Proxy) WaitReady(ctx context.Context, in *capture.WaitReadyReq) (*capture.ReadyRsp, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, time.Duration(in.GetTimeout()))
+	defer cancel()
+	sess, err := s.await(waitCtx, capture.SessionOf(ctx))
+	if err != nil {
+		if ctx.Err() == nil && waitCtx.Err() != nil {
+			// no agent created the session before the timeout
+			return &capture.ReadyRsp{NotReady: in.GetPods()}, nil
+		}
+		return nil, err
+	}
+	for {
+		missing, changed := sess.agents.notReady(in.GetPods())
+		if len(missing) == 0 {
+			return &capture.ReadyRsp{Ready: true}, nil
+		}
+		select {
+		case <-changed:
+		case <-sess.ctx.Done():
+			return &capture.ReadyRsp{NotReady: missing}, nil
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return nil, status.FromContextError(ctx.Err()).Err()
+			}
+			return &capture.ReadyRsp{NotReady: missing}, nil
+		}
+	}
+}
+
+// GetStats returns the capture statistics of the agents of the session, sorted by name
+func (s *Proxy) GetStats(ctx context.Context, in *capture.Empty) (*capture.StatsRsp, error) {
+	sess, err := s.lookup(capture.SessionOf(ctx))
+	if sess == nil {
+		return &capture.StatsRsp{}, err
+	}
+	return sess.statsRsp(), nil
+}
+
+// GetPackets streams the packets of the session agents until the client leaves or the session ends,
+// each client receives every packet and the agents are served in turn. The stream waits for the
+// first agent creating the session.
 func (s *Proxy) GetPackets(in *capture.Empty, stream capture.ClientService_GetPacketsServer) error {
 	logrus.Info("GetPackets")
-	s.setStarted()
+	sess, err := s.await(stream.Context(), capture.SessionOf(stream.Context()))
+	if err != nil {
+		return err
+	}
+	sub := sess.subscribe()
+	defer sess.unsubscribe(sub)
 	for {
 		select {
 		case <-stream.Context().Done():
-			logrus.Info("client stopped connexion, cleaning up...")
-			s.cleanup(s.wg, s.cancel)
+			logrus.Info("client stopped connexion")
 			return nil
-		case p := <-s.packets:
+		case <-sess.ctx.Done():
+			return nil
+		case <-sub.packets.ready:
+		}
+		for p, ok := sub.packets.pop(); ok; p, ok = sub.packets.pop() {
 			err := stream.Send(p)
 			if err != nil {
 				if errors.Is(err, io.EOF) {
@@ -109,3 +357,21 @@ func (s *Proxy) GetPackets(in *capture.Empty, stream capture.ClientService_GetPa
 		}
 	}
 }
+
+// EndSession stops the agents and the packet streams of the session, the session is cleaned up.
+// The later calls of the session are rejected, even when no agent created it.
+func (s *Proxy) EndSession(ctx context.Context, in *capture.Empty) (*capture.Empty, error) {
+	id := capture.SessionOf(ctx)
+	s.mu.Lock()
+	sess, ok := s.sessions[id]
+	ended := s.ended[id]
+	s.ended[id] = true
+	s.mu.Unlock()
+	switch {
+	case ended:
+		return nil, errEnded(id)
+	case ok:
+		s.endSession(sess)
+	}
+	return &capture.Empty{}, nil
+}
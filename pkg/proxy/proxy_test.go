@@ -11,7 +11,9 @@ import (
 	capture "github.com/gmtstephane/kpture/api/kpture"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 )
 
@@ -59,6 +61,14 @@ func newServer(t *testing.T, register func(srv *grpc.Server)) *grpc.ClientConn {
 
 const defaultbufferSize = 1500
 
+// agentSession returns the session of ctx, created like by the first agent call
+func agentSession(t *testing.T, p *Proxy, ctx context.Context) *session {
+	t.Helper()
+	sess, err := p.session(ctx)
+	assert.NoError(t, err)
+	return sess
+}
+
 func TestProxy_AddPacket(t *testing.T) {
 	p := NewProxyServer(defaultbufferSize, func(wg *sync.WaitGroup, cancel context.CancelFunc) {
 		cancel()
@@ -125,3 +135,424 @@ func TestProxy_AddPacket(t *testing.T) {
 	assert.NoError(t, err)
 	// time.Sleep(10 * time.Second)
 }
+
+func TestProxy_GetStats(t *testing.T) {
+	p := NewProxyServer(1, func(wg *sync.WaitGroup, cancel context.CancelFunc) {
+		cancel()
+		wg.Wait()
+	})
+	conn := newServer(t, func(srv *grpc.Server) {
+		capture.RegisterAgentServiceServer(srv, p)
+		capture.RegisterClientServiceServer(srv, p)
+	})
+	clientService := capture.NewClientServiceClient(conn)
+
+	// the packets are queued for a client which does not read them
+	sub := agentSession(t, p, context.Background()).subscribe()
+	agentStream, err := capture.NewAgentServiceClient(conn).AddPacket(context.Background())
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, agentStream.Send(&capture.PacketDescriptor{Name: "pod1", Packet: &capture.Packet{}}))
+	}
+	assert.NoError(t, agentStream.Send(&capture.PacketDescriptor{
+		Name:  "pod1",
+		Stats: &capture.AgentStats{Received: 10, Dropped: 4, IfDropped: 1},
+	}))
+
+	var stats *capture.StatsRsp
+	assert.Eventually(t, func() bool {
+		stats, err = clientService.GetStats(context.Background(), &capture.Empty{})
+		return err == nil && len(stats.GetAgents()) == 1 && stats.GetAgents()[0].GetReceived() == 10
+	}, 3*time.Second, 10*time.Millisecond)
+	agent := stats.GetAgents()[0]
+	assert.Equal(t, "pod1", agent.GetName())
+	assert.Equal(t, uint64(2), agent.GetProxyDropped())
+	assert.Equal(t, uint64(4), agent.GetDropped())
+	assert.Equal(t, uint64(7), agent.Drops())
+	assert.Equal(t, 1, sub.packets.len())
+}
+
+func TestProxy_Subscribers(t *testing.T) {
+	ended := make(chan struct{})
+	p := NewProxyServer(defaultbufferSize, func(wg *sync.WaitGroup, cancel context.CancelFunc) {
+		cancel()
+		close(ended)
+	})
+	conn := newServer(t, func(srv *grpc.Server) {
+		capture.RegisterAgentServiceServer(srv, p)
+		capture.RegisterClientServiceServer(srv, p)
+	})
+	clientService := capture.NewClientServiceClient(conn)
+
+	viewerCtx, leave := context.WithCancel(context.Background())
+	defer leave()
+	viewer, err := clientService.GetPackets(viewerCtx, &capture.Empty{})
+	assert.NoError(t, err)
+	owner, err := clientService.GetPackets(context.Background(), &capture.Empty{})
+	assert.NoError(t, err)
+	sess := agentSession(t, p, context.Background())
+	assert.Eventually(t, func() bool {
+		sess.mu.Lock()
+		defer sess.mu.Unlock()
+		return len(sess.subscribers) == 2
+	}, 3*time.Second, 10*time.Millisecond)
+
+	agentStream, err := capture.NewAgentServiceClient(conn).AddPacket(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, agentStream.Send(&capture.PacketDescriptor{Name: "pod1"}))
+
+	// every client receives the packets
+	packet, err := viewer.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "pod1", packet.GetName())
+	packet, err = owner.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "pod1", packet.GetName())
+
+	// a client leaving does not end the session
+	leave()
+	assert.NoError(t, agentStream.Send(&capture.PacketDescriptor{Name: "pod2"}))
+	packet, err = owner.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "pod2", packet.GetName())
+	select {
+	case <-ended:
+		t.Fatal("session ended by a leaving client")
+	default:
+	}
+
+	// the session end stops the agents and the clients
+	_, err = clientService.EndSession(context.Background(), &capture.Empty{})
+	assert.NoError(t, err)
+	<-ended
+	_, err = owner.Recv()
+	assert.Error(t, err)
+	_, err = agentStream.Recv()
+	assert.NoError(t, err)
+}
+
+func TestProxy_NoisyAgent(t *testing.T) {
+	p := NewProxyServer(2, func(wg *sync.WaitGroup, cancel context.CancelFunc) {
+		cancel()
+	})
+	conn := newServer(t, func(srv *grpc.Server) {
+		capture.RegisterAgentServiceServer(srv, p)
+		capture.RegisterClientServiceServer(srv, p)
+	})
+
+	// a client which does not read yet
+	sub := agentSession(t, p, context.Background()).subscribe()
+	noisy, err := capture.NewAgentServiceClient(conn).AddPacket(context.Background())
+	assert.NoError(t, err)
+	quiet, err := capture.NewAgentServiceClient(conn).AddPacket(context.Background())
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, noisy.Send(&capture.PacketDescriptor{Name: "noisy", Packet: &capture.Packet{}}))
+	}
+	assert.NoError(t, quiet.Send(&capture.PacketDescriptor{Name: "quiet", Packet: &capture.Packet{}}))
+	assert.NoError(t, quiet.Send(&capture.PacketDescriptor{Name: "quiet", Packet: &capture.Packet{}}))
+
+	// the quiet agent packets are kept, only the noisy agent drops
+	var stats *capture.StatsRsp
+	assert.Eventually(t, func() bool {
+		stats, err = p.GetStats(context.Background(), &capture.Empty{})
+		return sub.packets.len() == 4 && len(stats.GetAgents()) == 1 && stats.GetAgents()[0].GetProxyDropped() == 8
+	}, 3*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "noisy", stats.GetAgents()[0].GetName())
+}
+
+func TestProxy_Sessions(t *testing.T) {
+	ended := make(chan struct{}, 2)
+	p := NewProxyServer(defaultbufferSize, func(wg *sync.WaitGroup, cancel context.CancelFunc) {
+		cancel()
+		go func() {
+			wg.Wait()
+			ended <- struct{}{}
+		}()
+	})
+	conn := newServer(t, func(srv *grpc.Server) {
+		capture.RegisterAgentServiceServer(srv, p)
+		capture.RegisterClientServiceServer(srv, p)
+	})
+	clientService := capture.NewClientServiceClient(conn)
+	agentService := capture.NewAgentServiceClient(conn)
+
+	// each capture streams the packets of its own agents
+	ctx1 := capture.WithSession(context.Background(), "capture-1")
+	ctx2 := capture.WithSession(context.Background(), "capture-2")
+	client1, err := clientService.GetPackets(ctx1, &capture.Empty{})
+	assert.NoError(t, err)
+	client2, err := clientService.GetPackets(ctx2, &capture.Empty{})
+	assert.NoError(t, err)
+	agent1, err := agentService.AddPacket(ctx1)
+	assert.NoError(t, err)
+	agent2, err := agentService.AddPacket(ctx2)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return len(p.sessions) == 2
+	}, 3*time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, agent1.Send(&capture.PacketDescriptor{Name: "pod1"}))
+	assert.NoError(t, agent2.Send(&capture.PacketDescriptor{Name: "pod2"}))
+	assert.NoError(t, agent2.Send(&capture.PacketDescriptor{Name: "pod2", Stats: &capture.AgentStats{Received: 1}}))
+	packet, err := client1.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "pod1", packet.GetName())
+	packet, err = client2.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "pod2", packet.GetName())
+	assert.Eventually(t, func() bool {
+		stats, errStats := clientService.GetStats(ctx2, &capture.Empty{})
+		return errStats == nil && len(stats.GetAgents()) == 1
+	}, 3*time.Second, 10*time.Millisecond)
+	stats, err := clientService.GetStats(ctx1, &capture.Empty{})
+	assert.NoError(t, err)
+	assert.Empty(t, stats.GetAgents())
+
+	// ending a session stops its agents only
+	_, err = clientService.EndSession(ctx1, &capture.Empty{})
+	assert.NoError(t, err)
+	_, err = agent1.Recv()
+	assert.NoError(t, err)
+	assert.NoError(t, agent1.CloseSend())
+	<-ended
+	_, err = client1.Recv()
+	assert.Error(t, err)
+	assert.NoError(t, agent2.Send(&capture.PacketDescriptor{Name: "pod2"}))
+	packet, err = client2.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "pod2", packet.GetName())
+	_, err = clientService.GetStats(ctx1, &capture.Empty{})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestProxy_ExpireSessions(t *testing.T) {
+	ended := make(chan struct{}, 1)
+	p := NewProxyServer(defaultbufferSize, func(wg *sync.WaitGroup, cancel context.CancelFunc) {
+		cancel()
+		ended <- struct{}{}
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.ExpireSessions(ctx, 50*time.Millisecond)
+
+	// a session with a client is kept
+	sess := agentSession(t, p, capture.WithSession(context.Background(), "capture-1"))
+	sub := sess.subscribe()
+	time.Sleep(200 * time.Millisecond)
+	select {
+	case <-ended:
+		t.Fatal("session with a client expired")
+	default:
+	}
+
+	// until its last client leaves
+	sess.unsubscribe(sub)
+	select {
+	case <-ended:
+	case <-time.After(3 * time.Second):
+		t.Fatal("idle session not expired")
+	}
+	assert.Error(t, sess.ctx.Err())
+}
+
+func TestProxy_WaitReady(t *testing.T) {
+	p := NewProxyServer(defaultbufferSize, func(wg *sync.WaitGroup, cancel context.CancelFunc) {
+		cancel()
+	})
+	conn := newServer(t, func(srv *grpc.Server) {
+		capture.RegisterAgentServiceServer(srv, p)
+		capture.RegisterClientServiceServer(srv, p)
+	})
+	clientService := capture.NewClientServiceClient(conn)
+	agentService := capture.NewAgentServiceClient(conn)
+	ctx := capture.WithSession(context.Background(), "capture-1")
+
+	// the pods without agent are returned after the timeout
+	rsp, err := clientService.WaitReady(ctx, &capture.WaitReadyReq{Pods: []string{"api", "db"}, Timeout: int64(50 * time.Millisecond)})
+	assert.NoError(t, err)
+	assert.False(t, rsp.GetReady())
+	assert.Equal(t, []string{"api", "db"}, rsp.GetNotReady())
+
+	// the client is released when the last agent registers
+	ready := make(chan *capture.ReadyRsp)
+	go func() {
+		rsp, errWait := clientService.WaitReady(ctx, &capture.WaitReadyReq{Pods: []string{"api", "db"}, Timeout: int64(3 * time.Second)})
+		assert.NoError(t, errWait)
+		ready <- rsp
+	}()
+	_, err = agentService.Ready(ctx, &capture.Pod{Name: "api", Namespace: "shop", Interfaces: []string{"eth0"}})
+	assert.NoError(t, err)
+	_, err = agentService.Ready(capture.WithSession(context.Background(), "capture-2"), &capture.Pod{Name: "db"})
+	assert.NoError(t, err)
+	_, err = agentService.Ready(ctx, &capture.Pod{Name: "db", Namespace: "shop", Interfaces: []string{"eth0"}})
+	assert.NoError(t, err)
+	select {
+	case rsp = <-ready:
+		assert.True(t, rsp.GetReady())
+		assert.Empty(t, rsp.GetNotReady())
+	case <-time.After(3 * time.Second):
+		t.Fatal("WaitReady not released")
+	}
+
+	agents, err := clientService.ListAgents(ctx, &capture.Empty{})
+	assert.NoError(t, err)
+	assert.Len(t, agents.GetAgents(), 2)
+	assert.Equal(t, "shop", agents.GetAgents()[0].GetPod().GetNamespace())
+	assert.Equal(t, []string{"eth0"}, agents.GetAgents()[1].GetPod().GetInterfaces())
+}
+
+func TestProxy_Start(t *testing.T) {
+	p := NewProxyServer(defaultbufferSize, func(wg *sync.WaitGroup, cancel context.CancelFunc) {
+		cancel()
+	})
+	conn := newServer(t, func(srv *grpc.Server) {
+		capture.RegisterAgentServiceServer(srv, p)
+		capture.RegisterClientServiceServer(srv, p)
+	})
+	clientService := capture.NewClientServiceClient(conn)
+	agentService := capture.NewAgentServiceClient(conn)
+	ctx := capture.WithSession(context.Background(), "capture-1")
+
+	// the agents wait for the client
+	starts := make(chan int64, 2)
+	for _, name := range []string{"api", "db"} {
+		_, err := agentService.Ready(ctx, &capture.Pod{Name: name})
+		assert.NoError(t, err)
+		go func(name string) {
+			rsp, err := agentService.WaitStart(ctx, &capture.Pod{Name: name})
+			assert.NoError(t, err)
+			starts <- rsp.GetStartTime()
+		}(name)
+	}
+	select {
+	case <-starts:
+		t.Fatal("agent started before the client")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// and start together
+	rsp, err := clientService.Start(ctx, &capture.Empty{})
+	assert.NoError(t, err)
+	assert.Equal(t, rsp.GetStartTime(), <-starts)
+	assert.Equal(t, rsp.GetStartTime(), <-starts)
+
+	// an agent restarted later is released with the same start time
+	late, err := agentService.WaitStart(ctx, &capture.Pod{Name: "api"})
+	assert.NoError(t, err)
+	assert.Equal(t, rsp.GetStartTime(), late.GetStartTime())
+
+	// the agents of another session still wait
+	waitCtx, cancel := context.WithTimeout(capture.WithSession(context.Background(), "capture-2"), 100*time.Millisecond)
+	defer cancel()
+	_, err = agentService.WaitStart(waitCtx, &capture.Pod{Name: "api"})
+	assert.Error(t, err)
+}
+
+func TestProxy_EndedSession(t *testing.T) {
+	cleanups := make(chan struct{}, 2)
+	p := NewProxyServer(defaultbufferSize, func(wg *sync.WaitGroup, cancel context.CancelFunc) {
+		cancel()
+		cleanups <- struct{}{}
+	})
+	conn := newServer(t, func(srv *grpc.Server) {
+		capture.RegisterAgentServiceServer(srv, p)
+		capture.RegisterClientServiceServer(srv, p)
+	})
+	clientService := capture.NewClientServiceClient(conn)
+	agentService := capture.NewAgentServiceClient(conn)
+	ctx := capture.WithSession(context.Background(), "capture-1")
+
+	// the client calls do not create the session, the stream waits for the first agent
+	stats, err := clientService.GetStats(ctx, &capture.Empty{})
+	assert.NoError(t, err)
+	assert.Empty(t, stats.GetAgents())
+	packets, err := clientService.GetPackets(ctx, &capture.Empty{})
+	assert.NoError(t, err)
+	p.mu.Lock()
+	assert.Empty(t, p.sessions)
+	p.mu.Unlock()
+	_, err = agentService.Ready(ctx, &capture.Pod{Name: "api"})
+	assert.NoError(t, err)
+	agent, err := agentService.AddPacket(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, agent.Send(&capture.PacketDescriptor{Name: "api"}))
+	packet, err := packets.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "api", packet.GetName())
+
+	_, err = clientService.EndSession(ctx, &capture.Empty{})
+	assert.NoError(t, err)
+	<-cleanups
+
+	// the late calls are rejected and the session is cleaned up once
+	_, err = clientService.GetStats(ctx, &capture.Empty{})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = agentService.Ready(ctx, &capture.Pod{Name: "api"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = agentService.WaitStart(ctx, &capture.Pod{Name: "api"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	late, err := agentService.AddPacket(ctx)
+	assert.NoError(t, err)
+	_, err = late.Recv()
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = clientService.EndSession(ctx, &capture.Empty{})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	p.mu.Lock()
+	assert.Empty(t, p.sessions)
+	p.mu.Unlock()
+	assert.Empty(t, cleanups)
+
+	// the agents of a session ended before they started are rejected
+	early := capture.WithSession(context.Background(), "capture-2")
+	_, err = clientService.EndSession(early, &capture.Empty{})
+	assert.NoError(t, err)
+	_, err = agentService.Ready(early, &capture.Pod{Name: "api"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Empty(t, cleanups)
+}
+
+func TestProxy_OldAgents(t *testing.T) {
+	p := NewProxyServer(defaultbufferSize, func(wg *sync.WaitGroup, cancel context.CancelFunc) {
+		cancel()
+	})
+	conn := newServer(t, func(srv *grpc.Server) {
+		capture.RegisterAgentServiceServer(srv, p)
+		capture.RegisterClientServiceServer(srv, p)
+	})
+	clientService := capture.NewClientServiceClient(conn)
+	agentService := capture.NewAgentServiceClient(conn)
+	ctx := capture.WithSession(context.Background(), "capture-1")
+
+	// the agents without session id are routed to the session awaited by the client
+	packets, err := clientService.GetPackets(ctx, &capture.Empty{})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.awaited["capture-1"] == 1
+	}, 3*time.Second, 10*time.Millisecond)
+	_, err = agentService.Ready(context.Background(), &capture.Pod{Name: "api"})
+	assert.NoError(t, err)
+	agent, err := agentService.AddPacket(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, agent.Send(&capture.PacketDescriptor{Name: "api"}))
+	packet, err := packets.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "api", packet.GetName())
+	agents, err := clientService.ListAgents(ctx, &capture.Empty{})
+	assert.NoError(t, err)
+	assert.Len(t, agents.GetAgents(), 1)
+
+	// with several open sessions, they keep the session without id
+	_, err = agentService.Ready(capture.WithSession(context.Background(), "capture-2"), &capture.Pod{Name: "db"})
+	assert.NoError(t, err)
+	_, err = agentService.Ready(context.Background(), &capture.Pod{Name: "web"})
+	assert.NoError(t, err)
+	agents, err = clientService.ListAgents(context.Background(), &capture.Empty{})
+	assert.NoError(t, err)
+	assert.Len(t, agents.GetAgents(), 1)
+	assert.Equal(t, "web", agents.GetAgents()[0].GetPod().GetName())
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"sync"
+
+	capture "github.com/gmtstephane/kpture/api/kpture"
+)
+
+// fairQueue buffers the packets of each agent in its own bounded queue and drains
+// the queues round-robin, a noisy agent only drops its own packets.
+type fairQueue struct {
+	mu     sync.Mutex
+	size   int
+	queues map[string]*agentQueue
+	order  []*agentQueue
+	next   int
+	// ready is signaled when a packet is pushed
+	ready chan struct{}
+}
+
+// agentQueue is the queue of the packets of one agent
+type agentQueue struct {
+	packets []*capture.PacketDescriptor
+}
+
+// newFairQueue creates a queue buffering up to size packets for each agent
+func newFairQueue(size int) *fairQueue {
+	return &fairQueue{
+		size:   size,
+		queues: map[string]*agentQueue{},
+		ready:  make(chan struct{}, 1),
+	}
+}
+
+// push queues the packet of its agent, it returns false if the agent queue is full
+func (q *fairQueue) push(packet *capture.PacketDescriptor) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	agent, ok := q.queues[packet.GetName()]
+	if !ok {
+		agent = &agentQueue{}
+		q.queues[packet.GetName()] = agent
+		q.order = append(q.order, agent)
+	}
+	if len(agent.packets) >= q.size {
+		return false
+	}
+	agent.packets = append(agent.packets, packet)
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// pop returns the next packet of the agent after the last one served,
+// it returns false if every queue is empty
+func (q *fairQueue) pop() (*capture.PacketDescriptor, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := range q.order {
+		agent := q.order[(q.next+i)%len(q.order)]
+		if len(agent.packets) == 0 {
+			continue
+		}
+		packet := agent.packets[0]
+		agent.packets[0] = nil
+		agent.packets = agent.packets[1:]
+		q.next = (q.next + i + 1) % len(q.order)
+		return packet, true
+	}
+	return nil, false
+}
+
+// len returns the number of queued packets
+func (q *fairQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := 0
+	for _, agent := range q.order {
+		n += len(agent.packets)
+	}
+	return n
+}
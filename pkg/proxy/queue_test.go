@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"testing"
+
+	capture "github.com/gmtstephane/kpture/api/kpture"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFairQueue(t *testing.T) {
+	q := newFairQueue(3)
+
+	// the noisy agent fills its own queue only
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, i < 3, q.push(&capture.PacketDescriptor{Name: "noisy"}))
+	}
+	assert.True(t, q.push(&capture.PacketDescriptor{Name: "quiet"}))
+	assert.True(t, q.push(&capture.PacketDescriptor{Name: "quiet"}))
+	assert.Equal(t, 5, q.len())
+	select {
+	case <-q.ready:
+	default:
+		t.Fatal("queue not ready")
+	}
+
+	// the agents are served in turn
+	names := []string{}
+	for p, ok := q.pop(); ok; p, ok = q.pop() {
+		names = append(names, p.GetName())
+	}
+	assert.Equal(t, []string{"noisy", "quiet", "noisy", "quiet", "noisy"}, names)
+	assert.Equal(t, 0, q.len())
+
+	// the drained queues accept packets again
+	assert.True(t, q.push(&capture.PacketDescriptor{Name: "noisy"}))
+	p, ok := q.pop()
+	assert.True(t, ok)
+	assert.Equal(t, "noisy", p.GetName())
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	capture "github.com/gmtstephane/kpture/api/kpture"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultAgentTimeout is the time after which an agent without packet or heartbeat is expired,
+// the agents send their statistics every 2 seconds.
+const DefaultAgentTimeout = 10 * time.Second
+
+// registry are the agents of a session, by pod name
+type registry struct {
+	mu     sync.Mutex
+	agents map[string]*capture.Agent
+	// waiting counts the WaitStart calls of each agent, the waiting agents are not expired
+	waiting map[string]int
+	// timeout is the time after which a silent agent is expired, 0 keeps them
+	timeout time.Duration
+	// changed is closed and replaced when an agent registers
+	changed chan struct{}
+	now     func() time.Time
+}
+
+func newRegistry(timeout time.Duration) *registry {
+	return &registry{
+		agents:  map[string]*capture.Agent{},
+		waiting: map[string]int{},
+		timeout: timeout,
+		changed: make(chan struct{}),
+		now:     time.Now,
+	}
+}
+
+// register adds or replaces the agent of the pod
+func (r *registry) register(pod *capture.Pod) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now().UnixNano()
+	r.agents[pod.GetName()] = &capture.Agent{Pod: pod, RegisteredAt: now, LastSeen: now}
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// seen records a packet or a heartbeat of the agent of the pod
+func (r *registry) seen(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if agent, ok := r.agents[name]; ok {
+		agent.LastSeen = r.now().UnixNano()
+	}
+}
+
+// wait records an agent waiting for the capture start, it is a heartbeat lasting until done is called
+func (r *registry) wait(name string) (done func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.waiting[name]++
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.waiting[name]--; r.waiting[name] == 0 {
+			delete(r.waiting, name)
+		}
+		if agent, ok := r.agents[name]; ok {
+			agent.LastSeen = r.now().UnixNano()
+		}
+	}
+}
+
+// expire removes the agents not seen since the timeout, mu must be held
+func (r *registry) expire() {
+	if r.timeout <= 0 {
+		return
+	}
+	deadline := r.now().Add(-r.timeout).UnixNano()
+	for name, agent := range r.agents {
+		if agent.GetLastSeen() < deadline && r.waiting[name] == 0 {
+			logrus.Info("agent of ", name, " expired")
+			delete(r.agents, name)
+		}
+	}
+}
+
+// list returns a copy of the live agents, sorted by pod name
+func (r *registry) list() []*capture.Agent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire()
+	agents := make([]*capture.Agent, 0, len(r.agents))
+	for _, agent := range r.agents {
+		agents = append(agents, proto.Clone(agent).(*capture.Agent))
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].GetPod().GetName() < agents[j].GetPod().GetName()
+	})
+	return agents
+}
+
+// notReady returns the pods without live agent and a channel closed when an agent registers
+func (r *registry) notReady(pods []string) ([]string, <-chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire()
+	missing := []string{}
+	for _, pod := range pods {
+		if _, ok := r.agents[pod]; !ok {
+			missing = append(missing, pod)
+		}
+	}
+	return missing, r.changed
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	capture "github.com/gmtstephane/kpture/api/kpture"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	now := time.Unix(1000, 0)
+	r := newRegistry(DefaultAgentTimeout)
+	r.now = func() time.Time { return now }
+
+	missing, changed := r.notReady([]string{"api", "db"})
+	assert.Equal(t, []string{"api", "db"}, missing)
+
+	r.register(&capture.Pod{Name: "db", Namespace: "shop", Node: "node1", Interfaces: []string{"eth0"}, Version: "v1.0.0"})
+	select {
+	case <-changed:
+	default:
+		t.Fatal("registration not signaled")
+	}
+	missing, _ = r.notReady([]string{"api", "db"})
+	assert.Equal(t, []string{"api"}, missing)
+	r.register(&capture.Pod{Name: "api", Namespace: "shop"})
+
+	agents := r.list()
+	assert.Len(t, agents, 2)
+	assert.Equal(t, "api", agents[0].GetPod().GetName())
+	assert.Equal(t, "node1", agents[1].GetPod().GetNode())
+	assert.Equal(t, now.UnixNano(), agents[1].GetRegisteredAt())
+
+	// the agents without heartbeat are expired
+	now = now.Add(DefaultAgentTimeout / 2)
+	r.seen("db")
+	now = now.Add(DefaultAgentTimeout/2 + time.Second)
+	agents = r.list()
+	assert.Len(t, agents, 1)
+	assert.Equal(t, "db", agents[0].GetPod().GetName())
+	missing, _ = r.notReady([]string{"api", "db"})
+	assert.Equal(t, []string{"api"}, missing)
+
+	// the agents waiting for the capture start are not expired
+	done := r.wait("db")
+	now = now.Add(2 * DefaultAgentTimeout)
+	assert.Len(t, r.list(), 1)
+	done()
+	now = now.Add(DefaultAgentTimeout / 2)
+	assert.Len(t, r.list(), 1)
+	now = now.Add(DefaultAgentTimeout)
+	assert.Empty(t, r.list())
+}
+
+func TestRegistryNoTimeout(t *testing.T) {
+	now := time.Unix(1000, 0)
+	r := newRegistry(0)
+	r.now = func() time.Time { return now }
+	r.register(&capture.Pod{Name: "api"})
+	now = now.Add(time.Hour)
+	assert.Len(t, r.list(), 1)
+}
@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	capture "github.com/gmtstephane/kpture/api/kpture"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+)
+
+// session is a capture hosted by the proxy, with its own agents, clients and buffers
+type session struct {
+	id          string
+	bufferSize  int
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+	// idleSince is the time the last client left, zero while clients are connected
+	idleSince   time.Time
+	cleanupOnce sync.Once
+	agents      *registry
+	// started is closed when the client starts the capture of the agents waiting for it
+	startOnce sync.Once
+	started   chan struct{}
+	startTime time.Time
+	wg        *sync.WaitGroup
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	// stats are the capture statistics of each agent
+	statsMu sync.Mutex
+	stats   map[string]*capture.AgentStats
+}
+
+// subscriber is the queue of the packets sent to a GetPackets client
+type subscriber struct {
+	packets *fairQueue
+}
+
+func newSession(id string, bufferSize int, agentTimeout time.Duration) *session {
+	s := &session{
+		id:          id,
+		bufferSize:  bufferSize,
+		subscribers: map[*subscriber]struct{}{},
+		idleSince:   time.Now(),
+		agents:      newRegistry(agentTimeout),
+		started:     make(chan struct{}),
+		wg:          &sync.WaitGroup{},
+		stats:       map[string]*capture.AgentStats{},
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+// subscribe adds a client queue, the packets are received until unsubscribe is called
+func (s *session) subscribe() *subscriber {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub := &subscriber{packets: newFairQueue(s.bufferSize)}
+	s.subscribers[sub] = struct{}{}
+	s.idleSince = time.Time{}
+	return sub
+}
+
+func (s *session) unsubscribe(sub *subscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers, sub)
+	if len(s.subscribers) == 0 {
+		s.idleSince = time.Now()
+	}
+}
+
+// idle returns true if the session had no client since the deadline
+func (s *session) idle(deadline time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subscribers) == 0 && s.idleSince.Before(deadline)
+}
+
+// publish queues the packet for every client, the packet is dropped for the clients
+// with a full queue for its agent
+func (s *session) publish(packet *capture.PacketDescriptor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dropped := false
+	for sub := range s.subscribers {
+		if !sub.packets.push(packet) {
+			dropped = true
+		}
+	}
+	if dropped {
+		s.proxyDrop(packet.GetName())
+	}
+}
+
+// start releases the agents waiting for the capture start, it returns the start time
+func (s *session) start() time.Time {
+	s.startOnce.Do(func() {
+		s.startTime = time.Now()
+		close(s.started)
+	})
+	return s.startTime
+}
+
+// agentStats returns the statistics of an agent, statsMu must be held
+func (s *session) agentStats(name string) *capture.AgentStats {
+	stats, ok := s.stats[name]
+	if !ok {
+		stats = &capture.AgentStats{Name: name}
+		s.stats[name] = stats
+	}
+	return stats
+}
+
+// setAgentStats records the capture counters sent by an agent
+func (s *session) setAgentStats(name string, agent *capture.AgentStats) {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	stats := s.agentStats(name)
+	stats.Received = agent.GetReceived()
+	stats.Dropped = agent.GetDropped()
+	stats.IfDropped = agent.GetIfDropped()
+}
+
+// proxyDrop counts a packet of an agent dropped because its queue of a client was full
+func (s *session) proxyDrop(name string) {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	stats := s.agentStats(name)
+	if stats.ProxyDropped == 0 {
+		logrus.Error("buffer full, dropping packets of ", name)
+	}
+	stats.ProxyDropped++
+}
+
+// statsRsp returns a copy of the statistics of the agents, sorted by name
+func (s *session) statsRsp() *capture.StatsRsp {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	rsp := &capture.StatsRsp{Agents: make([]*capture.AgentStats, 0, len(s.stats))}
+	for _, stats := range s.stats {
+		rsp.Agents = append(rsp.Agents, proto.Clone(stats).(*capture.AgentStats))
+	}
+	sort.Slice(rsp.Agents, func(i, j int) bool {
+		return rsp.Agents[i].GetName() < rsp.Agents[j].GetName()
+	})
+	return rsp
+}
@@ -0,0 +1,111 @@
+package sink
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the streaming compression of the output files
+type Compression string
+
+// Output compressions, both can be opened directly by wireshark and tshark.
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// ParseCompression checks that s is a supported compression
+func ParseCompression(s string) (Compression, error) {
+	switch Compression(s) {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return Compression(s), nil
+	default:
+		return "", errors.New("unsupported compression " + s + ", must be gzip or zstd")
+	}
+}
+
+// Ext returns the file extension added by the compression
+func (c Compression) Ext() string {
+	switch c {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// compressor wraps w, closing the compressor flushes it without closing w.
+func (c Compression) compressor(w io.Writer) (io.WriteCloser, error) {
+	switch c {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	case CompressionNone:
+		return nil, nil
+	default:
+		return nil, errors.New("unsupported compression " + string(c))
+	}
+}
+
+// output is an open file, compressed or not.
+type output struct {
+	io.Writer  // stream written by the packet writers
+	counter    *countingWriter
+	compressor io.WriteCloser
+	f          *os.File
+}
+
+// createOutput opens path with the compression extension.
+func createOutput(path string, flag int, c Compression) (*output, error) {
+	f, err := os.OpenFile(path+c.Ext(), flag, 0o666)
+	if err != nil {
+		return nil, err
+	}
+	o := &output{counter: &countingWriter{w: f}, f: f}
+	o.Writer = o.counter
+
+	if o.compressor, err = c.compressor(o.counter); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if o.compressor != nil {
+		o.Writer = o.compressor
+	}
+	return o, nil
+}
+
+// size returns the number of bytes written to the file.
+func (o *output) size() int64 {
+	return o.counter.n
+}
+
+// Close flushes the compressed stream and closes the file.
+func (o *output) Close() error {
+	if o.compressor != nil {
+		if err := o.compressor.Close(); err != nil {
+			o.f.Close()
+			return err
+		}
+	}
+	return o.f.Close()
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
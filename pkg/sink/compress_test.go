@@ -0,0 +1,106 @@
+package sink
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/pcapgo"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCompression(t *testing.T) {
+	c, err := ParseCompression("")
+	assert.NoError(t, err)
+	assert.Equal(t, c.Ext(), "")
+
+	c, err = ParseCompression("gzip")
+	assert.NoError(t, err)
+	assert.Equal(t, c.Ext(), ".gz")
+
+	c, err = ParseCompression("zstd")
+	assert.NoError(t, err)
+	assert.Equal(t, c.Ext(), ".zst")
+
+	_, err = ParseCompression("lz4")
+	assert.Error(t, err)
+
+	_, err = Compression("lz4").compressor(io.Discard)
+	assert.Error(t, err)
+}
+
+// decompress opens a compressed file
+func decompress(t *testing.T, path string, c Compression) io.Reader {
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+	switch c {
+	case CompressionGzip:
+		r, errGzip := gzip.NewReader(f)
+		assert.NoError(t, errGzip)
+		return r
+	case CompressionZstd:
+		r, errZstd := zstd.NewReader(f)
+		assert.NoError(t, errZstd)
+		return r
+	case CompressionNone:
+		return f
+	default:
+		return f
+	}
+}
+
+func TestCompressedFiles(t *testing.T) {
+	for _, c := range []Compression{CompressionGzip, CompressionZstd} {
+		dir := t.TempDir()
+		opts := LoadOpts(WithCompression(c), WithFormat(FormatPcapng))
+
+		f, err := NewFile(filepath.Join(dir, "kpture.pcapng"), testPods, opts)
+		assert.NoError(t, err)
+		p, err := NewPodFiles(dir, testPods, opts)
+		assert.NoError(t, err)
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, f.Write(testPacket("pod1", 100)))
+			assert.NoError(t, p.Write(testPacket("pod1", 100)))
+		}
+		// closing flushes the compressed stream
+		assert.NoError(t, f.Close())
+		assert.NoError(t, p.Close())
+
+		for _, name := range []string{"kpture.pcapng", "pod1.pcapng"} {
+			r, errReader := pcapgo.NewNgReader(decompress(t, filepath.Join(dir, name+c.Ext()), c), pcapgo.DefaultNgReaderOptions)
+			assert.NoError(t, errReader)
+			n := 0
+			for {
+				if _, _, errRead := r.ReadPacketData(); errRead != nil {
+					assert.ErrorIs(t, errRead, io.EOF)
+					break
+				}
+				n++
+			}
+			assert.Equal(t, n, 10)
+		}
+	}
+}
+
+func TestCompressedRotation(t *testing.T) {
+	dir := t.TempDir()
+	opts := LoadOpts(WithCompression(CompressionGzip), WithRotation(Rotation{Interval: time.Hour}))
+
+	f, err := NewFile(filepath.Join(dir, "kpture.pcap"), testPods, opts)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Write(testPacket("pod1", 100)))
+	assert.NoError(t, f.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "kpture-00001-*.pcap.gz"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	r, err := pcapgo.NewReader(decompress(t, files[0], CompressionGzip))
+	assert.NoError(t, err)
+	_, _, err = r.ReadPacketData()
+	assert.NoError(t, err)
+}
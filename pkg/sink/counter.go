@@ -0,0 +1,120 @@
+package sink
+
+import (
+	"sync"
+
+	capture "github.com/gmtstephane/kpture/api/kpture"
+	v1 "k8s.io/api/core/v1"
+)
+
+// PodCount holds the packets and bytes written for a pod
+type PodCount struct {
+	Name    string
+	Packets int64
+	Bytes   int64
+	Ended   bool // the pod was deleted during the capture
+	Gaps    int  // number of periods without capture
+
+	// Drops are the packets dropped by the agent or the proxy, when the agent reported them
+	Drops    int64
+	HasDrops bool
+}
+
+// Counter counts the packets and bytes written per pod.
+// It is safe to read the counts while packets are written.
+type Counter struct {
+	mu    sync.Mutex
+	pods  map[string]*PodCount
+	order []string
+}
+
+// NewCounter creates a counter, pods are listed even if they never send a packet.
+func NewCounter(pods []v1.Pod) *Counter {
+	c := &Counter{pods: make(map[string]*PodCount, len(pods))}
+	for _, pod := range pods {
+		c.add(pod.Name)
+	}
+	return c
+}
+
+func (c *Counter) add(name string) *PodCount {
+	count := &PodCount{Name: name}
+	c.pods[name] = count
+	c.order = append(c.order, name)
+	return count
+}
+
+func (c *Counter) Write(p *capture.PacketDescriptor) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	count, ok := c.pods[p.GetName()]
+	if !ok {
+		count = c.add(p.GetName())
+	}
+	count.Packets++
+	count.Bytes += int64(len(p.GetPacket().GetData()))
+	return nil
+}
+
+// AddPod lists a pod that started during the capture.
+func (c *Counter) AddPod(pod v1.Pod) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if count, ok := c.pods[pod.Name]; ok {
+		// the pod was recreated
+		count.Ended = false
+		return nil
+	}
+	c.add(pod.Name)
+	return nil
+}
+
+// MarkGap counts the gaps of a pod.
+func (c *Counter) MarkGap(pod v1.Pod, _ Gap) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	count, ok := c.pods[pod.Name]
+	if !ok {
+		count = c.add(pod.Name)
+	}
+	count.Gaps++
+	count.Ended = false
+	return nil
+}
+
+// EndPod marks a pod ended during the capture.
+func (c *Counter) EndPod(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if count, ok := c.pods[name]; ok {
+		count.Ended = true
+	}
+	return nil
+}
+
+// SetDrops sets the number of packets dropped for a pod
+func (c *Counter) SetDrops(pod string, drops int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	count, ok := c.pods[pod]
+	if !ok {
+		count = c.add(pod)
+	}
+	count.Drops = drops
+	count.HasDrops = true
+}
+
+// Counts returns a copy of the counts, in the order the pods were added.
+func (c *Counter) Counts() []PodCount {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make([]PodCount, 0, len(c.order))
+	for _, name := range c.order {
+		counts = append(counts, *c.pods[name])
+	}
+	return counts
+}
+
+func (c *Counter) Close() error {
+	return nil
+}
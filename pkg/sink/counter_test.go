@@ -0,0 +1,56 @@
+package sink
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounter(t *testing.T) {
+	c := NewCounter(testPods)
+	assert.Equal(t, c.Counts(), []PodCount{{Name: "pod1"}, {Name: "pod2"}})
+
+	assert.NoError(t, c.Write(testPacket("pod2", 10)))
+	assert.NoError(t, c.Write(testPacket("pod2", 20)))
+	assert.NoError(t, c.Write(testPacket("unknown", 5)))
+	assert.NoError(t, c.Close())
+
+	assert.Equal(t, c.Counts(), []PodCount{
+		{Name: "pod1"},
+		{Name: "pod2", Packets: 2, Bytes: 30},
+		{Name: "unknown", Packets: 1, Bytes: 5},
+	})
+}
+
+func TestCounterAddPod(t *testing.T) {
+	c := NewCounter(testPods)
+	assert.NoError(t, c.AddPod(newPod))
+	assert.NoError(t, c.AddPod(testPods[0]))
+	c.EndPod("pod2")
+	c.EndPod("missing")
+	assert.Equal(t, c.Counts(), []PodCount{{Name: "pod1"}, {Name: "pod2", Ended: true}, {Name: "pod3"}})
+
+	// a recreated pod is captured again
+	assert.NoError(t, c.AddPod(testPods[1]))
+	assert.Equal(t, c.Counts()[1], PodCount{Name: "pod2"})
+}
+
+func TestCounterMarkGap(t *testing.T) {
+	c := NewCounter(testPods)
+	c.EndPod("pod1")
+	assert.NoError(t, c.MarkGap(testPods[0], testGap))
+	assert.NoError(t, c.MarkGap(testPods[0], testGap))
+	assert.NoError(t, c.MarkGap(newPod, testGap))
+	assert.Equal(t, c.Counts(), []PodCount{{Name: "pod1", Gaps: 2}, {Name: "pod2"}, {Name: "pod3", Gaps: 1}})
+}
+
+func TestCounterSetDrops(t *testing.T) {
+	c := NewCounter(testPods)
+	c.SetDrops("pod2", 3)
+	c.SetDrops("pod3", 0)
+	assert.Equal(t, c.Counts(), []PodCount{
+		{Name: "pod1"},
+		{Name: "pod2", Drops: 3, HasDrops: true},
+		{Name: "pod3", HasDrops: true},
+	})
+}
@@ -0,0 +1,155 @@
+package sink
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	capture "github.com/gmtstephane/kpture/api/kpture"
+	v1 "k8s.io/api/core/v1"
+)
+
+// fileWriter writes packets to a file or to a ring of files.
+type fileWriter interface {
+	packetWriter
+	io.Closer
+}
+
+// openFile creates a writer to path, or to a ring of files when rotation is enabled.
+// the compression extension is added to the file names.
+func openFile(path string, pods []v1.Pod, opts Opts) (fileWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	if opts.Rotation.Enabled() {
+		return newRotatingWriter(path, opts.Rotation, opts.Compression, func(o io.Writer) (packetWriter, error) {
+			return newPacketWriter(o, pods, opts, false)
+		})
+	}
+
+	out, err := createOutput(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, opts.Compression)
+	if err != nil {
+		return nil, err
+	}
+	w, err := newPacketWriter(out, pods, opts, false)
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+	return &plainFile{packetWriter: w, out: out}, nil
+}
+
+// plainFile is a single file without rotation.
+type plainFile struct {
+	packetWriter
+	out *output
+}
+
+// Close flushes and closes the file.
+func (p *plainFile) Close() error {
+	if err := p.flush(); err != nil {
+		p.out.Close()
+		return err
+	}
+	return p.out.Close()
+}
+
+// File writes the packets of all the pods to the same file.
+type File struct {
+	w fileWriter
+}
+
+// NewFile creates a file sink, the pods are described in the pcapng file header.
+func NewFile(path string, pods []v1.Pod, opts Opts) (*File, error) {
+	if err := opts.Rotation.Validate(); err != nil {
+		return nil, err
+	}
+	w, err := openFile(path, pods, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &File{w: w}, nil
+}
+
+func (f *File) Write(p *capture.PacketDescriptor) error {
+	return f.w.writePacket(p.GetName(), captureInfo(p), p.GetPacket().GetData())
+}
+
+// AddPod describes a pod that started during the capture.
+func (f *File) AddPod(pod v1.Pod) error {
+	return f.w.addPod(pod)
+}
+
+// MarkGap annotates the gap of a pod.
+func (f *File) MarkGap(pod v1.Pod, g Gap) error {
+	return f.w.markGap(pod, g)
+}
+
+func (f *File) Close() error {
+	return f.w.Close()
+}
+
+// PodFiles writes the packets of each pod to its own file in a directory.
+// Packets from unknown pods are ignored.
+type PodFiles struct {
+	writers map[string]fileWriter
+	dir     string
+	opts    Opts
+}
+
+// NewPodFiles creates one file per pod in dir, named after the pod.
+func NewPodFiles(dir string, pods []v1.Pod, opts Opts) (*PodFiles, error) {
+	if err := opts.Rotation.Validate(); err != nil {
+		return nil, err
+	}
+	p := &PodFiles{writers: make(map[string]fileWriter, len(pods)), dir: dir, opts: opts}
+	for _, pod := range pods {
+		if err := p.AddPod(pod); err != nil {
+			p.Close()
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// AddPod opens the file of a pod, the file of a known pod is kept.
+func (p *PodFiles) AddPod(pod v1.Pod) error {
+	if _, ok := p.writers[pod.Name]; ok {
+		return nil
+	}
+	w, err := openFile(filepath.Join(p.dir, pod.Name+p.opts.Format.Ext()), []v1.Pod{pod}, p.opts)
+	if err != nil {
+		return err
+	}
+	p.writers[pod.Name] = w
+	return nil
+}
+
+func (p *PodFiles) Write(pkt *capture.PacketDescriptor) error {
+	w, ok := p.writers[pkt.GetName()]
+	if !ok {
+		return nil
+	}
+	return w.writePacket(pkt.GetName(), captureInfo(pkt), pkt.GetPacket().GetData())
+}
+
+// MarkGap annotates the gap in the file of the pod.
+func (p *PodFiles) MarkGap(pod v1.Pod, g Gap) error {
+	w, ok := p.writers[pod.Name]
+	if !ok {
+		return nil
+	}
+	return w.markGap(pod, g)
+}
+
+// Close closes all the files and returns the first error.
+func (p *PodFiles) Close() error {
+	var err error
+	for _, w := range p.writers {
+		if errClose := w.Close(); errClose != nil && err == nil {
+			err = errClose
+		}
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package sink
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "output", "kpture.pcap")
+
+	_, err := NewFile(path, testPods, LoadOpts(WithRotation(Rotation{Count: 1})))
+	assert.Error(t, err)
+
+	f, err := NewFile(path, testPods, LoadOpts())
+	assert.NoError(t, err)
+	assert.NoError(t, f.Write(testPacket("pod1", 10)))
+	assert.NoError(t, f.Write(testPacket("pod2", 10)))
+	assert.NoError(t, f.Write(testPacket("unknown", 10)))
+	assert.NoError(t, f.Close())
+	assert.Equal(t, countPackets(t, path), 3)
+
+	f, err = NewFile(path, testPods, LoadOpts(WithRotation(Rotation{Interval: time.Hour})))
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	files, err := filepath.Glob(filepath.Join(dir, "output", "kpture-00001-*.pcap"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestPodFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := NewPodFiles(dir, testPods, LoadOpts(WithRotation(Rotation{Count: 1})))
+	assert.Error(t, err)
+
+	p, err := NewPodFiles(dir, testPods, LoadOpts())
+	assert.NoError(t, err)
+	assert.NoError(t, p.Write(testPacket("pod1", 10)))
+	assert.NoError(t, p.Write(testPacket("pod1", 10)))
+	assert.NoError(t, p.Write(testPacket("pod2", 10)))
+	// unknown pods are ignored
+	assert.NoError(t, p.Write(testPacket("unknown", 10)))
+	assert.NoError(t, p.Close())
+
+	assert.Equal(t, countPackets(t, filepath.Join(dir, "pod1.pcap")), 2)
+	assert.Equal(t, countPackets(t, filepath.Join(dir, "pod2.pcap")), 1)
+	_, err = os.Stat(filepath.Join(dir, "unknown.pcap"))
+	assert.True(t, os.IsNotExist(err))
+
+	p, err = NewPodFiles(dir, testPods, LoadOpts(WithFormat(FormatPcapng)))
+	assert.NoError(t, err)
+	assert.NoError(t, p.Close())
+	_, err = os.Stat(filepath.Join(dir, "pod1.pcapng"))
+	assert.NoError(t, err)
+}
+
+func TestPodFilesAddPod(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewPodFiles(dir, testPods, LoadOpts())
+	assert.NoError(t, err)
+	assert.NoError(t, p.Write(testPacket("pod1", 10)))
+	assert.NoError(t, p.AddPod(newPod))
+	// known pods keep their file
+	assert.NoError(t, p.AddPod(testPods[0]))
+	assert.NoError(t, p.Write(testPacket("pod3", 10)))
+	assert.NoError(t, p.Write(testPacket("pod1", 10)))
+	assert.NoError(t, p.Close())
+
+	assert.Equal(t, countPackets(t, filepath.Join(dir, "pod1.pcap")), 2)
+	assert.Equal(t, countPackets(t, filepath.Join(dir, "pod3.pcap")), 1)
+}
+
+func TestFilesMarkGap(t *testing.T) {
+	dir := t.TempDir()
+	opts := LoadOpts(WithFormat(FormatPcapng))
+	p, err := NewPodFiles(dir, testPods, opts)
+	assert.NoError(t, err)
+	f, err := NewFile(filepath.Join(dir, "kpture.pcapng"), testPods, opts)
+	assert.NoError(t, err)
+	s := Multi(p, f)
+	assert.NoError(t, MarkGap(s, testPods[0], testGap))
+	// unknown pods have no file
+	assert.NoError(t, MarkGap(s, newPod, testGap))
+	assert.NoError(t, s.Close())
+}
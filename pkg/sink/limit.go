@@ -0,0 +1,167 @@
+package sink
+
+import (
+	"errors"
+
+	capture "github.com/gmtstephane/kpture/api/kpture"
+	v1 "k8s.io/api/core/v1"
+)
+
+// ErrLimitReached is returned by a limited sink once its limits are reached.
+var ErrLimitReached = errors.New("capture limit reached")
+
+// Limits stops a capture after a number of packets or bytes, 0 means no limit.
+type Limits struct {
+	Packets int64 // number of packets
+	Bytes   int64 // captured bytes, the budget is never exceeded
+	PerPod  bool  // apply the limits to each pod instead of the whole capture
+}
+
+// Enabled returns true when a limit is set
+func (l Limits) Enabled() bool {
+	return l.Packets > 0 || l.Bytes > 0
+}
+
+// Validate checks the limits values
+func (l Limits) Validate() error {
+	if l.Packets < 0 || l.Bytes < 0 {
+		return errors.New("limits must be positive")
+	}
+	return nil
+}
+
+// usage counts the packets and bytes written
+type usage struct {
+	packets int64
+	bytes   int64
+	done    bool
+	ended   bool // the pod ended before reaching its limits
+}
+
+// limited writes to a sink until the limits are reached
+type limited struct {
+	s Sink
+	Limits
+	total    usage
+	pods     map[string]*usage
+	expected int
+}
+
+// Limit returns a sink writing to s until the limits are reached.
+// With per pod limits, the packets of a pod over its limits are dropped
+// and ErrLimitReached is returned once every pod reached its limits or ended.
+func Limit(s Sink, l Limits, pods []v1.Pod) Sink {
+	m := &limited{
+		s:      s,
+		Limits: l,
+		pods:   make(map[string]*usage, len(pods)),
+	}
+	for _, pod := range pods {
+		m.pods[pod.Name] = &usage{}
+	}
+	m.expected = len(pods)
+	return m
+}
+
+func (m *limited) Write(p *capture.PacketDescriptor) error {
+	if !m.Enabled() {
+		return m.s.Write(p)
+	}
+
+	u := &m.total
+	if m.PerPod {
+		pod, ok := m.pods[p.GetName()]
+		if !ok {
+			return m.s.Write(p)
+		}
+		u = pod
+	}
+	if u.done {
+		return m.done()
+	}
+
+	size := int64(len(p.GetPacket().GetData()))
+	if m.Bytes > 0 && u.bytes+size > m.Bytes {
+		u.done = true
+		return m.reached()
+	}
+	if err := m.s.Write(p); err != nil {
+		return err
+	}
+	u.packets++
+	u.bytes += size
+	if (m.Packets > 0 && u.packets >= m.Packets) || (m.Bytes > 0 && u.bytes >= m.Bytes) {
+		u.done = true
+		return m.reached()
+	}
+	return nil
+}
+
+// reached is called when a limit has just been reached
+func (m *limited) reached() error {
+	if !m.PerPod {
+		return ErrLimitReached
+	}
+	m.expected--
+	return m.done()
+}
+
+// done returns ErrLimitReached when all the limits are reached
+func (m *limited) done() error {
+	if !m.PerPod || m.expected <= 0 {
+		return ErrLimitReached
+	}
+	return nil
+}
+
+// AddPod adds the limits of a new pod, a recreated pod which ended is expected again.
+func (m *limited) AddPod(pod v1.Pod) error {
+	if u, ok := m.pods[pod.Name]; !ok {
+		m.pods[pod.Name] = &usage{}
+		m.expected++
+	} else {
+		m.revive(u)
+	}
+	return AddPod(m.s, pod)
+}
+
+// MarkGap revives an ended pod, its agent was attached again.
+func (m *limited) MarkGap(pod v1.Pod, g Gap) error {
+	if u, ok := m.pods[pod.Name]; ok {
+		m.revive(u)
+	}
+	return MarkGap(m.s, pod, g)
+}
+
+// EndPod counts the pod as done, it will not reach its limits.
+// ErrLimitReached is returned if every other pod is done.
+func (m *limited) EndPod(name string) error {
+	if err := EndPod(m.s, name); err != nil {
+		return err
+	}
+	u, ok := m.pods[name]
+	if !ok || u.done {
+		return nil
+	}
+	u.done, u.ended = true, true
+	if !m.Enabled() || !m.PerPod {
+		return nil
+	}
+	m.expected--
+	return m.done()
+}
+
+// revive expects the packets of an ended pod again
+func (m *limited) revive(u *usage) {
+	if !u.ended {
+		return
+	}
+	u.done, u.ended = false, false
+	if m.Enabled() && m.PerPod {
+		m.expected++
+	}
+}
+
+func (m *limited) Close() error {
+	return m.s.Close()
+}
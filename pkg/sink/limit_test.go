@@ -0,0 +1,98 @@
+package sink
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitPackets(t *testing.T) {
+	mock := &sinkMock{}
+	s := Limit(mock, Limits{Packets: 3}, testPods)
+
+	assert.NoError(t, s.Write(testPacket("pod1", 10)))
+	assert.NoError(t, s.Write(testPacket("pod2", 10)))
+	assert.ErrorIs(t, s.Write(testPacket("pod1", 10)), ErrLimitReached)
+	assert.ErrorIs(t, s.Write(testPacket("pod1", 10)), ErrLimitReached)
+	assert.Len(t, mock.packets, 3)
+
+	assert.NoError(t, s.Close())
+	assert.True(t, mock.closed)
+}
+
+func TestLimitBytes(t *testing.T) {
+	mock := &sinkMock{}
+	s := Limit(mock, Limits{Bytes: 25}, testPods)
+
+	assert.NoError(t, s.Write(testPacket("pod1", 10)))
+	assert.NoError(t, s.Write(testPacket("pod1", 10)))
+	// the budget is never exceeded
+	assert.ErrorIs(t, s.Write(testPacket("pod1", 10)), ErrLimitReached)
+	assert.Len(t, mock.packets, 2)
+}
+
+func TestLimitPerPod(t *testing.T) {
+	mock := &sinkMock{}
+	s := Limit(mock, Limits{Packets: 2, PerPod: true}, testPods)
+
+	assert.NoError(t, s.Write(testPacket("pod1", 10)))
+	assert.NoError(t, s.Write(testPacket("pod1", 10)))
+	// pod1 is done, its packets are dropped
+	assert.NoError(t, s.Write(testPacket("pod1", 10)))
+	// unknown pods are not limited
+	assert.NoError(t, s.Write(testPacket("unknown", 10)))
+	assert.NoError(t, s.Write(testPacket("pod2", 10)))
+	assert.ErrorIs(t, s.Write(testPacket("pod2", 10)), ErrLimitReached)
+	assert.Len(t, mock.packets, 5)
+}
+
+func TestLimitDisabled(t *testing.T) {
+	mock := &sinkMock{}
+	s := Limit(mock, Limits{}, testPods)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, s.Write(testPacket("pod1", 10)))
+	}
+	assert.Len(t, mock.packets, 10)
+
+	mock.writeErr = errMock
+	assert.ErrorIs(t, Limit(mock, Limits{Packets: 1}, testPods).Write(testPacket("pod1", 10)), errMock)
+
+	assert.Error(t, Limits{Packets: -1}.Validate())
+	assert.NoError(t, Limits{Packets: 1}.Validate())
+}
+
+func TestLimitAddPod(t *testing.T) {
+	mock := &sinkMock{}
+	s := Limit(mock, Limits{Packets: 1, PerPod: true}, testPods)
+	assert.NoError(t, AddPod(s, newPod))
+	assert.Equal(t, []string{"pod3"}, mock.added)
+
+	assert.NoError(t, s.Write(testPacket("pod1", 10)))
+	assert.NoError(t, s.Write(testPacket("pod2", 10)))
+	// the new pod must reach its limit too
+	assert.ErrorIs(t, s.Write(testPacket("pod3", 10)), ErrLimitReached)
+}
+
+func TestLimitEndPod(t *testing.T) {
+	mock := &sinkMock{}
+	s := Limit(mock, Limits{Packets: 2, PerPod: true}, testPods)
+
+	// an ended pod is done, the capture stops when the others reach their limits
+	assert.NoError(t, EndPod(s, "pod2"))
+	assert.NoError(t, EndPod(s, "unknown"))
+	assert.NoError(t, s.Write(testPacket("pod1", 10)))
+	assert.ErrorIs(t, s.Write(testPacket("pod1", 10)), ErrLimitReached)
+
+	// or when the last pod ends
+	s = Limit(mock, Limits{Packets: 2, PerPod: true}, testPods)
+	assert.NoError(t, s.Write(testPacket("pod1", 10)))
+	assert.NoError(t, s.Write(testPacket("pod1", 10)))
+	assert.ErrorIs(t, EndPod(s, "pod2"), ErrLimitReached)
+
+	// a recreated pod is expected again
+	s = Limit(mock, Limits{Packets: 1, PerPod: true}, testPods)
+	assert.NoError(t, EndPod(s, "pod2"))
+	assert.NoError(t, MarkGap(s, testPods[1], Gap{}))
+	assert.NoError(t, s.Write(testPacket("pod1", 10)))
+	assert.ErrorIs(t, s.Write(testPacket("pod2", 10)), ErrLimitReached)
+}
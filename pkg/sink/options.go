@@ -0,0 +1,149 @@
+package sink
+
+import (
+	"errors"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+type Opt func(o Opts) Opts
+
+// Format is the file format written by the sinks
+type Format string
+
+// Output formats.
+const (
+	FormatPcap   Format = "pcap"
+	FormatPcapng Format = "pcapng"
+)
+
+// ParseFormat checks that s is a supported format
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case FormatPcap, FormatPcapng:
+		return Format(s), nil
+	default:
+		return "", errors.New("unsupported output format " + s + ", must be pcap or pcapng")
+	}
+}
+
+// Ext returns the file extension of the format
+func (f Format) Ext() string {
+	return "." + string(f)
+}
+
+// Rotation holds the tcpdump like ring buffer options (-C, -G, -W).
+type Rotation struct {
+	MaxSize  int64         // rotate when the file is bigger than MaxSize bytes
+	Interval time.Duration // rotate when the file is older than Interval
+	Count    int           // number of files kept, 0 keeps all of them
+}
+
+// Enabled returns true when the files must be rotated
+func (r Rotation) Enabled() bool {
+	return r.MaxSize > 0 || r.Interval > 0
+}
+
+// Validate checks the rotation values
+func (r Rotation) Validate() error {
+	if r.MaxSize < 0 || r.Interval < 0 || r.Count < 0 {
+		return errors.New("rotation values must be positive")
+	}
+	if r.Count > 0 && !r.Enabled() {
+		return errors.New("file count requires a max size or a rotation interval")
+	}
+	return nil
+}
+
+// Sink Options.
+const (
+	defaultFormat  = FormatPcap
+	defaultSnapLen = uint32(65535)
+)
+
+// Opts are the options of the file and stream sinks
+type Opts struct {
+	Format      Format      // file format
+	SnapLen     uint32      // snapshot length written in the file headers
+	Filter      string      // capture filter recorded in the pcapng interfaces
+	Rotation    Rotation    // ring buffer of files, only used by file sinks
+	Compression Compression // streaming compression, only used by file sinks
+
+	// PodFilter returns the capture filter of a pod, an empty filter falls back to Filter
+	PodFilter func(pod v1.Pod) string
+}
+
+func defaultOpts() Opts {
+	return Opts{
+		Format:  defaultFormat,
+		SnapLen: defaultSnapLen,
+	}
+}
+
+// LoadOpts loads the sink options
+func LoadOpts(os ...Opt) Opts {
+	opts := defaultOpts()
+	for _, o := range os {
+		opts = o(opts)
+	}
+	return opts
+}
+
+// WithFormat sets the file format
+func WithFormat(f Format) Opt {
+	return func(o Opts) Opts {
+		o.Format = f
+		return o
+	}
+}
+
+// WithSnapLen sets the snapshot length
+func WithSnapLen(n uint32) Opt {
+	return func(o Opts) Opts {
+		o.SnapLen = n
+		return o
+	}
+}
+
+// WithFilter sets the capture filter
+func WithFilter(f string) Opt {
+	return func(o Opts) Opts {
+		o.Filter = f
+		return o
+	}
+}
+
+// WithPodFilter sets the function returning the capture filter of each pod
+func WithPodFilter(f func(pod v1.Pod) string) Opt {
+	return func(o Opts) Opts {
+		o.PodFilter = f
+		return o
+	}
+}
+
+// filter returns the capture filter of the pod
+func (o Opts) filter(pod v1.Pod) string {
+	if o.PodFilter != nil {
+		if f := o.PodFilter(pod); f != "" {
+			return f
+		}
+	}
+	return o.Filter
+}
+
+// WithRotation sets the files rotation
+func WithRotation(r Rotation) Opt {
+	return func(o Opts) Opts {
+		o.Rotation = r
+		return o
+	}
+}
+
+// WithCompression sets the files compression
+func WithCompression(c Compression) Opt {
+	return func(o Opts) Opts {
+		o.Compression = c
+		return o
+	}
+}
@@ -0,0 +1,44 @@
+package sink
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadOpts(t *testing.T) {
+	opts := LoadOpts()
+	assert.Equal(t, opts, defaultOpts())
+
+	r := Rotation{MaxSize: 10, Count: 2}
+	opts = LoadOpts(WithFormat(FormatPcapng), WithSnapLen(1500), WithFilter("port 80"), WithRotation(r))
+	assert.Equal(t, opts.Format, FormatPcapng)
+	assert.Equal(t, opts.SnapLen, uint32(1500))
+	assert.Equal(t, opts.Filter, "port 80")
+	assert.Equal(t, opts.Rotation, r)
+}
+
+func TestParseFormat(t *testing.T) {
+	f, err := ParseFormat("pcap")
+	assert.NoError(t, err)
+	assert.Equal(t, f.Ext(), ".pcap")
+
+	f, err = ParseFormat("pcapng")
+	assert.NoError(t, err)
+	assert.Equal(t, f.Ext(), ".pcapng")
+
+	_, err = ParseFormat("json")
+	assert.Error(t, err)
+}
+
+func TestRotation(t *testing.T) {
+	assert.False(t, Rotation{}.Enabled())
+	assert.NoError(t, Rotation{}.Validate())
+	assert.True(t, Rotation{MaxSize: 1}.Enabled())
+	assert.True(t, Rotation{Interval: time.Second}.Enabled())
+
+	assert.Error(t, Rotation{MaxSize: -1}.Validate())
+	assert.Error(t, Rotation{Count: 2}.Validate())
+	assert.NoError(t, Rotation{Interval: time.Second, Count: 2}.Validate())
+}
@@ -0,0 +1,295 @@
+package sink
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	capture "github.com/gmtstephane/kpture/api/kpture"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	v1 "k8s.io/api/core/v1"
+)
+
+// packetWriter is implemented by the pcap and pcapng file writers.
+// the pod name is used by the pcapng writer to select the interface of the packet.
+type packetWriter interface {
+	writePacket(pod string, ci gopacket.CaptureInfo, data []byte) error
+	addPod(pod v1.Pod) error
+	markGap(pod v1.Pod, g Gap) error
+	flush() error
+}
+
+// newPacketWriter creates a writer in the configured format.
+// pcapng writers get one interface per pod, classic pcap writers ignore the pods.
+// live writers are flushed after each packet so that the output can be piped.
+func newPacketWriter(o io.Writer, pods []v1.Pod, opts Opts, live bool) (packetWriter, error) {
+	if opts.Format == FormatPcapng {
+		return newNgPodWriter(o, pods, opts, live)
+	}
+	return &pcapPodWriter{w: pcapgo.NewWriterNanos(o), snapLen: opts.SnapLen, skipped: map[layers.LinkType]bool{}}, nil
+}
+
+// captureInfo converts the packet capture info, keeping the agent capture time.
+// older agents may not send it, the receive time is used instead.
+func captureInfo(p *capture.PacketDescriptor) gopacket.CaptureInfo {
+	ts := p.GetPacket().GetCaptureInfo().Time()
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	ci := gopacket.CaptureInfo{
+		Timestamp:      ts,
+		CaptureLength:  int(p.GetPacket().GetCaptureInfo().GetCaptureLength()),
+		Length:         int(p.GetPacket().GetCaptureInfo().GetLength()),
+		InterfaceIndex: int(p.GetPacket().GetCaptureInfo().GetInterfaceIndex()),
+	}
+	ci.AncillaryData = append(ci.AncillaryData, packetMeta{
+		intf: p.GetPacket().GetCaptureInfo().GetInterfaceName(),
+		link: p.GetPacket().GetCaptureInfo().Link(),
+	})
+	return ci
+}
+
+// packetMeta is the agent metadata of a packet, stored in its ancillary data
+type packetMeta struct {
+	intf string // name of the pod interface, older agents do not send it
+	link layers.LinkType
+}
+
+// metadata returns the agent metadata of a packet, packets without metadata are read as ethernet.
+func metadata(ci gopacket.CaptureInfo) packetMeta {
+	for _, d := range ci.AncillaryData {
+		if m, ok := d.(packetMeta); ok {
+			return m
+		}
+	}
+	return packetMeta{link: layers.LinkTypeEthernet}
+}
+
+// pcapPodWriter writes classic pcap, all the pods share the link type of the first packet.
+// The file header is written with the first packet, or as ethernet when the file is flushed before.
+type pcapPodWriter struct {
+	w       *pcapgo.Writer
+	snapLen uint32
+	link    layers.LinkType
+	header  bool
+	// skipped are the other link types whose packets are dropped
+	skipped map[layers.LinkType]bool
+}
+
+func (p *pcapPodWriter) writeHeader(link layers.LinkType) error {
+	if p.header {
+		return nil
+	}
+	p.header, p.link = true, link
+	return p.w.WriteFileHeader(p.snapLen, link)
+}
+
+// writePacket drops the packets of other link types with a warning, a pcap file has a single link type.
+func (p *pcapPodWriter) writePacket(_ string, ci gopacket.CaptureInfo, data []byte) error {
+	link := metadata(ci).link
+	if err := p.writeHeader(link); err != nil {
+		return err
+	}
+	if link != p.link {
+		if !p.skipped[link] {
+			p.skipped[link] = true
+			log.Printf("pcap output has link type %s, %s packets are dropped, use the pcapng format", p.link, link)
+		}
+		return nil
+	}
+	return p.w.WritePacket(ci, data)
+}
+
+func (p *pcapPodWriter) addPod(v1.Pod) error {
+	return nil
+}
+
+// markGap is a no-op, classic pcap files have no comments.
+func (p *pcapPodWriter) markGap(v1.Pod, Gap) error {
+	return nil
+}
+
+func (p *pcapPodWriter) flush() error {
+	return p.writeHeader(layers.LinkTypeEthernet)
+}
+
+// ngPodWriter writes pcapng with one interface description block per pod and per captured interface.
+type ngPodWriter struct {
+	w          *pcapgo.NgWriter
+	pods       map[string]v1.Pod
+	interfaces map[string]int
+	links      map[int]layers.LinkType // link type of each interface
+	gaps       map[string]Gap
+	opts       Opts
+	live       bool
+}
+
+func newNgPodWriter(o io.Writer, pods []v1.Pod, opts Opts, live bool) (*ngPodWriter, error) {
+	section := pcapgo.DefaultNgWriterOptions
+	section.SectionInfo.Application = "kpture"
+	if len(pods) == 1 {
+		section.SectionInfo.Comment = podComment(pods[0])
+	} else {
+		section.SectionInfo.Comment = capturedPodsComment(pods)
+	}
+
+	// the first interface is always written by pcapgo, it is used for packets from unknown pods
+	unknown := pcapgo.DefaultNgInterface
+	unknown.Name = "unknown"
+	unknown.LinkType = layers.LinkTypeEthernet
+	unknown.SnapLength = opts.SnapLen
+	w, err := pcapgo.NewNgWriterInterface(o, unknown, section)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &ngPodWriter{
+		w:          w,
+		pods:       make(map[string]v1.Pod, len(pods)),
+		interfaces: make(map[string]int),
+		links:      make(map[int]layers.LinkType),
+		gaps:       make(map[string]Gap),
+		opts:       opts,
+		live:       live,
+	}
+	for _, pod := range pods {
+		n.pods[pod.Name] = pod
+		if _, err = n.interfaceID(pod.Name, 0, packetMeta{link: layers.LinkTypeEthernet}); err != nil {
+			return nil, err
+		}
+	}
+	if live {
+		return n, n.w.Flush()
+	}
+	return n, nil
+}
+
+// interfaceID returns the pcapng interface of a pod interface, adding it to the file if needed.
+// The first interface of a pod is written as ethernet before its name is known, the other ones
+// are named after the pod interface. An interface is described again when its link type changes.
+func (n *ngPodWriter) interfaceID(pod string, index int, m packetMeta) (int, error) {
+	key := fmt.Sprintf("%s/%d", pod, index)
+	if id, ok := n.interfaces[key]; ok && n.links[id] == m.link {
+		return id, nil
+	}
+	p, ok := n.pods[pod]
+	if !ok {
+		return 0, nil
+	}
+
+	intf := pcapgo.DefaultNgInterface
+	intf.Name = p.Namespace + "/" + p.Name
+	intf.Description = "kpture capture of pod " + p.Name
+	switch {
+	case index == 0:
+	case m.intf != "":
+		intf.Name += ":" + m.intf
+		intf.Description += " on " + m.intf
+	default:
+		intf.Name = fmt.Sprintf("%s:%d", intf.Name, index)
+	}
+	intf.Comment = podComment(p)
+	if gap, found := n.gaps[pod]; found {
+		intf.Comment += "\ngap: " + gap.String()
+	}
+	intf.Filter = n.opts.filter(p)
+	intf.LinkType = m.link
+	intf.SnapLength = n.opts.SnapLen
+	id, err := n.w.AddInterface(intf)
+	if err != nil {
+		return 0, err
+	}
+	n.interfaces[key] = id
+	n.links[id] = m.link
+	return id, nil
+}
+
+func (n *ngPodWriter) writePacket(pod string, ci gopacket.CaptureInfo, data []byte) error {
+	id, err := n.interfaceID(pod, ci.InterfaceIndex, metadata(ci))
+	if err != nil {
+		return err
+	}
+	ci.InterfaceIndex = id
+	if err = n.w.WritePacket(ci, data); err != nil {
+		return err
+	}
+	if n.live {
+		return n.w.Flush()
+	}
+	return nil
+}
+
+// addPod adds the interface of a pod that started during the capture.
+func (n *ngPodWriter) addPod(pod v1.Pod) error {
+	if _, ok := n.pods[pod.Name]; ok {
+		return nil
+	}
+	n.pods[pod.Name] = pod
+	if _, err := n.interfaceID(pod.Name, 0, packetMeta{link: layers.LinkTypeEthernet}); err != nil {
+		return err
+	}
+	if n.live {
+		return n.w.Flush()
+	}
+	return nil
+}
+
+// markGap describes the pod interfaces again, the new interfaces are commented with the gap.
+func (n *ngPodWriter) markGap(pod v1.Pod, g Gap) error {
+	n.pods[pod.Name] = pod
+	n.gaps[pod.Name] = g
+	for key := range n.interfaces {
+		if strings.HasPrefix(key, pod.Name+"/") {
+			delete(n.interfaces, key)
+		}
+	}
+	if _, err := n.interfaceID(pod.Name, 0, packetMeta{link: layers.LinkTypeEthernet}); err != nil {
+		return err
+	}
+	if n.live {
+		return n.w.Flush()
+	}
+	return nil
+}
+
+func (n *ngPodWriter) flush() error {
+	return n.w.Flush()
+}
+
+// podComment formats the pod metadata stored in the pcapng comments.
+func podComment(pod v1.Pod) string {
+	ips := []string{}
+	for _, ip := range pod.Status.PodIPs {
+		ips = append(ips, ip.IP)
+	}
+	if len(ips) == 0 && pod.Status.PodIP != "" {
+		ips = append(ips, pod.Status.PodIP)
+	}
+
+	labels := []string{}
+	for k, v := range pod.Labels {
+		labels = append(labels, k+"="+v)
+	}
+	sort.Strings(labels)
+
+	return strings.Join([]string{
+		"pod: " + pod.Namespace + "/" + pod.Name,
+		"node: " + pod.Spec.NodeName,
+		"ips: " + strings.Join(ips, ","),
+		"labels: " + strings.Join(labels, ","),
+	}, "\n")
+}
+
+// capturedPodsComment formats the section comment of a file shared by several pods.
+func capturedPodsComment(pods []v1.Pod) string {
+	names := []string{}
+	for _, pod := range pods {
+		names = append(names, pod.Namespace+"/"+pod.Name)
+	}
+	return "kpture capture of pods: " + strings.Join(names, ",")
+}
@@ -0,0 +1,240 @@
+package sink
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestNewPacketWriterPcap(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := newPacketWriter(buf, testPods, LoadOpts(), false)
+	assert.NoError(t, err)
+
+	p := testPacket("pod1", 42)
+	assert.NoError(t, w.writePacket("pod1", captureInfo(p), p.Packet.Data))
+	assert.NoError(t, w.flush())
+
+	r, err := pcapgo.NewReader(buf)
+	assert.NoError(t, err)
+	data, ci, err := r.ReadPacketData()
+	assert.NoError(t, err)
+	assert.Len(t, data, 42)
+	assert.Equal(t, ci.Timestamp.UnixNano(), testTime.UnixNano())
+}
+
+func TestNewPacketWriterPcapng(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := newPacketWriter(buf, testPods, LoadOpts(WithFormat(FormatPcapng), WithFilter("port 80")), false)
+	assert.NoError(t, err)
+
+	for _, pod := range []string{"pod2", "pod1", "unknown-pod"} {
+		p := testPacket(pod, 42)
+		assert.NoError(t, w.writePacket(pod, captureInfo(p), p.Packet.Data))
+	}
+	// a second interface of pod1
+	p := testPacket("pod1", 42)
+	ci := captureInfo(p)
+	ci.InterfaceIndex = 3
+	assert.NoError(t, w.writePacket("pod1", ci, p.Packet.Data))
+	// a named secondary interface of pod2
+	p = testPacket("pod2", 42)
+	p.Packet.CaptureInfo.InterfaceIndex = 1
+	p.Packet.CaptureInfo.InterfaceName = "net1"
+	assert.NoError(t, w.writePacket("pod2", captureInfo(p), p.Packet.Data))
+	assert.NoError(t, w.flush())
+
+	r, err := pcapgo.NewNgReader(buf, pcapgo.DefaultNgReaderOptions)
+	assert.NoError(t, err)
+	assert.Equal(t, r.SectionInfo().Comment, "kpture capture of pods: ns-test/pod1,ns-test/pod2")
+
+	names := []string{}
+	for {
+		_, ci, errRead := r.ReadPacketData()
+		if errRead == io.EOF {
+			break
+		}
+		assert.NoError(t, errRead)
+		assert.Equal(t, ci.Timestamp.UnixNano(), testTime.UnixNano())
+		intf, errIntf := r.Interface(ci.InterfaceIndex)
+		assert.NoError(t, errIntf)
+		names = append(names, intf.Name)
+	}
+	assert.Equal(t, names, []string{"ns-test/pod2", "ns-test/pod1", "unknown", "ns-test/pod1:3", "ns-test/pod2:net1"})
+
+	intf, err := r.Interface(1)
+	assert.NoError(t, err)
+	assert.Equal(t, intf.Filter, "port 80")
+	assert.Equal(t, intf.Comment, podComment(testPods[0]))
+}
+
+func TestPacketWriterPodFilter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	opts := LoadOpts(WithFormat(FormatPcapng), WithFilter("tcp"), WithPodFilter(func(pod v1.Pod) string {
+		if pod.Name == "pod1" {
+			return "port 8080"
+		}
+		return ""
+	}))
+	w, err := newPacketWriter(buf, testPods, opts, false)
+	assert.NoError(t, err)
+	for _, pod := range []string{"pod1", "pod2"} {
+		p := testPacket(pod, 42)
+		assert.NoError(t, w.writePacket(pod, captureInfo(p), p.Packet.Data))
+	}
+	assert.NoError(t, w.flush())
+
+	r, err := pcapgo.NewNgReader(buf, pcapgo.DefaultNgReaderOptions)
+	assert.NoError(t, err)
+	filters := []string{}
+	for {
+		_, ci, errRead := r.ReadPacketData()
+		if errRead == io.EOF {
+			break
+		}
+		assert.NoError(t, errRead)
+		intf, errIntf := r.Interface(ci.InterfaceIndex)
+		assert.NoError(t, errIntf)
+		filters = append(filters, intf.Filter)
+	}
+	assert.Equal(t, []string{"port 8080", "tcp"}, filters)
+}
+
+func Test_podComment(t *testing.T) {
+	assert.Equal(t, podComment(testPods[0]),
+		"pod: ns-test/pod1\nnode: node1\nips: 10.0.0.1,fd00::1\nlabels: app=nginx,tier=front")
+	assert.Equal(t, podComment(testPods[1]),
+		"pod: ns-test/pod2\nnode: node2\nips: 10.0.0.2\nlabels: ")
+}
+
+func Test_captureInfo(t *testing.T) {
+	p := testPacket("pod1", 10)
+	ci := captureInfo(p)
+	assert.Equal(t, ci.Timestamp, testTime)
+	assert.Equal(t, ci.CaptureLength, 10)
+
+	// older agents only send seconds
+	p.Packet.CaptureInfo.TimestampNano = 0
+	ci = captureInfo(p)
+	assert.Equal(t, ci.Timestamp.Unix(), testTime.Unix())
+	assert.Zero(t, ci.Timestamp.Nanosecond())
+
+	// no timestamp at all
+	p.Packet.CaptureInfo.Timestamp = 0
+	ci = captureInfo(p)
+	assert.False(t, ci.Timestamp.IsZero())
+	assert.Equal(t, packetMeta{link: layers.LinkTypeEthernet}, metadata(ci))
+	assert.Equal(t, packetMeta{link: layers.LinkTypeEthernet}, metadata(gopacket.CaptureInfo{}))
+
+	p.Packet.CaptureInfo.InterfaceName = "tun0"
+	p.Packet.CaptureInfo.SetLink(layers.LinkTypeRaw)
+	assert.Equal(t, packetMeta{intf: "tun0", link: layers.LinkTypeRaw}, metadata(captureInfo(p)))
+}
+
+func TestPacketWriterPcapLinkType(t *testing.T) {
+	// the header has the link type of the first packet, other link types are dropped
+	buf := &bytes.Buffer{}
+	w, err := newPacketWriter(buf, testPods, LoadOpts(), false)
+	assert.NoError(t, err)
+	raw := testPacket("pod1", 40)
+	raw.Packet.CaptureInfo.SetLink(layers.LinkTypeRaw)
+	assert.NoError(t, w.writePacket("pod1", captureInfo(raw), raw.Packet.Data))
+	p := testPacket("pod2", 42)
+	assert.NoError(t, w.writePacket("pod2", captureInfo(p), p.Packet.Data))
+	null := testPacket("pod2", 44)
+	null.Packet.CaptureInfo.SetLink(layers.LinkTypeNull)
+	assert.NoError(t, w.writePacket("pod2", captureInfo(null), null.Packet.Data))
+	assert.NoError(t, w.flush())
+
+	r, err := pcapgo.NewReader(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, layers.LinkTypeRaw, r.LinkType())
+	data, _, err := r.ReadPacketData()
+	assert.NoError(t, err)
+	assert.Len(t, data, 40)
+	_, _, err = r.ReadPacketData()
+	assert.Equal(t, io.EOF, err)
+
+	// files without packets are written as ethernet
+	buf = &bytes.Buffer{}
+	w, err = newPacketWriter(buf, testPods, LoadOpts(), false)
+	assert.NoError(t, err)
+	assert.NoError(t, w.flush())
+	r, err = pcapgo.NewReader(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, layers.LinkTypeEthernet, r.LinkType())
+
+	// DLT_NULL is not read as the missing link type of older agents
+	buf = &bytes.Buffer{}
+	w, err = newPacketWriter(buf, testPods, LoadOpts(), false)
+	assert.NoError(t, err)
+	assert.NoError(t, w.writePacket("pod2", captureInfo(null), null.Packet.Data))
+	r, err = pcapgo.NewReader(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, layers.LinkTypeNull, r.LinkType())
+}
+
+func TestPacketWriterPcapngLinkType(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := newPacketWriter(buf, testPods, LoadOpts(WithFormat(FormatPcapng)), false)
+	assert.NoError(t, err)
+	p := testPacket("pod1", 40)
+	p.Packet.CaptureInfo.SetLink(layers.LinkTypeRaw)
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, w.writePacket("pod1", captureInfo(p), p.Packet.Data))
+	}
+	assert.NoError(t, w.flush())
+
+	// readers reject files with several link types by default
+	r, err := pcapgo.NewNgReader(buf, pcapgo.NgReaderOptions{WantMixedLinkType: true})
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, ci, errRead := r.ReadPacketData()
+		assert.NoError(t, errRead)
+		// the ethernet interface of pod1 is described again as raw ip
+		assert.Equal(t, 3, ci.InterfaceIndex)
+		intf, errIntf := r.Interface(ci.InterfaceIndex)
+		assert.NoError(t, errIntf)
+		assert.Equal(t, layers.LinkTypeRaw, intf.LinkType)
+		assert.Equal(t, "ns-test/pod1", intf.Name)
+	}
+}
+
+func TestPacketWriterMarkGap(t *testing.T) {
+	w, err := newPacketWriter(&bytes.Buffer{}, testPods, LoadOpts(), false)
+	assert.NoError(t, err)
+	assert.NoError(t, w.markGap(testPods[0], testGap))
+
+	buf := &bytes.Buffer{}
+	w, err = newPacketWriter(buf, testPods, LoadOpts(WithFormat(FormatPcapng)), true)
+	assert.NoError(t, err)
+	p := testPacket("pod1", 42)
+	assert.NoError(t, w.writePacket("pod1", captureInfo(p), p.Packet.Data))
+	// the pod was recreated with a new ip
+	recreated := *testPods[0].DeepCopy()
+	recreated.Status.PodIPs = []v1.PodIP{{IP: "10.0.0.9"}}
+	assert.NoError(t, w.markGap(recreated, testGap))
+	assert.NoError(t, w.writePacket("pod1", captureInfo(p), p.Packet.Data))
+
+	r, err := pcapgo.NewNgReader(buf, pcapgo.DefaultNgReaderOptions)
+	assert.NoError(t, err)
+	comments := []string{}
+	for {
+		_, ci, errRead := r.ReadPacketData()
+		if errRead == io.EOF {
+			break
+		}
+		assert.NoError(t, errRead)
+		intf, errIntf := r.Interface(ci.InterfaceIndex)
+		assert.NoError(t, errIntf)
+		assert.Equal(t, "ns-test/pod1", intf.Name)
+		comments = append(comments, intf.Comment)
+	}
+	assert.Equal(t, []string{podComment(testPods[0]), podComment(recreated) + "\ngap: " + testGap.String()}, comments)
+}
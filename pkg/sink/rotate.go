@@ -0,0 +1,154 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	v1 "k8s.io/api/core/v1"
+)
+
+// errRotatingClosed is returned by the writes after Close
+var errRotatingClosed = errors.New("rotating writer closed")
+
+// rotatingWriter writes packets to a ring of files.
+// Each file starts with a new header, the oldest file is removed when the ring is full.
+type rotatingWriter struct {
+	Rotation
+	base   string
+	ext    string
+	open   func(io.Writer) (packetWriter, error)
+	comp   Compression
+	seq    int
+	opened time.Time
+	out    *output
+	w      packetWriter
+	ring   []string
+	added  []v1.Pod
+}
+
+// newRotatingWriter creates the first file of the ring.
+// open is called on each new file to write its header.
+func newRotatingWriter(path string, r Rotation, c Compression, open func(io.Writer) (packetWriter, error)) (*rotatingWriter, error) {
+	ext := filepath.Ext(path)
+	rw := &rotatingWriter{
+		Rotation: r,
+		base:     strings.TrimSuffix(path, ext),
+		ext:      ext,
+		open:     open,
+		comp:     c,
+	}
+	if err := rw.rotate(); err != nil {
+		return nil, err
+	}
+	return rw, nil
+}
+
+// rotate opens the next file and closes the current one, the current file is kept
+// if the next one cannot be opened. files are named by sequence and opening time.
+func (r *rotatingWriter) rotate() error {
+	opened := time.Now()
+	name := fmt.Sprintf("%s-%05d-%s%s", r.base, r.seq+1, opened.Format("20060102T150405"), r.ext)
+	out, err := createOutput(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, r.comp)
+	if err != nil {
+		return err
+	}
+	w, err := r.open(out)
+	if err == nil {
+		for _, pod := range r.added {
+			if err = w.addPod(pod); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		out.Close()
+		os.Remove(name + r.comp.Ext())
+		return err
+	}
+
+	// the next file is written even if the current one is not closed cleanly
+	errClose := r.Close()
+	r.seq++
+	r.opened = opened
+	r.out, r.w = out, w
+
+	r.ring = append(r.ring, name+r.comp.Ext())
+	if r.Count > 0 && len(r.ring) > r.Count {
+		if err = os.Remove(r.ring[0]); err != nil {
+			log.Println(err)
+		}
+		r.ring = r.ring[1:]
+	}
+	return errClose
+}
+
+func (r *rotatingWriter) full() bool {
+	if r.MaxSize > 0 && r.out.size() >= r.MaxSize {
+		return true
+	}
+	return r.Interval > 0 && time.Since(r.opened) >= r.Interval
+}
+
+func (r *rotatingWriter) writePacket(pod string, ci gopacket.CaptureInfo, data []byte) error {
+	if r.out == nil {
+		return errRotatingClosed
+	}
+	if r.full() {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	if err := r.w.writePacket(pod, ci, data); err != nil {
+		return err
+	}
+	if r.MaxSize > 0 {
+		// buffered writers must be flushed for the size to be accurate,
+		// compressed files grow by blocks so their size is approximate.
+		return r.w.flush()
+	}
+	return nil
+}
+
+// addPod adds the pod to the current file and to the next ones.
+func (r *rotatingWriter) addPod(pod v1.Pod) error {
+	r.added = append(r.added, pod)
+	if r.w == nil {
+		return nil
+	}
+	return r.w.addPod(pod)
+}
+
+// markGap annotates the current file only.
+func (r *rotatingWriter) markGap(pod v1.Pod, g Gap) error {
+	if r.w == nil {
+		return nil
+	}
+	return r.w.markGap(pod, g)
+}
+
+func (r *rotatingWriter) flush() error {
+	if r.w == nil {
+		return nil
+	}
+	return r.w.flush()
+}
+
+// Close flushes and closes the current file.
+func (r *rotatingWriter) Close() error {
+	if r.out == nil {
+		return nil
+	}
+	if err := r.flush(); err != nil {
+		return err
+	}
+	err := r.out.Close()
+	r.out, r.w = nil, nil
+	return err
+}
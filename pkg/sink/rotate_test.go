@@ -0,0 +1,134 @@
+package sink
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+)
+
+// countPackets reads a pcap file and returns its number of packets
+func countPackets(t *testing.T, path string) int {
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	r, err := pcapgo.NewReader(f)
+	assert.NoError(t, err)
+	n := 0
+	for {
+		if _, _, err = r.ReadPacketData(); err != nil {
+			return n
+		}
+		n++
+	}
+}
+
+func TestRotatingWriter(t *testing.T) {
+	dir := t.TempDir()
+	open := func(o io.Writer) (packetWriter, error) {
+		return newPacketWriter(o, testPods, LoadOpts(), false)
+	}
+
+	// 24 bytes header + 2 packets of 16+40 bytes
+	r, err := newRotatingWriter(filepath.Join(dir, "kpture.pcap"), Rotation{MaxSize: 130, Count: 2}, CompressionNone, open)
+	assert.NoError(t, err)
+	for i := 0; i < 7; i++ {
+		p := testPacket("pod1", 40)
+		assert.NoError(t, r.writePacket("pod1", captureInfo(p), p.Packet.Data))
+	}
+	assert.NoError(t, r.Close())
+	assert.NoError(t, r.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "kpture-*.pcap"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+	assert.Contains(t, files[0], "kpture-00003-")
+	assert.Contains(t, files[1], "kpture-00004-")
+	// every rotated file starts with a valid header
+	assert.Equal(t, countPackets(t, files[0]), 2)
+	assert.Equal(t, countPackets(t, files[1]), 1)
+}
+
+func TestRotatingWriterInterval(t *testing.T) {
+	dir := t.TempDir()
+	open := func(o io.Writer) (packetWriter, error) {
+		return newPacketWriter(o, testPods, LoadOpts(), false)
+	}
+
+	r, err := newRotatingWriter(filepath.Join(dir, "pod1.pcap"), Rotation{Interval: 50 * time.Millisecond}, CompressionNone, open)
+	assert.NoError(t, err)
+	p := testPacket("pod1", 40)
+	assert.NoError(t, r.writePacket("pod1", captureInfo(p), p.Packet.Data))
+	time.Sleep(60 * time.Millisecond)
+	assert.NoError(t, r.writePacket("pod1", captureInfo(p), p.Packet.Data))
+	assert.NoError(t, r.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "pod1-*.pcap"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	_, err = newRotatingWriter(filepath.Join(dir, "missing", "pod1.pcap"), Rotation{Interval: time.Second}, CompressionNone, open)
+	assert.Error(t, err)
+}
+
+func TestRotatingWriterAddPod(t *testing.T) {
+	dir := t.TempDir()
+	open := func(o io.Writer) (packetWriter, error) {
+		return newPacketWriter(o, testPods[:1], LoadOpts(WithFormat(FormatPcapng)), false)
+	}
+	r, err := newRotatingWriter(filepath.Join(dir, "kpture.pcapng"), Rotation{Interval: time.Hour}, CompressionNone, open)
+	assert.NoError(t, err)
+	assert.NoError(t, r.addPod(newPod))
+	assert.NoError(t, r.rotate())
+	p := testPacket("pod3", 40)
+	assert.NoError(t, r.writePacket("pod3", captureInfo(p), p.Packet.Data))
+	assert.NoError(t, r.Close())
+
+	// the pods added are described in the next files
+	files, err := filepath.Glob(filepath.Join(dir, "kpture-00002-*.pcapng"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	f, err := os.Open(files[0])
+	assert.NoError(t, err)
+	defer f.Close()
+	ng, err := pcapgo.NewNgReader(f, pcapgo.DefaultNgReaderOptions)
+	assert.NoError(t, err)
+	_, ci, err := ng.ReadPacketData()
+	assert.NoError(t, err)
+	intf, err := ng.Interface(ci.InterfaceIndex)
+	assert.NoError(t, err)
+	assert.Equal(t, "ns-test/pod3", intf.Name)
+}
+
+func TestRotatingWriterFailedRotation(t *testing.T) {
+	dir := t.TempDir()
+	opened := 0
+	open := func(o io.Writer) (packetWriter, error) {
+		opened++
+		if opened == 2 {
+			return nil, errors.New("header not written")
+		}
+		return newPacketWriter(o, testPods, LoadOpts(), false)
+	}
+
+	// the current file is kept when the next one cannot be opened
+	r, err := newRotatingWriter(filepath.Join(dir, "kpture.pcap"), Rotation{MaxSize: 80}, CompressionNone, open)
+	assert.NoError(t, err)
+	p := testPacket("pod1", 40)
+	assert.NoError(t, r.writePacket("pod1", captureInfo(p), p.Packet.Data))
+	assert.Error(t, r.writePacket("pod1", captureInfo(p), p.Packet.Data))
+	assert.NoError(t, r.writePacket("pod1", captureInfo(p), p.Packet.Data))
+	assert.NoError(t, r.Close())
+	assert.ErrorIs(t, r.writePacket("pod1", captureInfo(p), p.Packet.Data), errRotatingClosed)
+
+	files, err := filepath.Glob(filepath.Join(dir, "kpture-*.pcap"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+	assert.Equal(t, 1, countPackets(t, files[0]))
+	assert.Equal(t, 1, countPackets(t, files[1]))
+}
@@ -0,0 +1,129 @@
+package sink
+
+import (
+	"time"
+
+	capture "github.com/gmtstephane/kpture/api/kpture"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Sink receives the packets of a kpture.
+type Sink interface {
+	Write(p *capture.PacketDescriptor) error
+	Close() error
+}
+
+// PodAdder is implemented by the sinks keeping a state per pod,
+// pods that start during a capture are added before their first packet.
+type PodAdder interface {
+	AddPod(pod v1.Pod) error
+}
+
+// AddPod adds the pod to s if it keeps a state per pod.
+func AddPod(s Sink, pod v1.Pod) error {
+	if a, ok := s.(PodAdder); ok {
+		return a.AddPod(pod)
+	}
+	return nil
+}
+
+// Gap is a period without capture for a pod, e.g while its agent was restarted
+type Gap struct {
+	From   time.Time
+	To     time.Time
+	Reason string
+}
+
+func (g Gap) String() string {
+	return "no capture from " + g.From.Format(time.RFC3339Nano) + " to " + g.To.Format(time.RFC3339Nano) + ": " + g.Reason
+}
+
+// GapMarker is implemented by the sinks annotating the gaps of a capture.
+// The pod may have been recreated, its metadata is updated.
+type GapMarker interface {
+	MarkGap(pod v1.Pod, g Gap) error
+}
+
+// MarkGap annotates the gap of a pod if s supports it.
+func MarkGap(s Sink, pod v1.Pod, g Gap) error {
+	if m, ok := s.(GapMarker); ok {
+		return m.MarkGap(pod, g)
+	}
+	return nil
+}
+
+// PodEnder is implemented by the sinks keeping a state per pod,
+// the pods which ended during a capture will not send packets anymore.
+type PodEnder interface {
+	EndPod(name string) error
+}
+
+// EndPod marks the pod ended in s if it keeps a state per pod.
+func EndPod(s Sink, name string) error {
+	if e, ok := s.(PodEnder); ok {
+		return e.EndPod(name)
+	}
+	return nil
+}
+
+// multi writes every packet to several sinks
+type multi []Sink
+
+// Multi returns a sink that writes each packet to all the sinks in order.
+func Multi(sinks ...Sink) Sink {
+	return multi(sinks)
+}
+
+// Write stops at the first sink returning an error.
+func (m multi) Write(p *capture.PacketDescriptor) error {
+	for _, s := range m {
+		if err := s.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddPod adds the pod to all the sinks and returns the first error.
+func (m multi) AddPod(pod v1.Pod) error {
+	var err error
+	for _, s := range m {
+		if errAdd := AddPod(s, pod); errAdd != nil && err == nil {
+			err = errAdd
+		}
+	}
+	return err
+}
+
+// MarkGap annotates the gap in all the sinks and returns the first error.
+func (m multi) MarkGap(pod v1.Pod, g Gap) error {
+	var err error
+	for _, s := range m {
+		if errMark := MarkGap(s, pod, g); errMark != nil && err == nil {
+			err = errMark
+		}
+	}
+	return err
+}
+
+// EndPod marks the pod ended in all the sinks and returns the first error.
+func (m multi) EndPod(name string) error {
+	var err error
+	for _, s := range m {
+		if errEnd := EndPod(s, name); errEnd != nil && err == nil {
+			err = errEnd
+		}
+	}
+	return err
+}
+
+// Close closes all the sinks and returns the first error.
+func (m multi) Close() error {
+	var err error
+	for _, s := range m {
+		if errClose := s.Close(); errClose != nil && err == nil {
+			err = errClose
+		}
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package sink
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMulti(t *testing.T) {
+	first, second := &sinkMock{}, &sinkMock{}
+	m := Multi(first, second)
+
+	err := m.Write(testPacket("pod1", 10))
+	assert.NoError(t, err)
+	assert.Len(t, first.packets, 1)
+	assert.Len(t, second.packets, 1)
+
+	// an error stops the write
+	first.writeErr = errMock
+	err = m.Write(testPacket("pod1", 10))
+	assert.ErrorIs(t, err, errMock)
+	assert.Len(t, second.packets, 1)
+
+	// all sinks are closed even on error
+	first.closeErr = errMock
+	err = m.Close()
+	assert.ErrorIs(t, err, errMock)
+	assert.True(t, first.closed)
+	assert.True(t, second.closed)
+
+	// no sinks
+	assert.NoError(t, Multi().Write(testPacket("pod1", 10)))
+	assert.NoError(t, Multi().Close())
+}
+
+func TestMultiAddPod(t *testing.T) {
+	first, second := &sinkMock{addErr: errMock}, &sinkMock{}
+	m := Multi(first, second)
+
+	// the pod is added to all sinks even on error
+	assert.ErrorIs(t, AddPod(m, newPod), errMock)
+	assert.Equal(t, []string{"pod3"}, first.added)
+	assert.Equal(t, []string{"pod3"}, second.added)
+
+	// sinks without per-pod state are ignored
+	assert.NoError(t, AddPod(NewCounter(nil), newPod))
+	assert.NoError(t, AddPod(Multi(Limit(&sinkMock{}, Limits{}, nil)), newPod))
+}
+
+func TestMultiMarkGap(t *testing.T) {
+	first, second := &sinkMock{}, &sinkMock{}
+	s := Limit(Multi(first, second), Limits{}, testPods)
+	assert.NoError(t, MarkGap(s, testPods[0], testGap))
+	assert.Equal(t, []Gap{testGap}, first.gaps)
+	assert.Equal(t, []Gap{testGap}, second.gaps)
+	assert.NoError(t, MarkGap(Multi(), testPods[0], testGap))
+}
+
+func TestGapString(t *testing.T) {
+	assert.Equal(t,
+		"no capture from "+testTime.Format(time.RFC3339Nano)+" to "+testTime.Add(2*time.Second).Format(time.RFC3339Nano)+": agent terminated",
+		testGap.String())
+}
@@ -0,0 +1,90 @@
+package sink
+
+import (
+	"errors"
+	"time"
+
+	capture "github.com/gmtstephane/kpture/api/kpture"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var testPods = []v1.Pod{
+	{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod1",
+			Namespace: "ns-test",
+			Labels:    map[string]string{"app": "nginx", "tier": "front"},
+		},
+		Spec:   v1.PodSpec{NodeName: "node1"},
+		Status: v1.PodStatus{PodIPs: []v1.PodIP{{IP: "10.0.0.1"}, {IP: "fd00::1"}}},
+	},
+	{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod2",
+			Namespace: "ns-test",
+		},
+		Spec:   v1.PodSpec{NodeName: "node2"},
+		Status: v1.PodStatus{PodIP: "10.0.0.2"},
+	},
+}
+
+var testTime = time.Unix(1678000000, 123456789)
+
+// testPacket returns a packet of size bytes sent by pod
+func testPacket(pod string, size int) *capture.PacketDescriptor {
+	ci := &capture.CaptureInfo{
+		CaptureLength: int64(size),
+		Length:        int64(size),
+	}
+	ci.SetTime(testTime)
+	return &capture.PacketDescriptor{
+		Name: pod,
+		Packet: &capture.Packet{
+			Data:        make([]byte, size),
+			CaptureInfo: ci,
+		},
+	}
+}
+
+// sinkMock records the packets it receives
+type sinkMock struct {
+	packets  []*capture.PacketDescriptor
+	writeErr error
+	closeErr error
+	closed   bool
+	added    []string
+	addErr   error
+	gaps     []Gap
+}
+
+func (s *sinkMock) Write(p *capture.PacketDescriptor) error {
+	if s.writeErr != nil {
+		return s.writeErr
+	}
+	s.packets = append(s.packets, p)
+	return nil
+}
+
+func (s *sinkMock) AddPod(pod v1.Pod) error {
+	s.added = append(s.added, pod.Name)
+	return s.addErr
+}
+
+func (s *sinkMock) MarkGap(_ v1.Pod, g Gap) error {
+	s.gaps = append(s.gaps, g)
+	return nil
+}
+
+func (s *sinkMock) Close() error {
+	s.closed = true
+	return s.closeErr
+}
+
+var errMock = errors.New("mock error")
+
+// testGap is a restart of the pod1 agent
+var testGap = Gap{From: testTime, To: testTime.Add(2 * time.Second), Reason: "agent terminated"}
+
+// newPod is a pod started during the capture
+var newPod = v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod3", Namespace: "ns-test"}}
@@ -0,0 +1,48 @@
+package sink
+
+import (
+	"io"
+	"os"
+
+	capture "github.com/gmtstephane/kpture/api/kpture"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Writer streams the packets of all the pods to an io.Writer.
+// The output is flushed after each packet so that it can be piped to tshark or wireshark.
+type Writer struct {
+	w packetWriter
+}
+
+// NewWriter creates a stream sink, rotation options are ignored.
+func NewWriter(o io.Writer, pods []v1.Pod, opts Opts) (*Writer, error) {
+	w, err := newPacketWriter(o, pods, opts, true)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{w: w}, nil
+}
+
+// NewStdout creates a stream sink to the standard output.
+func NewStdout(pods []v1.Pod, opts Opts) (*Writer, error) {
+	return NewWriter(os.Stdout, pods, opts)
+}
+
+func (w *Writer) Write(p *capture.PacketDescriptor) error {
+	return w.w.writePacket(p.GetName(), captureInfo(p), p.GetPacket().GetData())
+}
+
+// AddPod describes a pod that started during the capture.
+func (w *Writer) AddPod(pod v1.Pod) error {
+	return w.w.addPod(pod)
+}
+
+// MarkGap annotates the gap of a pod.
+func (w *Writer) MarkGap(pod v1.Pod, g Gap) error {
+	return w.w.markGap(pod, g)
+}
+
+// Close flushes the output, the underlying writer is not closed.
+func (w *Writer) Close() error {
+	return w.w.flush()
+}
@@ -0,0 +1,27 @@
+package sink
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, testPods, LoadOpts(WithFormat(FormatPcapng)))
+	assert.NoError(t, err)
+
+	// the header is available right away for live readers
+	assert.NotZero(t, buf.Len())
+	assert.NoError(t, w.Write(testPacket("pod1", 10)))
+
+	// and each packet is flushed without closing
+	r, err := pcapgo.NewNgReader(bytes.NewReader(buf.Bytes()), pcapgo.DefaultNgReaderOptions)
+	assert.NoError(t, err)
+	data, _, err := r.ReadPacketData()
+	assert.NoError(t, err)
+	assert.Len(t, data, 10)
+	assert.NoError(t, w.Close())
+}